@@ -0,0 +1,260 @@
+// Package client implements a client of the skkserv protocol.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	skkserv "github.com/kechako/goskkserv"
+	"github.com/kechako/goskkserv/dict"
+)
+
+var ErrServerFull = errors.New("server full")
+
+type Option func(*options)
+
+type options struct {
+	encoding skkserv.Encoding
+}
+
+// WithEncoding sets the encoding of the server. Default is EUC-JP, the
+// encoding most servers use.
+func WithEncoding(enc skkserv.Encoding) Option {
+	return func(o *options) {
+		o.encoding = enc
+	}
+}
+
+type Client struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    io.Writer
+
+	mu sync.Mutex
+}
+
+func Dial(addr string, opts ...Option) (*Client, error) {
+	return DialContext(context.Background(), addr, opts...)
+}
+
+func DialContext(ctx context.Context, addr string, opts ...Option) (*Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+
+	return NewClient(conn, opts...), nil
+}
+
+// NewClient returns a Client talking to a server over conn.
+func NewClient(conn net.Conn, opts ...Option) *Client {
+	o := &options{
+		encoding: skkserv.EUCJP,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	enc := o.encoding.TextEncoding()
+	return &Client{
+		conn: conn,
+		r:    bufio.NewReader(enc.NewDecoder().Reader(conn)),
+		w:    enc.NewEncoder().Writer(conn),
+	}
+}
+
+// Search returns the candidates of key, or nil if key is not found.
+func (c *Client) Search(ctx context.Context, key string) ([]dict.Candidate, error) {
+	resp, err := c.request(ctx, skkserv.ClientRequest, key)
+	if err != nil {
+		return nil, err
+	}
+	if resp == "" {
+		return nil, nil
+	}
+
+	return dict.ParseCandidates(resp), nil
+}
+
+// Complete returns the keys starting with prefix, or nil if there is none.
+func (c *Client) Complete(ctx context.Context, prefix string) ([]string, error) {
+	resp, err := c.request(ctx, skkserv.ClientCompletion, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, key := range strings.Split(resp, "/") {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+// Version returns the version string of the server.
+func (c *Client) Version(ctx context.Context) (string, error) {
+	return c.info(ctx, skkserv.ClientVersion)
+}
+
+// Host returns the host information of the server.
+func (c *Client) Host(ctx context.Context) (string, error) {
+	return c.info(ctx, skkserv.ClientHost)
+}
+
+// Close tells the server the end of the session, and closes the connection.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// say goodbye, but do not care whether the server hears it
+	c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	c.w.Write([]byte{skkserv.ClientEnd})
+
+	return c.conn.Close()
+}
+
+// request sends a request with key and returns the candidates part of the
+// response, that is, "/cand1/cand2/" for found and "" for not found.
+func (c *Client) request(ctx context.Context, cmd byte, key string) (string, error) {
+	if strings.ContainsAny(key, " \n") {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	defer c.watch(ctx)()
+
+	req := string(cmd) + key + " "
+	if _, err := io.WriteString(c.w, req); err != nil {
+		return "", c.error(ctx, "failed to send request", err)
+	}
+
+	resp, err := readResponse(c.r, req)
+	if err != nil {
+		return "", c.error(ctx, "failed to read response", err)
+	}
+
+	switch resp[0] {
+	case skkserv.ServerFound:
+		return strings.TrimRight(resp[1:], "\r"), nil
+	case skkserv.ServerNotFound:
+		return "", nil
+	case skkserv.ServerFull:
+		return "", ErrServerFull
+	default:
+		return "", fmt.Errorf("unexpected response %q", resp)
+	}
+}
+
+func (c *Client) info(ctx context.Context, cmd byte) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	defer c.watch(ctx)()
+
+	if _, err := c.w.Write([]byte{cmd}); err != nil {
+		return "", c.error(ctx, "failed to send request", err)
+	}
+
+	// the response has no terminator, so take what the server sent at once
+	if _, err := c.r.Peek(1); err != nil {
+		return "", c.error(ctx, "failed to read response", err)
+	}
+	buf := make([]byte, c.r.Buffered())
+	if _, err := io.ReadFull(c.r, buf); err != nil {
+		return "", c.error(ctx, "failed to read response", err)
+	}
+
+	return strings.TrimSpace(string(buf)), nil
+}
+
+// watch applies the deadline and the cancellation of ctx to the
+// connection until the returned function is called.
+func (c *Client) watch(ctx context.Context) func() {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetDeadline(deadline)
+	}
+	if ctx.Done() == nil {
+		return func() {
+			c.conn.SetDeadline(time.Time{})
+		}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-ctx.Done():
+			// interrupt the blocking I/O
+			c.conn.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+
+	return func() {
+		close(stop)
+		<-done
+		c.conn.SetDeadline(time.Time{})
+	}
+}
+
+func (c *Client) error(ctx context.Context, msg string, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		err = ctxErr
+	}
+
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// readResponse reads a response to req. A found response ends with a
+// newline, but some servers echo the request without a newline for not
+// found.
+func readResponse(r *bufio.Reader, req string) (string, error) {
+	var c byte
+	var err error
+	for {
+		c, err = r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if c != ' ' && c != '\r' && c != '\n' {
+			break
+		}
+	}
+
+	first := c
+	echo := []byte(req[1:])
+	resp := []byte{c}
+	for {
+		if first == skkserv.ServerNotFound && bytes.Equal(resp[1:], echo) {
+			break
+		}
+		if first == skkserv.ServerFull {
+			break
+		}
+
+		c, err = r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if c == '\n' {
+			break
+		}
+		resp = append(resp, c)
+	}
+
+	return string(resp), nil
+}
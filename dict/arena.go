@@ -0,0 +1,72 @@
+package dict
+
+import "unsafe"
+
+const (
+	arenaChunkSize = 64 << 10
+	arenaSlabSize  = 1024
+)
+
+// arena allocates the strings, the candidates and the payloads of the
+// entries of a snapshot from large chunks, so loading a dictionary makes a
+// few thousand allocations instead of millions. It also interns the
+// strings, as the same candidate texts appear in many entries.
+//
+// An arena is used only while building a snapshot. The chunks live as long
+// as any of the entries allocated from them.
+type arena struct {
+	chunk   []byte
+	strings map[string]string
+	slab    []candidate
+}
+
+func newArena() *arena {
+	return &arena{
+		strings: make(map[string]string),
+	}
+}
+
+// alloc returns an empty slice with the capacity of n.
+func (a *arena) alloc(n int) []byte {
+	if n > arenaChunkSize/4 {
+		return make([]byte, 0, n)
+	}
+	if cap(a.chunk)-len(a.chunk) < n {
+		a.chunk = make([]byte, 0, arenaChunkSize)
+	}
+
+	b := a.chunk[len(a.chunk) : len(a.chunk) : len(a.chunk)+n]
+	a.chunk = a.chunk[:len(a.chunk)+n]
+
+	return b
+}
+
+// string returns an interned copy of s.
+func (a *arena) string(s string) string {
+	if s == "" {
+		return ""
+	}
+	if is, ok := a.strings[s]; ok {
+		return is
+	}
+
+	b := append(a.alloc(len(s)), s...)
+	is := unsafe.String(unsafe.SliceData(b), len(b))
+	a.strings[is] = is
+
+	return is
+}
+
+func (a *arena) candidate(text, annotation, source string) *candidate {
+	if len(a.slab) == 0 {
+		a.slab = make([]candidate, arenaSlabSize)
+	}
+
+	c := &a.slab[0]
+	a.slab = a.slab[1:]
+	c.text = a.string(text)
+	c.annotation = a.string(annotation)
+	c.source = a.string(source)
+
+	return c
+}
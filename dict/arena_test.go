@@ -0,0 +1,51 @@
+package dict
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// largeJisyo returns a UTF-8 SKK-JISYO file of n keys, whose candidates
+// are shared among the keys as in SKK-JISYO.L.
+func largeJisyo(n int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(";; -*- coding: utf-8 -*-\n;; okuri-nasi entries.\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&buf, "かな%d /漢字%d/感字%d/候補%d;注釈%d/\n", i, i%5000, i%3000, i, i%100)
+	}
+
+	return buf.Bytes()
+}
+
+// BenchmarkLoadHeap reports the heap taken by a dictionary of 200k keys.
+func BenchmarkLoadHeap(b *testing.B) {
+	name := filepath.Join(b.TempDir(), "SKK-JISYO.large")
+	if err := os.WriteFile(name, largeJisyo(200000), 0o644); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	var heap, objects uint64
+	for i := 0; i < b.N; i++ {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		d, err := OpenDictionary([]string{name})
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		heap += after.HeapAlloc - before.HeapAlloc
+		objects += after.HeapObjects - before.HeapObjects
+		runtime.KeepAlive(d)
+	}
+	b.ReportMetric(float64(heap)/float64(b.N)/(1<<20), "heap-MB")
+	b.ReportMetric(float64(objects)/float64(b.N), "heap-objects")
+}
@@ -0,0 +1,124 @@
+package dict
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sources returns the dictionary files the entries of d are loaded from,
+// in order.
+func (d *Dictionary) Sources() []Source {
+	return append([]Source(nil), d.load().sources...)
+}
+
+// Attach adds the entries of the dictionary file of src at runtime. The
+// candidates of src come after those of the dictionaries already attached
+// with the same or higher Priority, and before those with lower Priority,
+// as if src were loaded with them, and they are sorted again unless the
+// Dictionary is in DictionaryOrder. Searches see the old entries until all
+// of src is loaded.
+func (d *Dictionary) Attach(src Source) error {
+	tx := d.Begin()
+	defer tx.Rollback()
+
+	last := true
+	for _, s := range tx.b.sources {
+		if s.Name == src.Name {
+			return fmt.Errorf("dictionary %s is already attached", src.Name)
+		}
+		if s.Priority < src.Priority {
+			last = false
+		}
+	}
+	if last && tx.d.order == DictionaryOrder && tx.d.emoji&EmojiLast == 0 {
+		if err := tx.b.addSource(src); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+
+	// the candidates of src go before some of the others, so the entries
+	// are rebuilt in the order of Priority
+	sources := sortSources(append(tx.b.sources[:len(tx.b.sources):len(tx.b.sources)], src))
+	if _, err := tx.rebuild(sources); err != nil {
+		return fmt.Errorf("failed to attach dictionary %s: %w", src.Name, err)
+	}
+
+	return tx.Commit()
+}
+
+// Detach removes the entries of the named dictionary file at runtime. The
+// entries are rebuilt from the other dictionary files aside, and swapped in
+// at once, so searches see either the old entries or the new ones. The
+// candidates added by AddEntry or Tx are kept.
+func (d *Dictionary) Detach(name string) error {
+	tx := d.Begin()
+	defer tx.Rollback()
+
+	var sources []Source
+	for _, s := range tx.b.sources {
+		if s.Name != name {
+			sources = append(sources, s)
+		}
+	}
+	if len(sources) == len(tx.b.sources) {
+		return fmt.Errorf("dictionary %s is not attached", name)
+	}
+
+	if _, err := tx.rebuild(sources); err != nil {
+		return fmt.Errorf("failed to detach dictionary %s: %w", name, err)
+	}
+
+	return tx.Commit()
+}
+
+// Reload reads all the dictionary files of d again, including those loaded
+// by LoadFS, into a new table, and swaps it in at once, so edits of the
+// files take effect without stopping searches. The candidates added by
+// AddEntry or Tx are kept. If a file fails to load, d is left as it is. It
+// returns the result of each file.
+func (d *Dictionary) Reload() ([]LoadResult, error) {
+	tx := d.Begin()
+	defer tx.Rollback()
+
+	results, err := tx.rebuild(tx.b.sources)
+	if err != nil {
+		return results, fmt.Errorf("failed to reload dictionary: %w", err)
+	}
+
+	return results, tx.Commit()
+}
+
+// rebuild replaces the builder of tx with a new one of the files in the
+// file systems of tx and the dictionary files of sources, adding the
+// candidates of tx that are not from files.
+func (tx *Tx) rebuild(sources []Source) ([]LoadResult, error) {
+	b := tx.b.child()
+	for _, src := range tx.b.fsSources {
+		if err := b.addFS(src.fsys, src.name); err != nil {
+			return nil, err
+		}
+	}
+	results := b.addFiles(sources)
+	var errs []error
+	for _, r := range results {
+		if r.Err != nil {
+			errs = append(errs, r.Err)
+		}
+	}
+	if len(errs) > 0 {
+		return results, errors.Join(errs...)
+	}
+	b.sort()
+
+	for key, e := range tx.b.table {
+		for _, c := range e.candidates {
+			if c.Source() == "" {
+				b.entry(key).addCandidate(b.arena, b.mergeAnnotations, c)
+			}
+		}
+	}
+	tx.b = b
+
+	return results, nil
+}
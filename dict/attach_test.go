@@ -0,0 +1,219 @@
+package dict
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// writeJisyo writes a SKK-JISYO file of lines in UTF-8 to dir, and returns
+// its name.
+func writeJisyo(t *testing.T, dir, name string, lines ...string) string {
+	t.Helper()
+
+	name = filepath.Join(dir, name)
+	data := ";; -*- coding: utf-8 -*-\n;; okuri-nasi entries.\n" + strings.Join(lines, "\n") + "\n"
+	if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return name
+}
+
+func searchTexts(t *testing.T, d *Dictionary, key string) string {
+	t.Helper()
+
+	candidates, err := d.Search(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts := make([]string, len(candidates))
+	for i, c := range candidates {
+		texts[i] = c.Text()
+	}
+
+	return strings.Join(texts, "/")
+}
+
+func sourceNames(d *Dictionary) string {
+	var names []string
+	for _, src := range d.Sources() {
+		names = append(names, filepath.Base(src.Name))
+	}
+
+	return strings.Join(names, ",")
+}
+
+func TestAttachOrder(t *testing.T) {
+	dir := t.TempDir()
+	low := writeJisyo(t, dir, "low", "かんじ /幹事/漢字/")
+	high := writeJisyo(t, dir, "high", "かんじ /漢字/感じ/")
+	mid := writeJisyo(t, dir, "mid", "かんじ /監事/感じ/幹事/")
+	last := writeJisyo(t, dir, "last", "かんじ /莞爾/漢字/")
+	first := writeJisyo(t, dir, "first", "かんじ /完治/監事/")
+
+	for _, order := range []CandidateOrder{DictionaryOrder, FrequencyOrder} {
+		d, err := OpenSources([]Source{
+			{Name: low, Encoding: "utf-8"},
+			{Name: high, Encoding: "utf-8", Priority: 10},
+		}, OrderCandidates(order))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.AddEntry("かんじ", "幹事長", "")
+
+		steps := []struct {
+			name    string
+			do      func() error
+			sources string
+			texts   string
+		}{
+			{
+				name:    "open",
+				do:      func() error { return nil },
+				sources: "high,low",
+				texts:   "漢字/感じ/幹事/幹事長",
+			},
+			{
+				name:    "attach between",
+				do:      func() error { return d.Attach(Source{Name: mid, Encoding: "utf-8", Priority: 5}) },
+				sources: "high,mid,low",
+				texts:   "漢字/感じ/監事/幹事/幹事長",
+			},
+			{
+				name:    "attach last",
+				do:      func() error { return d.Attach(Source{Name: last, Encoding: "utf-8"}) },
+				sources: "high,mid,low,last",
+				texts:   "漢字/感じ/監事/幹事/幹事長/莞爾",
+			},
+			{
+				name:    "attach first",
+				do:      func() error { return d.Attach(Source{Name: first, Encoding: "utf-8", Priority: 20}) },
+				sources: "first,high,mid,low,last",
+				texts:   "完治/監事/漢字/感じ/幹事/莞爾/幹事長",
+			},
+			{
+				name:    "detach",
+				do:      func() error { return d.Detach(first) },
+				sources: "high,mid,low,last",
+				texts:   "漢字/感じ/監事/幹事/莞爾/幹事長",
+			},
+			{
+				name: "reload",
+				do: func() error {
+					writeJisyo(t, dir, "mid", "かんじ /幹事/監事/")
+					_, err := d.Reload()
+					return err
+				},
+				sources: "high,mid,low,last",
+				texts:   "漢字/感じ/幹事/監事/莞爾/幹事長",
+			},
+		}
+		for _, step := range steps {
+			if err := step.do(); err != nil {
+				t.Fatalf("%v %s: %v", order, step.name, err)
+			}
+			if got := sourceNames(d); got != step.sources {
+				t.Errorf("%v %s: Sources() = %s, want %s", order, step.name, got, step.sources)
+			}
+			if order != DictionaryOrder {
+				continue
+			}
+			if got := searchTexts(t, d, "かんじ"); got != step.texts {
+				t.Errorf("%s: Search() = %s, want %s", step.name, got, step.texts)
+			}
+		}
+		writeJisyo(t, dir, "mid", "かんじ /監事/感じ/幹事/")
+	}
+}
+
+func TestAttachDuplicate(t *testing.T) {
+	dir := t.TempDir()
+	a := writeJisyo(t, dir, "a", "かんじ /漢字/")
+
+	d, err := OpenSources([]Source{{Name: a, Encoding: "utf-8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Attach(Source{Name: a, Encoding: "utf-8", Priority: 1}); err == nil {
+		t.Error("Attach() of an attached dictionary succeeded")
+	}
+	if err := d.Detach(filepath.Join(dir, "b")); err == nil {
+		t.Error("Detach() of a dictionary not attached succeeded")
+	}
+	if got, want := searchTexts(t, d, "かんじ"), "漢字"; got != want {
+		t.Errorf("Search() = %s, want %s", got, want)
+	}
+}
+
+func TestOpenSourcesDedup(t *testing.T) {
+	dir := t.TempDir()
+	sources := []Source{
+		{Name: writeJisyo(t, dir, "a", "かんじ /幹事/漢字;a/"), Encoding: "utf-8"},
+		{Name: writeJisyo(t, dir, "b", "かんじ /漢字;b/感じ/"), Encoding: "utf-8", Priority: 2},
+		{Name: writeJisyo(t, dir, "c", "かんじ /感じ/漢字/監事/"), Encoding: "utf-8", Priority: 2},
+		{Name: writeJisyo(t, dir, "d", "かんじ /監事/幹事/"), Encoding: "utf-8", Priority: 1},
+	}
+
+	d, err := OpenSources(sources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sourceNames(d), "b,c,d,a"; got != want {
+		t.Errorf("Sources() = %s, want %s", got, want)
+	}
+
+	candidates, err := d.Search(context.Background(), "かんじ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range candidates {
+		got = append(got, c.Text()+";"+c.Annotation()+"@"+filepath.Base(c.Source()))
+	}
+	want := "漢字;b@b/感じ;@b/監事;@c/幹事;@d"
+	if strings.Join(got, "/") != want {
+		t.Errorf("Search() = %s, want %s", strings.Join(got, "/"), want)
+	}
+}
+
+func TestReloadFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"SKK-JISYO.fs": {Data: []byte(";; -*- coding: utf-8 -*-\n;; okuri-nasi entries.\nかんじ /漢字/\n")},
+	}
+	d, err := LoadFS(fsys, "SKK-JISYO.fs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.AddEntry("かんじ", "幹事", "")
+
+	if _, err := d.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := searchTexts(t, d, "かんじ"), "漢字/幹事"; got != want {
+		t.Errorf("Search() after Reload = %q, want %q", got, want)
+	}
+
+	dir := t.TempDir()
+	file := writeJisyo(t, dir, "file", "かんじ /感じ/")
+	if err := d.Attach(Source{Name: file, Encoding: "utf-8", Priority: 10}); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Detach(file); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := searchTexts(t, d, "かんじ"), "漢字/幹事"; got != want {
+		t.Errorf("Search() after Detach = %q, want %q", got, want)
+	}
+
+	fsys["SKK-JISYO.fs"].Data = []byte(";; -*- coding: utf-8 -*-\n;; okuri-nasi entries.\nかんじ /漢字/監事/\n")
+	if _, err := d.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := searchTexts(t, d, "かんじ"), "漢字/監事/幹事"; got != want {
+		t.Errorf("Search() after Reload of an edited file = %q, want %q", got, want)
+	}
+}
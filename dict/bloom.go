@@ -0,0 +1,153 @@
+package dict
+
+import (
+	"context"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/kechako/goskkserv/dict/jisyo"
+)
+
+// Bloom is a Searcher that checks a bloom filter of the keys of another
+// Searcher before searching it. Most searches of secondary dictionaries
+// are misses, and the filter answers almost all of them without touching
+// the Searcher, which may be on disk or remote.
+//
+// The filter must know all the keys of the Searcher. Keys added to the
+// Searcher later must be added to the filter with Add.
+type Bloom struct {
+	searcher Searcher
+
+	mu   sync.RWMutex
+	bits []uint64
+	k    uint32
+}
+
+var _ Searcher = (*Bloom)(nil)
+
+// NewBloom returns a Bloom of s, whose filter holds keys with the false
+// positive rate of about fp.
+func NewBloom(s Searcher, keys []string, fp float64) *Bloom {
+	if fp <= 0 || fp >= 1 {
+		fp = 0.01
+	}
+
+	n := float64(len(keys))
+	if n < 1 {
+		n = 1
+	}
+	m := math.Ceil(-n * math.Log(fp) / (math.Ln2 * math.Ln2))
+	k := math.Round(m / n * math.Ln2)
+	if k < 1 {
+		k = 1
+	}
+
+	// the bits are rounded up to a power of two, for which the probes of
+	// bloomHash never repeat
+	words := 1
+	for float64(words)*64 < m {
+		words <<= 1
+	}
+
+	b := &Bloom{
+		searcher: s,
+		bits:     make([]uint64, words),
+		k:        uint32(k),
+	}
+	for _, key := range keys {
+		b.add(key)
+	}
+
+	return b
+}
+
+// Add adds key to the filter.
+func (b *Bloom) Add(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.add(key)
+}
+
+func (b *Bloom) add(key string) {
+	m := uint64(len(b.bits)) * 64
+	h1, h2 := bloomHash(key)
+	for i := uint32(0); i < b.k; i++ {
+		n := (h1 + uint64(i)*h2) % m
+		b.bits[n/64] |= 1 << (n % 64)
+	}
+}
+
+// mayContain reports whether key may be a key of the Searcher.
+func (b *Bloom) mayContain(key string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	m := uint64(len(b.bits)) * 64
+	h1, h2 := bloomHash(key)
+	for i := uint32(0); i < b.k; i++ {
+		n := (h1 + uint64(i)*h2) % m
+		if b.bits[n/64]&(1<<(n%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// keyNormalizer is a Searcher that normalizes the keys of the searches,
+// such as a Dictionary of NormalizeKeys.
+type keyNormalizer interface {
+	key(key string) string
+}
+
+// mayFind reports whether a search of key may find candidates. As well as
+// key, it checks the keys a Dictionary falls back to: key normalized, in
+// lower case, and without the okurigana, such as "おくr" for "おくrる".
+func (b *Bloom) mayFind(key string) bool {
+	if n, ok := b.searcher.(keyNormalizer); ok {
+		key = n.key(key)
+	}
+	if b.mayContain(key) {
+		return true
+	}
+	if folded := strings.ToLower(key); folded != key && b.mayContain(folded) {
+		return true
+	}
+	if base, _, ok := jisyo.SplitOkurigana(key); ok && b.mayContain(base) {
+		return true
+	}
+
+	return false
+}
+
+// bloomHash returns two hashes of key for double hashing, from the halves
+// of the 64-bit FNV-1a hash.
+func bloomHash(key string) (uint64, uint64) {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+
+	// an odd h2 is coprime to the number of the bits, a power of two, so the
+	// probes never cycle back to h1 before all the bits are visited
+	return h & 0xffffffff, h>>32 | 1
+}
+
+func (b *Bloom) Search(ctx context.Context, key string) ([]Candidate, error) {
+	if !b.mayFind(key) {
+		return nil, nil
+	}
+
+	return b.searcher.Search(ctx, key)
+}
+
+func (b *Bloom) Complete(ctx context.Context, prefix string) ([]string, error) {
+	return b.searcher.Complete(ctx, prefix)
+}
+
+func (b *Bloom) Stats() Stats {
+	return b.searcher.Stats()
+}
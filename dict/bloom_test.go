@@ -0,0 +1,91 @@
+package dict
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kechako/goskkserv/dict/normalize"
+)
+
+func TestBloom(t *testing.T) {
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("かな%d", i)
+	}
+	b := NewBloom(&Dictionary{}, keys, 0.01)
+
+	if n := len(b.bits); n&(n-1) != 0 {
+		t.Errorf("len(bits) = %d, not a power of two", n)
+	}
+	for _, key := range keys {
+		if !b.mayContain(key) {
+			t.Errorf("mayContain(%q) = false", key)
+		}
+	}
+
+	var positives int
+	for i := 0; i < 10000; i++ {
+		if b.mayContain(fmt.Sprintf("なし%d", i)) {
+			positives++
+		}
+	}
+	if positives > 200 {
+		t.Errorf("false positives = %d in 10000, want about 100", positives)
+	}
+
+	if candidates, err := b.Search(context.Background(), "なし"); err != nil || candidates != nil {
+		t.Errorf("Search() of a missing key = %v, %v", candidates, err)
+	}
+}
+
+// TestBloomProbes checks that the probes of a key are distinct bits, which
+// holds only if the number of the bits is a power of two.
+func TestBloomProbes(t *testing.T) {
+	for _, n := range []int{1, 3, 10, 100, 1000} {
+		keys := make([]string, n)
+		for i := range keys {
+			keys[i] = fmt.Sprintf("かな%d", i)
+		}
+		b := NewBloom(&Dictionary{}, keys, 0.001)
+
+		m := uint64(len(b.bits)) * 64
+		for _, key := range keys[:(n+9)/10] {
+			h1, h2 := bloomHash(key)
+			seen := make(map[uint64]bool)
+			for i := uint64(0); i < m; i++ {
+				p := (h1 + i*h2) % m
+				if seen[p] {
+					t.Fatalf("%d keys: probe %d of %q repeats bit %d of %d", n, i, key, p, m)
+				}
+				seen[p] = true
+			}
+		}
+	}
+}
+
+// TestBloomFallbacks checks that the keys found only by the fallbacks of
+// the Dictionary are not filtered out.
+func TestBloomFallbacks(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "SKK-JISYO.test")
+	if err := os.WriteFile(name, []byte(";; -*- coding: utf-8 -*-\nおくr /送/[る/送/]/\nskk /SKK/\nかな /仮名/\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	d, err := OpenSources([]Source{{Name: name, IgnoreCase: true}}, NormalizeKeys(normalize.Hiragana))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBloom(d, d.Keys(), 0.01)
+
+	for _, key := range []string{"おくrる", "SKK", "カナ"} {
+		candidates, err := b.Search(context.Background(), key)
+		if err != nil {
+			t.Fatalf("Search(%q): %v", key, err)
+		}
+		if len(candidates) == 0 {
+			t.Errorf("Search(%q) found no candidates", key)
+		}
+	}
+}
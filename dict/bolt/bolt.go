@@ -0,0 +1,279 @@
+// Package bolt provides a persistent dictionary backend stored in a bbolt
+// database. The database is opened without loading it into memory, and
+// entries can be added at runtime, such as learned ones.
+//
+// It is a separate module so that bbolt is only pulled in by the programs
+// that use it.
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kechako/goskkserv/dict"
+	"go.etcd.io/bbolt"
+)
+
+var (
+	entriesBucket = []byte("entries")
+	metaBucket    = []byte("meta")
+
+	keysKey       = []byte("keys")
+	candidatesKey = []byte("candidates")
+)
+
+// importBatchSize is the number of keys imported in a transaction.
+const importBatchSize = 10000
+
+func init() {
+	dict.RegisterFormat(".bolt", func(name string) (dict.Searcher, error) {
+		return Open(name)
+	})
+}
+
+// Dictionary is a dictionary stored in a bbolt database. The entries
+// bucket maps a key to its candidates in the form "/cand1/cand2/" in
+// UTF-8.
+type Dictionary struct {
+	db *bbolt.DB
+}
+
+var _ dict.Searcher = (*Dictionary)(nil)
+
+// Open opens the database file name. It returns an error wrapping
+// fs.ErrNotExist if the file does not exist, rather than serving an empty
+// dictionary.
+func Open(name string) (*Dictionary, error) {
+	if _, err := os.Stat(name); err != nil {
+		return nil, fmt.Errorf("failed to open dictionary file %s: %w", name, err)
+	}
+
+	return open(name)
+}
+
+// Create opens the database file name, creating it if it does not exist,
+// such as to Import a dictionary into.
+func Create(name string) (*Dictionary, error) {
+	return open(name)
+}
+
+func open(name string) (*Dictionary, error) {
+	db, err := bbolt.Open(name, 0644, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dictionary file %s: %w", name, err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(entriesBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(metaBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize dictionary file %s: %w", name, err)
+	}
+
+	return &Dictionary{db: db}, nil
+}
+
+func (d *Dictionary) Search(ctx context.Context, key string) ([]dict.Candidate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var candidates []dict.Candidate
+	err := d.db.View(func(tx *bbolt.Tx) error {
+		// ParseCandidates copies the value, which is valid only in tx
+		candidates = dict.ParseCandidates(string(tx.Bucket(entriesBucket).Get([]byte(key))))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return candidates, nil
+}
+
+// WriteCandidates writes the candidates of key in the form "/cand1/cand2/"
+// to w, as stored in the database. It reports whether key is found.
+func (d *Dictionary) WriteCandidates(w io.Writer, key string) (bool, error) {
+	var found bool
+	err := d.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(entriesBucket).Get([]byte(key))
+		if len(v) == 0 {
+			return nil
+		}
+
+		found = true
+		_, err := w.Write(v)
+		return err
+	})
+
+	return found, err
+}
+
+// Complete returns the keys starting with prefix in sorted order.
+func (d *Dictionary) Complete(ctx context.Context, prefix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if prefix == "" {
+		return nil, nil
+	}
+
+	var keys []string
+	err := d.db.View(func(tx *bbolt.Tx) error {
+		p := []byte(prefix)
+		c := tx.Bucket(entriesBucket).Cursor()
+		for k, _ := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, _ = c.Next() {
+			keys = append(keys, string(k))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (d *Dictionary) Stats() dict.Stats {
+	var stats dict.Stats
+	d.db.View(func(tx *bbolt.Tx) error {
+		meta := tx.Bucket(metaBucket)
+		stats.Keys = int(counter(meta, keysKey))
+		stats.Candidates = int(counter(meta, candidatesKey))
+		return nil
+	})
+
+	return stats
+}
+
+// AddEntry adds a candidate of key to the database. It reports whether the
+// candidate is added, that is, key does not have a candidate with the same
+// text yet.
+func (d *Dictionary) AddEntry(key, text, annotation string) (bool, error) {
+	if key == "" || strings.ContainsAny(key, " \n") {
+		return false, fmt.Errorf("invalid key %q", key)
+	}
+
+	var added bool
+	err := d.db.Update(func(tx *bbolt.Tx) error {
+		n, err := merge(tx, key, []dict.Candidate{dict.NewCandidate(text, annotation)})
+		added = n > 0
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to add [%s] to dictionary: %w", key, err)
+	}
+
+	return added, nil
+}
+
+// Import adds all the entries of src to the database. The candidates of a
+// key already in the database are merged, the existing ones first.
+func (d *Dictionary) Import(src *dict.Dictionary) error {
+	keys := src.Keys()
+	for len(keys) > 0 {
+		batch := keys
+		if len(batch) > importBatchSize {
+			batch = batch[:importBatchSize]
+		}
+		keys = keys[len(batch):]
+
+		err := d.db.Update(func(tx *bbolt.Tx) error {
+			for _, key := range batch {
+				candidates, err := src.Search(context.Background(), key)
+				if err != nil {
+					return err
+				}
+				if _, err := merge(tx, key, candidates); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to import dictionary: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (d *Dictionary) Close() error {
+	return d.db.Close()
+}
+
+// merge adds candidates to those of key, and returns the number of the
+// candidates added.
+func merge(tx *bbolt.Tx, key string, candidates []dict.Candidate) (int, error) {
+	entries := tx.Bucket(entriesBucket)
+
+	old := entries.Get([]byte(key))
+	seen := make(map[string]struct{})
+	for _, c := range dict.ParseCandidates(string(old)) {
+		seen[c.Text()] = struct{}{}
+	}
+
+	var buf bytes.Buffer
+	if len(old) > 0 {
+		buf.Write(old)
+	} else {
+		buf.WriteByte('/')
+	}
+
+	n := 0
+	for _, c := range candidates {
+		if _, ok := seen[c.Text()]; ok {
+			continue
+		}
+		seen[c.Text()] = struct{}{}
+		buf.WriteString(c.String())
+		buf.WriteByte('/')
+		n++
+	}
+	if n == 0 {
+		return 0, nil
+	}
+
+	if err := entries.Put([]byte(key), buf.Bytes()); err != nil {
+		return 0, err
+	}
+
+	meta := tx.Bucket(metaBucket)
+	if len(old) == 0 {
+		if err := addCounter(meta, keysKey, 1); err != nil {
+			return 0, err
+		}
+	}
+	if err := addCounter(meta, candidatesKey, uint64(n)); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
+
+func counter(b *bbolt.Bucket, key []byte) uint64 {
+	v := b.Get(key)
+	if len(v) != 8 {
+		return 0
+	}
+
+	return binary.BigEndian.Uint64(v)
+}
+
+func addCounter(b *bbolt.Bucket, key []byte, n uint64) error {
+	var v [8]byte
+	binary.BigEndian.PutUint64(v[:], counter(b, key)+n)
+
+	return b.Put(key, v[:])
+}
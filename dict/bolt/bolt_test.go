@@ -0,0 +1,50 @@
+package bolt
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenNotExist(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "SKK-JISYO.bolt")
+
+	if _, err := Open(name); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open() error = %v, want %v", err, fs.ErrNotExist)
+	}
+	if _, err := os.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open() created %s", name)
+	}
+}
+
+func TestCreate(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "SKK-JISYO.bolt")
+
+	d, err := Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.AddEntry("かんじ", "漢字", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err = Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	candidates, err := d.Search(context.Background(), "かんじ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 1 || candidates[0].Text() != "漢字" {
+		t.Errorf("Search() = %v", candidates)
+	}
+}
@@ -0,0 +1,17 @@
+module github.com/kechako/goskkserv/dict/bolt
+
+go 1.22
+
+require (
+	github.com/kechako/goskkserv v0.0.0
+	go.etcd.io/bbolt v1.3.9
+)
+
+require (
+	github.com/fsnotify/fsnotify v1.9.0 // indirect
+	github.com/ulikunitz/xz v0.5.15 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/text v0.3.3 // indirect
+)
+
+replace github.com/kechako/goskkserv => ../../
@@ -0,0 +1,55 @@
+// Package bundled provides the dictionaries embedded in the binary, so a
+// self-contained server can be distributed with its dictionaries baked in.
+//
+// Put the SKK-JISYO files into the dicts directory of this package, and
+// build with the tag bundled:
+//
+//	$ cp SKK-JISYO.L SKK-JISYO.jargon dict/bundled/dicts/
+//	$ go build -tags bundled ./...
+//
+// Without the tag, there are no bundled dictionaries.
+package bundled
+
+import (
+	"io/fs"
+
+	"github.com/kechako/goskkserv/dict"
+)
+
+// readme is the file in dicts that is not a dictionary.
+const readme = "README.txt"
+
+// FS holds the bundled dictionaries, or is nil without the tag bundled.
+var FS fs.FS
+
+// Names returns the names of the bundled dictionaries in FS in sorted
+// order.
+func Names() []string {
+	if FS == nil {
+		return nil
+	}
+
+	entries, err := fs.ReadDir(FS, ".")
+	if err != nil {
+		return nil
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && e.Name() != readme {
+			names = append(names, e.Name())
+		}
+	}
+
+	return names
+}
+
+// Load loads all the bundled dictionaries into a new Dictionary.
+func Load() (*dict.Dictionary, error) {
+	names := Names()
+	if len(names) == 0 {
+		return &dict.Dictionary{}, nil
+	}
+
+	return dict.LoadFS(FS, names...)
+}
@@ -0,0 +1,15 @@
+//go:build bundled
+
+package bundled
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed dicts
+var embedded embed.FS
+
+func init() {
+	FS, _ = fs.Sub(embedded, "dicts")
+}
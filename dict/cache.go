@@ -0,0 +1,178 @@
+package dict
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache is a Searcher that keeps the results of the recent searches of
+// another Searcher, for slow Searchers such as remote ones.
+type Cache struct {
+	searcher    Searcher
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	mu    sync.Mutex
+	lru   *list.List
+	items map[string]*list.Element
+	stats CacheStats
+}
+
+// CacheStats counts the searches of a Cache.
+type CacheStats struct {
+	// Hits is the number of the searches answered by the cache, and
+	// NegativeHits those of them answered that the key is not found.
+	Hits         int
+	NegativeHits int
+	// Misses is the number of the searches passed to the Searcher.
+	Misses int
+}
+
+type cacheItem struct {
+	key        string
+	candidates []Candidate
+	expires    time.Time
+}
+
+var _ Searcher = (*Cache)(nil)
+
+type CacheOption func(*Cache)
+
+// CacheTTL makes a Cache search again the keys whose results are older
+// than ttl, so changes of the Searcher are seen in time. Zero means the
+// results are kept until they are evicted.
+func CacheTTL(ttl time.Duration) CacheOption {
+	return func(c *Cache) {
+		c.ttl = ttl
+	}
+}
+
+// CacheNegativeTTL makes a Cache keep the results of the keys not found
+// for ttl, so searching unusual keys again does not reach the Searcher.
+// ttl should be short, as the keys may be added to the Searcher. Zero,
+// the default, means such results are not kept.
+func CacheNegativeTTL(ttl time.Duration) CacheOption {
+	return func(c *Cache) {
+		c.negativeTTL = ttl
+	}
+}
+
+// NewCache returns a Cache of s keeping the results of up to size keys.
+func NewCache(s Searcher, size int, opts ...CacheOption) *Cache {
+	c := &Cache{
+		searcher: s,
+		size:     size,
+		lru:      list.New(),
+		items:    make(map[string]*list.Element),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+func (c *Cache) Search(ctx context.Context, key string) ([]Candidate, error) {
+	if candidates, ok := c.get(key); ok {
+		return candidates, nil
+	}
+
+	candidates, err := c.searcher.Search(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(candidates) > 0 {
+		c.put(key, candidates, c.ttl)
+	} else if c.negativeTTL > 0 {
+		c.put(key, nil, c.negativeTTL)
+	}
+
+	return candidates, nil
+}
+
+// CacheStats returns the counts of the searches since c is made.
+func (c *Cache) CacheStats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.stats
+}
+
+func (c *Cache) Complete(ctx context.Context, prefix string) ([]string, error) {
+	return c.searcher.Complete(ctx, prefix)
+}
+
+func (c *Cache) Stats() Stats {
+	return c.searcher.Stats()
+}
+
+// Purge removes all the cached results.
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lru.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+func (c *Cache) get(key string) ([]Candidate, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	item := e.Value.(*cacheItem)
+	if !item.expires.IsZero() && time.Now().After(item.expires) {
+		c.lru.Remove(e)
+		delete(c.items, key)
+		c.stats.Misses++
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+
+	c.stats.Hits++
+	if len(item.candidates) == 0 {
+		c.stats.NegativeHits++
+		return nil, true
+	}
+
+	// do not let the callers append to the cached slice
+	candidates := item.candidates
+	return candidates[:len(candidates):len(candidates)], true
+}
+
+// put caches candidates of key for ttl, or until evicted if ttl is zero.
+func (c *Cache) put(key string, candidates []Candidate, ttl time.Duration) {
+	if c.size <= 0 {
+		return
+	}
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		item := e.Value.(*cacheItem)
+		item.candidates = candidates
+		item.expires = expires
+		c.lru.MoveToFront(e)
+		return
+	}
+
+	c.items[key] = c.lru.PushFront(&cacheItem{key: key, candidates: candidates, expires: expires})
+	for c.lru.Len() > c.size {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		delete(c.items, e.Value.(*cacheItem).key)
+	}
+}
@@ -0,0 +1,223 @@
+// Package cdb provides a read-only dictionary backend stored in a constant
+// database (CDB) file. A CDB file is looked up without loading it into
+// memory, so huge dictionaries are served with almost no startup time.
+package cdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const headerSize = 256 * 8
+
+var errTooLarge = errors.New("cdb: database exceeds 4GB")
+
+func hash(key []byte) uint32 {
+	h := uint32(5381)
+	for _, c := range key {
+		h = ((h << 5) + h) ^ uint32(c)
+	}
+
+	return h
+}
+
+type slot struct {
+	hash uint32
+	pos  uint32
+}
+
+// Writer writes a CDB file.
+type Writer struct {
+	ws     io.WriteSeeker
+	w      *bufio.Writer
+	pos    uint32
+	tables [256][]slot
+}
+
+// NewWriter returns a Writer writing a CDB file to ws, which must be
+// positioned at the start of the file.
+func NewWriter(ws io.WriteSeeker) (*Writer, error) {
+	w := &Writer{
+		ws:  ws,
+		w:   bufio.NewWriter(ws),
+		pos: headerSize,
+	}
+
+	// the header is filled in by Close
+	if _, err := w.w.Write(make([]byte, headerSize)); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Put adds a record of key and value.
+func (w *Writer) Put(key, value []byte) error {
+	n := uint64(len(key)) + uint64(len(value)) + 8
+	if uint64(w.pos)+n > math.MaxUint32 {
+		return errTooLarge
+	}
+
+	var buf [8]byte
+	binary.LittleEndian.PutUint32(buf[:4], uint32(len(key)))
+	binary.LittleEndian.PutUint32(buf[4:], uint32(len(value)))
+	w.w.Write(buf[:])
+	w.w.Write(key)
+	if _, err := w.w.Write(value); err != nil {
+		return err
+	}
+
+	h := hash(key)
+	w.tables[h&0xff] = append(w.tables[h&0xff], slot{hash: h, pos: w.pos})
+	w.pos += uint32(n)
+
+	return nil
+}
+
+// Close writes the hash tables and the header. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	var header [headerSize]byte
+	var buf [8]byte
+	for i, table := range w.tables {
+		n := len(table) * 2
+		if uint64(w.pos)+uint64(n)*8 > math.MaxUint32 {
+			return errTooLarge
+		}
+		binary.LittleEndian.PutUint32(header[i*8:], w.pos)
+		binary.LittleEndian.PutUint32(header[i*8+4:], uint32(n))
+
+		slots := make([]slot, n)
+		for _, s := range table {
+			j := (s.hash >> 8) % uint32(n)
+			for slots[j].pos != 0 {
+				j = (j + 1) % uint32(n)
+			}
+			slots[j] = s
+		}
+		for _, s := range slots {
+			binary.LittleEndian.PutUint32(buf[:4], s.hash)
+			binary.LittleEndian.PutUint32(buf[4:], s.pos)
+			if _, err := w.w.Write(buf[:]); err != nil {
+				return err
+			}
+		}
+		w.pos += uint32(n) * 8
+	}
+
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	if _, err := w.ws.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := w.ws.Write(header[:]); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Reader looks up records in a CDB file.
+type Reader struct {
+	r      io.ReaderAt
+	header [256]struct{ pos, n uint32 }
+}
+
+func NewReader(r io.ReaderAt) (*Reader, error) {
+	var header [headerSize]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return nil, fmt.Errorf("failed to read cdb header: %w", err)
+	}
+
+	cr := &Reader{r: r}
+	for i := range cr.header {
+		cr.header[i].pos = binary.LittleEndian.Uint32(header[i*8:])
+		cr.header[i].n = binary.LittleEndian.Uint32(header[i*8+4:])
+	}
+
+	return cr, nil
+}
+
+// Get returns the value of the first record of key, or nil if there is no
+// record of key.
+func (r *Reader) Get(key []byte) ([]byte, error) {
+	h := hash(key)
+	table := r.header[h&0xff]
+	if table.n == 0 {
+		return nil, nil
+	}
+
+	var buf [8]byte
+	start := (h >> 8) % table.n
+	for i := uint32(0); i < table.n; i++ {
+		off := int64(table.pos) + int64((start+i)%table.n)*8
+		if _, err := r.r.ReadAt(buf[:], off); err != nil {
+			return nil, err
+		}
+		pos := binary.LittleEndian.Uint32(buf[4:])
+		if pos == 0 {
+			return nil, nil
+		}
+		if binary.LittleEndian.Uint32(buf[:4]) != h {
+			continue
+		}
+
+		k, v, err := r.record(pos)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(k, key) {
+			return v, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// ForEach calls fn with the key and the value of each record, in the order
+// they were written, until fn returns false.
+func (r *Reader) ForEach(fn func(key, value []byte) bool) error {
+	// the records end where the first hash table starts
+	end := uint32(math.MaxUint32)
+	for _, t := range r.header {
+		if t.pos < end {
+			end = t.pos
+		}
+	}
+
+	pos := uint32(headerSize)
+	for pos < end {
+		k, v, err := r.record(pos)
+		if err != nil {
+			return err
+		}
+		if !fn(k, v) {
+			return nil
+		}
+		pos += uint32(len(k)+len(v)) + 8
+	}
+
+	return nil
+}
+
+func (r *Reader) record(pos uint32) (key, value []byte, err error) {
+	var buf [8]byte
+	if _, err := r.r.ReadAt(buf[:], int64(pos)); err != nil {
+		return nil, nil, err
+	}
+	klen := binary.LittleEndian.Uint32(buf[:4])
+	vlen := binary.LittleEndian.Uint32(buf[4:])
+
+	data := make([]byte, int(klen)+int(vlen))
+	if _, err := r.r.ReadAt(data, int64(pos)+8); err != nil {
+		return nil, nil, err
+	}
+
+	return data[:klen], data[klen:], nil
+}
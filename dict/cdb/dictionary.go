@@ -0,0 +1,183 @@
+package cdb
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kechako/goskkserv/dict"
+)
+
+// statsKey is the key of the record holding the Stats of the dictionary.
+// It never clashes with the keys of entries, which have no spaces.
+const statsKey = " stats"
+
+func init() {
+	dict.RegisterFormat(".cdb", func(name string) (dict.Searcher, error) {
+		return Open(name)
+	})
+}
+
+// Dictionary is a dictionary stored in a CDB file. A record maps a key to
+// its candidates in the form "/cand1/cand2/" in UTF-8.
+type Dictionary struct {
+	f     *os.File
+	r     *Reader
+	stats dict.Stats
+}
+
+var _ dict.Searcher = (*Dictionary)(nil)
+
+func Open(name string) (*Dictionary, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dictionary file %s: %w", name, err)
+	}
+
+	r, err := NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read dictionary %s: %w", name, err)
+	}
+
+	d := &Dictionary{
+		f: f,
+		r: r,
+	}
+
+	v, err := r.Get([]byte(statsKey))
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read dictionary %s: %w", name, err)
+	}
+	if keys, cands, ok := strings.Cut(string(v), " "); ok {
+		d.stats.Keys, _ = strconv.Atoi(keys)
+		d.stats.Candidates, _ = strconv.Atoi(cands)
+	}
+
+	return d, nil
+}
+
+func (d *Dictionary) Search(ctx context.Context, key string) ([]dict.Candidate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	v, err := d.r.Get([]byte(key))
+	if err != nil {
+		return nil, err
+	}
+
+	return dict.ParseCandidates(string(v)), nil
+}
+
+// WriteCandidates writes the candidates of key in the form "/cand1/cand2/"
+// to w, as stored in the file. It reports whether key is found.
+func (d *Dictionary) WriteCandidates(w io.Writer, key string) (bool, error) {
+	v, err := d.r.Get([]byte(key))
+	if err != nil || len(v) == 0 {
+		return false, err
+	}
+
+	if _, err := w.Write(v); err != nil {
+		return true, err
+	}
+
+	return true, nil
+}
+
+// Complete returns the keys starting with prefix in sorted order. As a CDB
+// file has no index of keys, it scans the whole file.
+func (d *Dictionary) Complete(ctx context.Context, prefix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if prefix == "" {
+		return nil, nil
+	}
+
+	var keys []string
+	p := []byte(prefix)
+	err := d.r.ForEach(func(key, value []byte) bool {
+		if len(key) >= len(p) && string(key[:len(p)]) == prefix {
+			keys = append(keys, string(key))
+		}
+		return ctx.Err() == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+func (d *Dictionary) Stats() dict.Stats {
+	return d.stats
+}
+
+func (d *Dictionary) Close() error {
+	return d.f.Close()
+}
+
+// Build writes the entries of src to the CDB file name. The file is
+// written to a temporary file first and renamed, so a server using the
+// old file is not disturbed.
+func Build(name string, src *dict.Dictionary) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create dictionary file %s: %w", name, err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err := write(tmp, src); err != nil {
+		return fmt.Errorf("failed to write dictionary file %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write dictionary file %s: %w", name, err)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("failed to write dictionary file %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func write(ws io.WriteSeeker, src *dict.Dictionary) error {
+	w, err := NewWriter(ws)
+	if err != nil {
+		return err
+	}
+
+	var buf strings.Builder
+	for _, key := range src.Keys() {
+		buf.Reset()
+		if _, err := src.WriteCandidates(&buf, key); err != nil {
+			return err
+		}
+		if err := w.Put([]byte(key), []byte(buf.String())); err != nil {
+			return err
+		}
+	}
+
+	stats := src.Stats()
+	v := strconv.Itoa(stats.Keys) + " " + strconv.Itoa(stats.Candidates)
+	if err := w.Put([]byte(statsKey), []byte(v)); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
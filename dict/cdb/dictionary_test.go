@@ -0,0 +1,51 @@
+package cdb
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kechako/goskkserv/dict"
+)
+
+func TestBuildOkuriBlocks(t *testing.T) {
+	src, err := dict.Load(strings.NewReader(";; okuri-ari entries.\nおくr /送/贈/[る/送/]/[れ/贈/]/\n"), dict.Encoding("utf-8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "SKK-JISYO.cdb")
+	if err := Build(name, src); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	candidates, err := d.Search(context.Background(), "おくr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	texts := make([]string, len(candidates))
+	for i, c := range candidates {
+		texts[i] = c.Text()
+	}
+	if got, want := strings.Join(texts, "/"), "送/贈"; got != want {
+		t.Errorf("Search() = %q, want %q", got, want)
+	}
+
+	var buf bytes.Buffer
+	if _, err := d.WriteCandidates(&buf, "おくr"); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.String(), "/送/贈/"; got != want {
+		t.Errorf("WriteCandidates() = %q, want %q", got, want)
+	}
+	if got := d.Stats().Candidates; got != 2 {
+		t.Errorf("Stats().Candidates = %d, want 2", got)
+	}
+}
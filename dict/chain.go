@@ -0,0 +1,113 @@
+package dict
+
+import "context"
+
+// Chain is a Searcher that searches the Searchers in order, and merges
+// their candidates deduplicated by text. Candidates of earlier Searchers
+// come first, and a duplicate keeps the annotation of the earliest
+// Searcher that has one, unless the Chain is made by WithMerge.
+type Chain []Searcher
+
+var _ Searcher = Chain(nil)
+
+func (c Chain) Search(ctx context.Context, key string) ([]Candidate, error) {
+	return c.search(ctx, key, KeepFirst)
+}
+
+// WithMerge returns a Searcher searching as c, which merges the annotations
+// of a duplicate candidate by m.
+func (c Chain) WithMerge(m AnnotationMerge) Searcher {
+	return &mergeChain{Chain: c, merge: m}
+}
+
+type mergeChain struct {
+	Chain
+	merge AnnotationMerge
+}
+
+func (c *mergeChain) Search(ctx context.Context, key string) ([]Candidate, error) {
+	return c.search(ctx, key, c.merge)
+}
+
+func (c Chain) search(ctx context.Context, key string, m AnnotationMerge) ([]Candidate, error) {
+	var candidates []Candidate
+	var seen map[string]int
+	owned := false
+	for _, s := range c {
+		found, err := s.Search(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			continue
+		}
+
+		if candidates == nil {
+			// do not append to the slice owned by s
+			candidates = found[:len(found):len(found)]
+			continue
+		}
+		if seen == nil {
+			seen = make(map[string]int, len(candidates)+len(found))
+			for i, cand := range candidates {
+				seen[cand.Text()] = i
+			}
+		}
+		for _, cand := range found {
+			if i, ok := seen[cand.Text()]; ok {
+				if merged, ok := mergeAnnotation(m, candidates[i], cand.Annotation()); ok {
+					if !owned {
+						candidates = append([]Candidate(nil), candidates...)
+						owned = true
+					}
+					candidates[i] = &candidate{
+						text:       cand.Text(),
+						annotation: merged,
+						source:     candidates[i].Source(),
+					}
+				}
+				continue
+			}
+			seen[cand.Text()] = len(candidates)
+			candidates = append(candidates, cand)
+			owned = true
+		}
+	}
+
+	return candidates, nil
+}
+
+// Complete returns the keys starting with prefix of all the Searchers,
+// deduplicated, in order.
+func (c Chain) Complete(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	seen := make(map[string]struct{})
+	for _, s := range c {
+		found, err := s.Complete(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range found {
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+// Stats returns the sum of the Stats of the Searchers. Keys and candidates
+// found in more than one Searcher are counted for each.
+func (c Chain) Stats() Stats {
+	var stats Stats
+	for _, s := range c {
+		st := s.Stats()
+		stats.Keys += st.Keys
+		stats.Candidates += st.Candidates
+	}
+
+	return stats
+}
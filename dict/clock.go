@@ -0,0 +1,127 @@
+package dict
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Clock is a Searcher of the current date and time, which are generated at
+// each search instead of stored, as the Lisp entries of SKK do on the
+// clients. It is meant to be chained after the dictionaries:
+//
+//	today, きょう  the date, such as "2026-10-17" and "令和8年10月17日"
+//	now, いま      the time, such as "15:04" and "15時04分"
+type Clock struct {
+	now func() time.Time
+}
+
+var _ Searcher = (*Clock)(nil)
+
+// NewClock returns a Clock of the local time.
+func NewClock() *Clock {
+	return &Clock{now: time.Now}
+}
+
+// clockKeys are the keys of Clock, with the formats of their candidates.
+var clockKeys = map[string]func(t time.Time) []string{
+	"today": dateCandidates,
+	"きょう":   dateCandidates,
+	"now":   timeCandidates,
+	"いま":    timeCandidates,
+}
+
+func (c *Clock) Search(ctx context.Context, key string) ([]Candidate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	format, ok := clockKeys[key]
+	if !ok {
+		return nil, nil
+	}
+	var candidates []Candidate
+	for _, text := range format(c.now()) {
+		candidates = append(candidates, &candidate{text: text})
+	}
+
+	return candidates, nil
+}
+
+func (c *Clock) Complete(ctx context.Context, prefix string) ([]string, error) {
+	if prefix == "" {
+		return nil, nil
+	}
+
+	var keys []string
+	for key := range clockKeys {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+func (c *Clock) Stats() Stats {
+	return Stats{}
+}
+
+var weekdays = [...]string{"日", "月", "火", "水", "木", "金", "土"}
+
+func dateCandidates(t time.Time) []string {
+	candidates := []string{
+		t.Format("2006-01-02"),
+		t.Format("2006/01/02"),
+		fmt.Sprintf("%d年%d月%d日", t.Year(), t.Month(), t.Day()),
+		fmt.Sprintf("%d年%d月%d日(%s)", t.Year(), t.Month(), t.Day(), weekdays[t.Weekday()]),
+	}
+	if era, year, ok := japaneseEra(t); ok {
+		candidates = append(candidates, fmt.Sprintf("%s%s年%d月%d日", era, eraYear(year), t.Month(), t.Day()))
+	}
+
+	return candidates
+}
+
+func timeCandidates(t time.Time) []string {
+	return []string{
+		t.Format("15:04"),
+		t.Format("15:04:05"),
+		fmt.Sprintf("%d時%02d分", t.Hour(), t.Minute()),
+	}
+}
+
+// eras are the Japanese eras, the latest first.
+var eras = []struct {
+	name  string
+	start time.Time
+}{
+	{"令和", time.Date(2019, time.May, 1, 0, 0, 0, 0, time.UTC)},
+	{"平成", time.Date(1989, time.January, 8, 0, 0, 0, 0, time.UTC)},
+	{"昭和", time.Date(1926, time.December, 25, 0, 0, 0, 0, time.UTC)},
+}
+
+// japaneseEra returns the Japanese era of the date of t, and the year in
+// the era.
+func japaneseEra(t time.Time) (string, int, bool) {
+	date := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	for _, e := range eras {
+		if !date.Before(e.start) {
+			return e.name, t.Year() - e.start.Year() + 1, true
+		}
+	}
+
+	return "", 0, false
+}
+
+// eraYear returns the year in an era, where the first year is "元".
+func eraYear(year int) string {
+	if year == 1 {
+		return "元"
+	}
+
+	return fmt.Sprint(year)
+}
@@ -0,0 +1,285 @@
+// Package compressed provides a read-only dictionary that keeps the
+// candidates compressed with zstd in memory, for hosts with little memory.
+// The candidates of consecutive keys are compressed together in blocks, and
+// the recently used blocks are kept decompressed.
+package compressed
+
+import (
+	"container/list"
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kechako/goskkserv/dict"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	DefaultBlockSize = 16 << 10
+	DefaultCacheSize = 64
+)
+
+type Option func(*options)
+
+type options struct {
+	blockSize int
+	cacheSize int
+}
+
+// WithBlockSize sets the size of the candidates compressed together. Larger
+// blocks compress better, but take longer to decompress.
+func WithBlockSize(size int) Option {
+	return func(o *options) {
+		o.blockSize = size
+	}
+}
+
+// WithCacheSize sets the number of the decompressed blocks to keep.
+func WithCacheSize(size int) Option {
+	return func(o *options) {
+		o.cacheSize = size
+	}
+}
+
+// Dictionary is a read-only dictionary with compressed candidates.
+type Dictionary struct {
+	// the i-th key is keys[keyOffsets[i]:keyOffsets[i+1]], in sorted order
+	keys       string
+	keyOffsets []uint32
+
+	// the candidates of the i-th key in the form "/cand1/cand2/" are at
+	// offsets[i] to offsets[i+1] of the concatenated candidates, which are
+	// split into blocks at blockOffsets
+	offsets      []uint32
+	blockOffsets []uint32
+	blocks       [][]byte
+
+	decoder *zstd.Decoder
+	stats   dict.Stats
+
+	cacheSize int
+	mu        sync.Mutex
+	lru       *list.List
+	cached    map[int]*list.Element
+}
+
+type cacheItem struct {
+	block int
+	data  []byte
+}
+
+var _ dict.Searcher = (*Dictionary)(nil)
+
+// Build builds a Dictionary of all the entries of src.
+func Build(src *dict.Dictionary, opts ...Option) (*Dictionary, error) {
+	o := &options{
+		blockSize: DefaultBlockSize,
+		cacheSize: DefaultCacheSize,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	if err != nil {
+		return nil, err
+	}
+	defer encoder.Close()
+
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := src.Keys()
+	d := &Dictionary{
+		keyOffsets: make([]uint32, 0, len(keys)+1),
+		offsets:    make([]uint32, 0, len(keys)+1),
+		decoder:    decoder,
+		stats:      src.Stats(),
+		cacheSize:  o.cacheSize,
+		lru:        list.New(),
+		cached:     make(map[int]*list.Element),
+	}
+
+	var names strings.Builder
+	var block []byte
+	var total uint32
+	flush := func() {
+		d.blockOffsets = append(d.blockOffsets, total)
+		d.blocks = append(d.blocks, encoder.EncodeAll(block, nil))
+		total += uint32(len(block))
+		block = block[:0]
+	}
+	buf := &appendWriter{}
+	for _, key := range keys {
+		d.keyOffsets = append(d.keyOffsets, uint32(names.Len()))
+		names.WriteString(key)
+
+		buf.b = buf.b[:0]
+		src.WriteCandidates(buf, key)
+
+		// a block ends at a key, so the candidates are in one block
+		if len(block) > 0 && len(block)+len(buf.b) > o.blockSize {
+			flush()
+		}
+		d.offsets = append(d.offsets, total+uint32(len(block)))
+		block = append(block, buf.b...)
+	}
+	if len(block) > 0 {
+		flush()
+	}
+	d.keyOffsets = append(d.keyOffsets, uint32(names.Len()))
+	d.offsets = append(d.offsets, total)
+	d.blockOffsets = append(d.blockOffsets, total)
+	d.keys = names.String()
+
+	return d, nil
+}
+
+type appendWriter struct {
+	b []byte
+}
+
+func (w *appendWriter) Write(p []byte) (int, error) {
+	w.b = append(w.b, p...)
+	return len(p), nil
+}
+
+func (d *Dictionary) key(i int) string {
+	return d.keys[d.keyOffsets[i]:d.keyOffsets[i+1]]
+}
+
+func (d *Dictionary) len() int {
+	return len(d.keyOffsets) - 1
+}
+
+// find returns the index of the first key that is not less than key.
+func (d *Dictionary) find(key string) int {
+	return sort.Search(d.len(), func(i int) bool {
+		return d.key(i) >= key
+	})
+}
+
+func (d *Dictionary) candidates(key string) ([]byte, error) {
+	i := d.find(key)
+	if i >= d.len() || d.key(i) != key {
+		return nil, nil
+	}
+
+	start, end := d.offsets[i], d.offsets[i+1]
+	b := sort.Search(len(d.blocks), func(b int) bool {
+		return d.blockOffsets[b+1] > start
+	})
+	data, err := d.block(b)
+	if err != nil {
+		return nil, err
+	}
+	base := d.blockOffsets[b]
+
+	return data[start-base : end-base], nil
+}
+
+// block returns the decompressed block b.
+func (d *Dictionary) block(b int) ([]byte, error) {
+	d.mu.Lock()
+	if e, ok := d.cached[b]; ok {
+		d.lru.MoveToFront(e)
+		d.mu.Unlock()
+		return e.Value.(*cacheItem).data, nil
+	}
+	d.mu.Unlock()
+
+	size := d.blockOffsets[b+1] - d.blockOffsets[b]
+	data, err := d.decoder.DecodeAll(d.blocks[b], make([]byte, 0, size))
+	if err != nil {
+		return nil, err
+	}
+
+	d.put(b, data)
+
+	return data, nil
+}
+
+func (d *Dictionary) put(b int, data []byte) {
+	if d.cacheSize <= 0 {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.cached[b]; ok {
+		return
+	}
+
+	d.cached[b] = d.lru.PushFront(&cacheItem{block: b, data: data})
+	for d.lru.Len() > d.cacheSize {
+		e := d.lru.Back()
+		d.lru.Remove(e)
+		delete(d.cached, e.Value.(*cacheItem).block)
+	}
+}
+
+func (d *Dictionary) Search(ctx context.Context, key string) ([]dict.Candidate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	candidates, err := d.candidates(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return dict.ParseCandidates(string(candidates)), nil
+}
+
+// WriteCandidates writes the candidates of key in the form "/cand1/cand2/"
+// to w. It reports whether key is found.
+func (d *Dictionary) WriteCandidates(w io.Writer, key string) (bool, error) {
+	candidates, err := d.candidates(key)
+	if err != nil || len(candidates) == 0 {
+		return false, err
+	}
+
+	if _, err := w.Write(candidates); err != nil {
+		return true, err
+	}
+
+	return true, nil
+}
+
+// Complete returns the keys starting with prefix in sorted order.
+func (d *Dictionary) Complete(ctx context.Context, prefix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if prefix == "" {
+		return nil, nil
+	}
+
+	var keys []string
+	for i := d.find(prefix); i < d.len(); i++ {
+		key := d.key(i)
+		if !strings.HasPrefix(key, prefix) {
+			break
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func (d *Dictionary) Stats() dict.Stats {
+	return d.stats
+}
+
+// Close releases the resources of the decoder. The Dictionary must not be
+// used after that.
+func (d *Dictionary) Close() error {
+	d.decoder.Close()
+
+	return nil
+}
@@ -0,0 +1,54 @@
+package dict
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"io"
+
+	"github.com/ulikunitz/xz"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	xzMagic    = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+var errCompressed = errors.New("compressed dictionary is not supported")
+
+// decompress returns a reader of r decompressed, if r is compressed by gzip,
+// bzip2 or xz, which is detected by the magic bytes.
+func decompress(r *bufio.Reader) (*bufio.Reader, error) {
+	magic, _ := r.Peek(len(xzMagic))
+
+	var zr io.Reader
+	var err error
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err = gzip.NewReader(r)
+	case bytes.HasPrefix(magic, bzip2Magic):
+		zr = bzip2.NewReader(r)
+	case bytes.HasPrefix(magic, xzMagic):
+		zr, err = xz.NewReader(r)
+	default:
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return bufio.NewReader(zr), nil
+}
+
+// isCompressed reports whether r is compressed in a format decompress
+// detects.
+func isCompressed(r *bufio.Reader) bool {
+	magic, _ := r.Peek(len(xzMagic))
+
+	return bytes.HasPrefix(magic, gzipMagic) ||
+		bytes.HasPrefix(magic, bzip2Magic) ||
+		bytes.HasPrefix(magic, xzMagic)
+}
@@ -2,129 +2,411 @@ package dict
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
-	"regexp"
+	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 
-	"golang.org/x/text/encoding/japanese"
-	"golang.org/x/text/transform"
+	"github.com/kechako/goskkserv/dict/jisyo"
+	"golang.org/x/text/encoding"
 )
 
+// Dictionary is an in-memory dictionary. Searches read an immutable
+// snapshot of the entries without locks, and changes swap in a new
+// snapshot, so they never block searches.
 type Dictionary struct {
-	table map[string]*entry
-	mu    sync.RWMutex
+	snap atomic.Pointer[snapshot]
+
+	// mu serializes the changes
+	mu sync.Mutex
+
+	// onParseError is the onParseError of the builders of d
+	onParseError func(err *ParseError) error
+	// mergeAnnotations is the mergeAnnotations of the builders of d
+	mergeAnnotations AnnotationMerge
+	// order is the order of the candidates loaded from the files
+	order CandidateOrder
+	// normalize normalizes the keys
+	normalize []func(key string) string
+	// normalizeText normalizes the texts and the annotations
+	normalizeText []func(s string) string
+	// emoji is the policy of the emoji candidates
+	emoji EmojiPolicy
+}
+
+// key returns key normalized by the normalize of d.
+func (d *Dictionary) key(key string) string {
+	return normalizeKey(d.normalize, key)
 }
 
-var magicCommentRegex = regexp.MustCompile(`-\*-.*[ \t]coding:[ \t]*([^ \t;]+?)[ \t;].*-\*-`)
+// text returns s normalized by the normalizeText of d.
+func (d *Dictionary) text(s string) string {
+	return normalizeKey(d.normalizeText, s)
+}
+
+func (d *Dictionary) load() *snapshot {
+	if s := d.snap.Load(); s != nil {
+		return s
+	}
+
+	return emptySnapshot
+}
 
 func (d *Dictionary) Add(name string) error {
-	d.mu.Lock()
-	defer d.mu.Unlock()
+	tx := d.Begin()
+	defer tx.Rollback()
 
-	if d.table == nil {
-		d.table = make(map[string]*entry)
+	if err := tx.AddFile(name); err != nil {
+		return err
 	}
 
+	return tx.Commit()
+}
+
+// addFile adds the entries of the named SKK-JISYO file, decoding it from
+// enc if it is not empty.
+func (b *builder) addFile(name, enc string) error {
 	file, err := os.Open(name)
 	if err != nil {
 		return fmt.Errorf("failed to open dictionary file %s: %w", name, err)
 	}
 	defer file.Close()
 
-	r := bufio.NewReader(file)
-	first, err := r.ReadString('\n')
-	if err != nil {
+	b.source = name
+	defer func() { b.source = "" }()
+
+	if err := b.read(file, enc); err != nil {
 		return fmt.Errorf("failed to read dictionary %s: %w", name, err)
 	}
 
-	enc := "euc-jp"
-	matches := magicCommentRegex.FindStringSubmatch(first)
-	if len(matches) > 1 {
-		enc = matches[1]
+	return nil
+}
+
+// addSource adds the entries of the SKK-JISYO file of src, tagging them
+// with src.Tag, and records src among the sources.
+func (b *builder) addSource(src Source) error {
+	b.counts = Stats{}
+	b.tag = src.Tag
+	b.foldCase = src.IgnoreCase
+	defer func() { b.tag, b.foldCase = "", false }()
+
+	if err := b.addFile(src.Name, src.Encoding); err != nil {
+		return err
+	}
+	b.sources = append(b.sources, src)
+
+	return nil
+}
+
+// fsSource is a SKK-JISYO file in a file system, which is read again by
+// Reload.
+type fsSource struct {
+	fsys fs.FS
+	name string
+}
+
+// addFS adds the entries of the named SKK-JISYO file in fsys, and records
+// it among the fsSources.
+func (b *builder) addFS(fsys fs.FS, name string) error {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open dictionary file %s: %w", name, err)
+	}
+	defer file.Close()
+
+	b.source = name
+	defer func() { b.source = "" }()
+
+	if err := b.read(file, ""); err != nil {
+		return fmt.Errorf("failed to read dictionary %s: %w", name, err)
 	}
-	r, err = wrapEncDecoder(r, enc)
+	b.fsSources = append(b.fsSources, fsSource{fsys: fsys, name: name})
+
+	return nil
+}
+
+// read adds the entries of a SKK-JISYO file read from r, which may be
+// compressed by gzip, bzip2 or xz. The file is decoded from enc, or from
+// the encoding in the magic comment of the first line if enc is empty.
+// Malformed entries are skipped.
+func (b *builder) read(r io.Reader, enc string) error {
+	br, err := decompress(bufio.NewReader(r))
 	if err != nil {
 		return err
 	}
 
+	dec := jisyo.NewDecoder(br, jisyo.WithEncoding(enc))
 	for {
-		line, err := r.ReadString('\n')
+		e, err := dec.Next()
 		if err != nil {
 			if errors.Is(err, io.EOF) {
 				break
 			}
-			return fmt.Errorf("failed to read dictionary %s: %w", name, err)
-		}
-		if line[0] == ';' {
+			var serr *jisyo.SyntaxError
+			if !errors.As(err, &serr) {
+				return err
+			}
+			if b.onParseError != nil {
+				if err := b.onParseError(&ParseError{Name: b.source, Line: serr.Line, Reason: serr.Reason}); err != nil {
+					return err
+				}
+			}
 			continue
 		}
+		b.addEntry(e)
+	}
 
-		i := strings.IndexByte(line, ' ')
-		if i < 0 {
-			continue
-		}
-		key := line[:i]
-		candidates := strings.Split(line[i+1:len(line)-1], "/")
+	return nil
+}
 
-		entry := d.table[key]
-		if entry == nil {
-			entry = newEntry()
-			d.table[key] = entry
+// addEntry adds the candidates and the okuri blocks of e read from a file.
+func (b *builder) addEntry(e jisyo.Entry) {
+	key := normalizeKey(b.normalize, e.Key)
+	if b.foldCase {
+		key = strings.ToLower(key)
+		b.entry(key).foldCase = true
+	}
+	b.counts.Keys++
+	b.entry(key).okuri = e.Okuri
+	for _, c := range e.Candidates {
+		b.counts.Candidates++
+		text := b.text(c.Text)
+		b.add(key, text, b.annotation(text, c.Annotation))
+	}
+	for _, ob := range e.Blocks {
+		for _, c := range ob.Candidates {
+			text := b.text(c.Text)
+			b.addOkuri(key, ob.Okuri, text, b.annotation(text, c.Annotation))
 		}
+	}
+}
+
+// LoadResult is the result of loading a dictionary file.
+type LoadResult struct {
+	Source Source
+	// Stats counts the keys and the candidates in the file, including
+	// those also in other files.
+	Stats Stats
+	Err   error
+}
 
-		for _, candidate := range candidates {
-			if candidate == "" {
-				continue
+// addFiles adds the entries of the SKK-JISYO files of sources as addSource
+// of each in order, parsing up to GOMAXPROCS files at a time. Each file is
+// parsed aside and merged only if all of it is read, so a file failing
+// partway adds nothing. It returns the result of each file.
+func (b *builder) addFiles(sources []Source) []LoadResult {
+	results := make([]LoadResult, len(sources))
+	if len(sources) == 1 || runtime.GOMAXPROCS(0) == 1 {
+		for i, src := range sources {
+			part := b.child()
+			err := part.addSource(src)
+			results[i] = LoadResult{Source: src, Stats: part.counts, Err: err}
+			if err == nil {
+				b.merge(part)
 			}
+		}
+		return results
+	}
+
+	parts := make([]*builder, len(sources))
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	var wg sync.WaitGroup
+	for i, src := range sources {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, src Source) {
+			defer wg.Done()
+			defer func() { <-sem }()
 
-			var text string
-			var annotation string
-			ai := strings.IndexByte(candidate, ';')
-			if ai < 0 {
-				text = candidate
-			} else {
-				text = candidate[:ai]
-				annotation = candidate[ai+1:]
+			part := b.child()
+			err := part.addSource(src)
+			results[i] = LoadResult{Source: src, Stats: part.counts, Err: err}
+			if err == nil {
+				parts[i] = part
 			}
-			entry.add(text, annotation)
+		}(i, src)
+	}
+	wg.Wait()
+
+	// merge in the order of sources, so the result does not depend on
+	// which file is parsed first
+	for _, part := range parts {
+		if part != nil {
+			b.merge(part)
 		}
 	}
 
-	return nil
+	return results
+}
+
+// lookupEncoding returns the encoding named in the magic comment of a
+// SKK-JISYO file.
+func lookupEncoding(enc string) (encoding.Encoding, error) {
+	return jisyo.LookupEncoding(enc)
 }
 
-func wrapEncDecoder(r io.Reader, enc string) (*bufio.Reader, error) {
-	var br *bufio.Reader
-	switch enc {
-	case "euc-jp", "euc-jis-2004":
-		br = bufio.NewReader(transform.NewReader(r, japanese.EUCJP.NewDecoder()))
-	case "sjis":
-		br = bufio.NewReader(transform.NewReader(r, japanese.ShiftJIS.NewDecoder()))
-	case "utf-8":
-		br = bufio.NewReader(r)
-	default:
-		return nil, fmt.Errorf("unsupported encoding: %s", enc)
+// Search returns the candidates of key. If key is of an okuri-ari entry
+// followed by its okurigana, such as "おくrる", and there is no entry of
+// key itself, it returns the candidates of the okuri-ari entry, those in
+// the okuri block of the okurigana first.
+func (d *Dictionary) Search(ctx context.Context, key string) ([]Candidate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	return br, nil
+	key = d.key(key)
+	s := d.load()
+	entry := s.get(key)
+	if entry == nil {
+		if entry := s.getFolded(key); entry != nil {
+			return entry.Candidates(), nil
+		}
+		if entry, okuri := s.getOkuri(key); entry != nil {
+			return entry.okuriCandidates(okuri), nil
+		}
+		return nil, nil
+	}
+
+	return entry.Candidates(), nil
 }
 
-func (d *Dictionary) Search(key string) []Candidate {
-	d.mu.RLock()
-	defer d.mu.RUnlock()
+func (d *Dictionary) Stats() Stats {
+	return d.load().stats
+}
 
-	if d.table == nil {
-		return nil
+// WriteCandidates writes the candidates of key in the form "/cand1/cand2/"
+// to w. The form is rendered when the dictionary is loaded, so no
+// allocation is made per request. It reports whether key is found.
+func (d *Dictionary) WriteCandidates(w io.Writer, key string) (bool, error) {
+	key = d.key(key)
+	s := d.load()
+	entry := s.get(key)
+	if entry == nil {
+		entry = s.getFolded(key)
+	}
+	if entry == nil {
+		// the candidates for an okurigana are rendered per request
+		entry, okuri := s.getOkuri(key)
+		if entry == nil || len(entry.candidates) == 0 {
+			return false, nil
+		}
+		payload := []byte{'/'}
+		for _, c := range entry.okuriCandidates(okuri) {
+			payload = appendCandidate(payload, c)
+			payload = append(payload, '/')
+		}
+		if _, err := w.Write(payload); err != nil {
+			return true, err
+		}
+		return true, nil
+	}
+	if len(entry.payload) == 0 {
+		return false, nil
 	}
 
-	entry, ok := d.table[key]
-	if !ok {
-		return nil
+	if _, err := w.Write(entry.payload); err != nil {
+		return true, err
 	}
 
-	return entry.Candidates()
+	return true, nil
+}
+
+// AddEntry adds a candidate of key. It reports whether the candidate is
+// added, that is, key does not have a candidate with the same text yet.
+func (d *Dictionary) AddEntry(key, text, annotation string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key = d.key(key)
+	text = d.text(text)
+	annotation = d.text(annotation)
+	s := d.load()
+	entry := s.get(key)
+	if entry == nil {
+		entry = newEntry(key)
+	} else if entry.has(text) {
+		return false
+	} else {
+		entry = entry.clone()
+	}
+	entry.add(nil, d.mergeAnnotations, text, annotation, "")
+	entry.render(nil)
+
+	d.snap.Store(s.with(key, entry))
+
+	return true
+}
+
+// Entry is a candidate of a key to be added by AddEntries.
+type Entry struct {
+	Key        string
+	Text       string
+	Annotation string
+}
+
+// AddEntries adds the candidates of entries in order at once, as AddEntry
+// of each, so searches see either none or all of them. It returns the
+// number of the candidates added.
+func (d *Dictionary) AddEntries(entries []Entry) int {
+	tx := d.Begin()
+	defer tx.Rollback()
+
+	n := 0
+	for _, e := range entries {
+		if tx.Add(e.Key, e.Text, e.Annotation) {
+			n++
+		}
+	}
+	tx.Commit()
+
+	return n
+}
+
+// promote moves the candidate of text of key to the first, adding it if
+// key does not have it.
+func (d *Dictionary) promote(key, text string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key = d.key(key)
+	text = d.text(text)
+	s := d.load()
+	entry := s.get(key)
+	if entry == nil {
+		entry = newEntry(key)
+	} else if entry.index(text) == 0 {
+		return
+	} else {
+		entry = entry.clone()
+	}
+	i := entry.index(text)
+	if i < 0 {
+		entry.push(newCandidate(nil, text, "", ""))
+		i = len(entry.candidates) - 1
+	}
+	c := entry.candidates[i]
+	copy(entry.candidates[1:i+1], entry.candidates[:i])
+	entry.candidates[0] = c
+	entry.reindex()
+	entry.render(nil)
+
+	d.snap.Store(s.with(key, entry))
+}
+
+// Replace replaces all the entries of d with those of src. src must not be
+// used after that.
+func (d *Dictionary) Replace(src *Dictionary) {
+	src.mu.Lock()
+	s := src.snap.Swap(nil)
+	src.mu.Unlock()
+
+	d.mu.Lock()
+	d.snap.Store(s)
+	d.mu.Unlock()
 }
@@ -0,0 +1,198 @@
+package dict
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding/japanese"
+)
+
+// messyFiles are the SKK-JISYO files in EUC-JP of the same entries, which
+// are formatted in the ways found in the files in the wild.
+var messyFiles = []struct {
+	name string
+	desc string
+}{
+	{"blank.jisyo", "blank lines and lines of spaces"},
+	{"crlf.jisyo", "CRLF line endings"},
+	{"tabs.jisyo", "tabs and spaces around keys and lines"},
+	{"first.jisyo", "an entry on the first line"},
+	{"nonewline.jisyo", "no newline at the end of the file"},
+}
+
+var messyEntries = map[string]string{
+	"かんじ": "漢字/感じ;feeling",
+	"skk": "SKK",
+	"ぎょう": "行/業",
+}
+
+func candidateStrings(candidates []Candidate) string {
+	s := make([]string, len(candidates))
+	for i, c := range candidates {
+		s[i] = c.String()
+	}
+
+	return strings.Join(s, "/")
+}
+
+func TestReadMessy(t *testing.T) {
+	for _, f := range messyFiles {
+		name := filepath.Join("testdata", "messy", f.name)
+
+		d, err := OpenDictionary([]string{name})
+		if err != nil {
+			t.Fatalf("%s: %v", f.desc, err)
+		}
+		disk, err := OpenDisk(name, 4)
+		if err != nil {
+			t.Fatalf("%s: %v", f.desc, err)
+		}
+		defer disk.Close()
+
+		for _, s := range []Searcher{d, disk} {
+			for key, want := range messyEntries {
+				candidates, err := s.Search(context.Background(), key)
+				if err != nil {
+					t.Fatalf("%s: %T: %v", f.desc, s, err)
+				}
+				if got := candidateStrings(candidates); got != want {
+					t.Errorf("%s: %T: Search(%q) = %q, want %q", f.desc, s, key, got, want)
+				}
+			}
+		}
+
+		want := Stats{Keys: len(messyEntries), Candidates: 5}
+		if got := d.Stats(); got != want {
+			t.Errorf("%s: Dictionary.Stats() = %+v, want %+v", f.desc, got, want)
+		}
+		if got := disk.Stats(); got != want {
+			t.Errorf("%s: DiskDictionary.Stats() = %+v, want %+v", f.desc, got, want)
+		}
+	}
+}
+
+// TestOpenDiskISO2022JP reads a file in ISO-2022-JP, where "く" is encoded
+// as 0x24 0x2F and has '/' in it.
+func TestOpenDiskISO2022JP(t *testing.T) {
+	src := ";; -*- coding: iso-2022-jp -*-\n;; okuri-nasi entries.\nかく /各/書く/描く/\nく /九/区/\n"
+	data, err := japanese.ISO2022JP.NewEncoder().Bytes([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(t.TempDir(), "SKK-JISYO.jis")
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := OpenDisk(name, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	candidates, err := d.Search(context.Background(), "かく")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := candidateStrings(candidates), "各/書く/描く"; got != want {
+		t.Errorf("Search() = %q, want %q", got, want)
+	}
+	if got, want := d.Stats(), (Stats{Keys: 2, Candidates: 5}); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
+
+// TestOkuriBlocks checks that the okuri blocks are not taken for candidates
+// by the backends reading the lines of the file.
+func TestOkuriBlocks(t *testing.T) {
+	src := ";; -*- coding: utf-8 -*-\n;; okuri-ari entries.\nおくr /送/贈/[る/送/]/[れ/贈/]/\n"
+	name := filepath.Join(t.TempDir(), "SKK-JISYO.okuri")
+	if err := os.WriteFile(name, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := OpenDisk(name, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	candidates, err := d.Search(context.Background(), "おくr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := candidateStrings(candidates), "送/贈"; got != want {
+		t.Errorf("Search() = %q, want %q", got, want)
+	}
+	if got, want := d.Stats(), (Stats{Keys: 1, Candidates: 2}); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+
+	if got, want := candidateStrings(ParseCandidates("/送/贈/[る/送/]/[れ/贈/]/")), "送/贈"; got != want {
+		t.Errorf("ParseCandidates() = %q, want %q", got, want)
+	}
+}
+
+// TestWriteCandidatesOkuri checks that the response of an okuri-ari entry
+// has the same form for the key and for the key with an okurigana.
+func TestWriteCandidatesOkuri(t *testing.T) {
+	d, err := Load(strings.NewReader(";; okuri-ari entries.\nおくr /送/贈/[る/送/]/[れ/贈/]/\n"), Encoding("utf-8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]string{
+		"おくr":  "/送/贈/",
+		"おくrる": "/送/贈/",
+		"おくrれ": "/贈/送/",
+	} {
+		var buf bytes.Buffer
+		if found, err := d.WriteCandidates(&buf, key); !found || err != nil {
+			t.Fatalf("WriteCandidates(%q) = %v, %v", key, found, err)
+		}
+		if got := buf.String(); got != want {
+			t.Errorf("WriteCandidates(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
+
+// TestOpenSourcesPartialFile checks that a file failing partway adds none
+// of its entries, even if the files are read one by one.
+func TestOpenSourcesPartialFile(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	dir := t.TempDir()
+	good := writeJisyo(t, dir, "good", "かんじ /漢字/")
+
+	var src bytes.Buffer
+	src.WriteString(";; -*- coding: utf-8 -*-\n;; okuri-nasi entries.\nかんじ /感じ/\n")
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(&src, "かな%d /仮名%d/\n", i, i)
+	}
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write(src.Bytes())
+	w.Close()
+	bad := filepath.Join(dir, "bad.gz")
+	if err := os.WriteFile(bad, gz.Bytes()[:gz.Len()/2], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := OpenSources([]Source{{Name: good}, {Name: bad}})
+	if err == nil {
+		t.Error("OpenSources() of a truncated file succeeded")
+	}
+	if got, want := searchTexts(t, d, "かんじ"), "漢字"; got != want {
+		t.Errorf("Search() = %q, want %q", got, want)
+	}
+	if got, want := d.Stats(), (Stats{Keys: 1, Candidates: 1}); got != want {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,299 @@
+package dict
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kechako/goskkserv/dict/jisyo"
+	"golang.org/x/text/encoding"
+)
+
+const diskPageSize = 4096
+
+// DiskDictionary is a read-only dictionary of a SKK-JISYO file that keeps
+// only the sorted keys and the offsets of their lines in memory, and reads
+// the candidates from the file when they are searched. It is for
+// dictionaries too large to load into memory.
+type DiskDictionary struct {
+	file *os.File
+	enc  encoding.Encoding
+
+	// keys holds the keys of all the lines, which are sorted by key
+	keys  string
+	lines []diskLine
+	stats Stats
+
+	// the recently read pages of the file
+	cacheSize int
+	mu        sync.Mutex
+	lru       *list.List
+	pages     map[int64]*list.Element
+}
+
+type diskLine struct {
+	keyStart, keyEnd uint32
+	offset           int64
+	size             uint32
+	okuri            bool
+}
+
+type diskPage struct {
+	n    int64
+	data []byte
+}
+
+var _ Searcher = (*DiskDictionary)(nil)
+
+// OpenDisk indexes the named SKK-JISYO file and returns a DiskDictionary of
+// it, which keeps up to cacheSize pages of the file in memory.
+func OpenDisk(name string, cacheSize int) (*DiskDictionary, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dictionary file %s: %w", name, err)
+	}
+
+	d := &DiskDictionary{
+		file:      file,
+		cacheSize: cacheSize,
+		lru:       list.New(),
+		pages:     make(map[int64]*list.Element),
+	}
+	if err := d.index(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read dictionary %s: %w", name, err)
+	}
+
+	return d, nil
+}
+
+// index reads the whole file and makes the index of the lines.
+func (d *DiskDictionary) index() error {
+	r := bufio.NewReaderSize(d.file, 64<<10)
+	if isCompressed(r) {
+		// the lines cannot be read at their offsets
+		return errCompressed
+	}
+
+	var keys []byte
+	var decoder *encoding.Decoder
+	var offset int64
+	var section string
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if len(line) == 0 {
+			break
+		}
+		size := len(line)
+
+		if d.enc == nil {
+			if d.enc, err = lookupEncoding(jisyo.DetectEncoding(string(line))); err != nil {
+				return err
+			}
+			decoder = d.enc.NewDecoder()
+		}
+
+		// skip CR of CRLF and the spaces around the line, as read does
+		line = bytes.TrimRight(line, " \t\r\n")
+		start := len(line) - len(bytes.TrimLeft(line, " \t"))
+		line = line[start:]
+		// the markers are ASCII in all the encodings
+		if m := string(line); m == jisyo.OkuriAriMarker || m == jisyo.OkuriNasiMarker {
+			section = m
+		}
+		if i := bytes.IndexAny(line, " \t"); i > 0 && line[0] != ';' {
+			key, err := decoder.Bytes(line[:i])
+			if err != nil {
+				return err
+			}
+			j := len(line) - len(bytes.TrimLeft(line[i:], " \t"))
+			okuri := section == jisyo.OkuriAriMarker
+			if section == "" {
+				okuri = jisyo.IsOkuriAri(string(key))
+			}
+
+			d.lines = append(d.lines, diskLine{
+				keyStart: uint32(len(keys)),
+				keyEnd:   uint32(len(keys) + len(key)),
+				offset:   offset + int64(start+j),
+				size:     uint32(len(line) - j),
+				okuri:    okuri,
+			})
+			keys = append(keys, key...)
+
+			// '/' can be a part of a character in ISO-2022-JP, such as
+			// "く", so the candidates are counted after decoding
+			text, err := decoder.Bytes(line[j:])
+			if err != nil {
+				return err
+			}
+			d.stats.Candidates += len(jisyo.ParseCandidates(string(text)))
+		}
+		offset += int64(size)
+	}
+
+	d.keys = string(keys)
+	sort.SliceStable(d.lines, func(i, j int) bool {
+		return d.key(i) < d.key(j)
+	})
+	for i := range d.lines {
+		if i == 0 || d.key(i) != d.key(i-1) {
+			d.stats.Keys++
+		}
+	}
+
+	return nil
+}
+
+func (d *DiskDictionary) key(i int) string {
+	return d.keys[d.lines[i].keyStart:d.lines[i].keyEnd]
+}
+
+// find returns the index of the first line whose key is not less than key.
+func (d *DiskDictionary) find(key string) int {
+	return sort.Search(len(d.lines), func(i int) bool {
+		return d.key(i) >= key
+	})
+}
+
+func (d *DiskDictionary) Search(ctx context.Context, key string) ([]Candidate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var candidates []Candidate
+	seen := make(map[string]struct{})
+	for i := d.find(key); i < len(d.lines) && d.key(i) == key; i++ {
+		line, err := d.read(d.lines[i].offset, int(d.lines[i].size))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dictionary %s: %w", d.file.Name(), err)
+		}
+		line, err = d.enc.NewDecoder().Bytes(line)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dictionary %s: %w", d.file.Name(), err)
+		}
+
+		for _, c := range ParseCandidates(string(line)) {
+			if _, ok := seen[c.Text()]; ok {
+				continue
+			}
+			seen[c.Text()] = struct{}{}
+			candidates = append(candidates, c)
+		}
+	}
+
+	return candidates, nil
+}
+
+// Complete returns the keys of the okuri-nasi entries starting with prefix
+// in sorted order.
+func (d *DiskDictionary) Complete(ctx context.Context, prefix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if prefix == "" {
+		return nil, nil
+	}
+
+	var keys []string
+	for i := d.find(prefix); i < len(d.lines); i++ {
+		key := d.key(i)
+		if !strings.HasPrefix(key, prefix) {
+			break
+		}
+		if n := len(keys); d.lines[i].okuri || n > 0 && keys[n-1] == key {
+			continue
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func (d *DiskDictionary) Stats() Stats {
+	return d.stats
+}
+
+// Close closes the file. The DiskDictionary must not be used after that.
+func (d *DiskDictionary) Close() error {
+	return d.file.Close()
+}
+
+// read reads size bytes at offset of the file through the page cache.
+func (d *DiskDictionary) read(offset int64, size int) ([]byte, error) {
+	b := make([]byte, 0, size)
+	for len(b) < size {
+		n := offset / diskPageSize
+		page, err := d.page(n)
+		if err != nil {
+			return nil, err
+		}
+
+		start := int(offset - n*diskPageSize)
+		if start >= len(page) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		end := start + size - len(b)
+		if end > len(page) {
+			end = len(page)
+		}
+		b = append(b, page[start:end]...)
+		offset += int64(end - start)
+	}
+
+	return b, nil
+}
+
+// page returns the n-th page of the file, which is shorter than
+// diskPageSize at the end of the file.
+func (d *DiskDictionary) page(n int64) ([]byte, error) {
+	d.mu.Lock()
+	if e, ok := d.pages[n]; ok {
+		d.lru.MoveToFront(e)
+		d.mu.Unlock()
+		return e.Value.(*diskPage).data, nil
+	}
+	d.mu.Unlock()
+
+	data := make([]byte, diskPageSize)
+	size, err := d.file.ReadAt(data, n*diskPageSize)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	data = data[:size]
+
+	d.put(n, data)
+
+	return data, nil
+}
+
+func (d *DiskDictionary) put(n int64, data []byte) {
+	if d.cacheSize <= 0 {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.pages[n]; ok {
+		return
+	}
+
+	d.pages[n] = d.lru.PushFront(&diskPage{n: n, data: data})
+	for d.lru.Len() > d.cacheSize {
+		e := d.lru.Back()
+		d.lru.Remove(e)
+		delete(d.pages, e.Value.(*diskPage).n)
+	}
+}
@@ -0,0 +1,76 @@
+package dict
+
+import "unicode/utf8"
+
+// EmojiPolicy is how the emoji candidates of the dictionary files, such
+// as of skk-emoji-jisyo, are treated. The policies can be combined by |.
+type EmojiPolicy int
+
+const (
+	// EmojiLast orders the emoji candidates of a key after the others.
+	EmojiLast EmojiPolicy = 1 << iota
+	// StripEmojiAnnotations drops the annotations of the emoji
+	// candidates, such as the names of them.
+	StripEmojiAnnotations
+)
+
+// IsEmoji reports whether text is of emoji only, such as "😀", "👍🏽" or
+// the ZWJ sequence "👨‍👩‍👧".
+func IsEmoji(text string) bool {
+	emoji, keycap := false, false
+	for _, r := range text {
+		switch {
+		case r == utf8.RuneError:
+			return false
+		case isEmojiRune(r):
+			emoji = true
+		case r == 0x20e3: // combining enclosing keycap
+			keycap = true
+		case r == 0x200d, r == 0xfe0e, r == 0xfe0f, r >= 0xe0020 && r <= 0xe007f:
+			// ZWJ, variation selectors and tags
+		case r == '#' || r == '*' || r >= '0' && r <= '9':
+			// keycaps
+		default:
+			return false
+		}
+	}
+
+	return emoji || keycap
+}
+
+func isEmojiRune(r rune) bool {
+	switch {
+	case r >= 0x1f000 && r <= 0x1faff:
+		return true
+	case r >= 0x2600 && r <= 0x27bf, r >= 0x2300 && r <= 0x23ff, r >= 0x2b00 && r <= 0x2bff:
+		return true
+	case r >= 0x2190 && r <= 0x21ff:
+		return true
+	}
+	switch r {
+	case 0xa9, 0xae, 0x203c, 0x2049, 0x2122, 0x2139, 0x24c2, 0x25aa, 0x25ab,
+		0x25b6, 0x25c0, 0x25fb, 0x25fc, 0x25fd, 0x25fe, 0x2934, 0x2935,
+		0x3030, 0x303d, 0x3297, 0x3299:
+		return true
+	}
+
+	return false
+}
+
+// emojiLast moves the emoji candidates of e after the others, keeping the
+// order of each.
+func (e *entry) emojiLast() {
+	var emoji []Candidate
+	others := e.candidates[:0:0]
+	for _, c := range e.candidates {
+		if IsEmoji(c.Text()) {
+			emoji = append(emoji, c)
+		} else {
+			others = append(others, c)
+		}
+	}
+	if len(emoji) == 0 || len(others) == 0 {
+		return
+	}
+	e.candidates = append(others, emoji...)
+}
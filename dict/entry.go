@@ -3,17 +3,23 @@ package dict
 import (
 	"fmt"
 	"strings"
+
+	"github.com/kechako/goskkserv/dict/jisyo"
 )
 
 type Candidate interface {
 	Text() string
 	Annotation() string
+	// Source returns the name of the dictionary the candidate comes from,
+	// or an empty string if it is not known.
+	Source() string
 	fmt.Stringer
 }
 
 type candidate struct {
 	text       string
 	annotation string
+	source     string
 }
 
 var _ Candidate = (*candidate)(nil)
@@ -26,56 +32,404 @@ func (c *candidate) Annotation() string {
 	return c.annotation
 }
 
+func (c *candidate) Source() string {
+	return c.source
+}
+
 func (c *candidate) String() string {
 	if len(c.annotation) == 0 {
-		return c.text
+		return EscapeText(c.text)
 	}
 
-	var s strings.Builder
-	s.Grow(len(c.text) + len(c.annotation) + 2)
+	return string(appendCandidate(make([]byte, 0, len(c.text)+len(c.annotation)+2), c))
+}
 
-	s.WriteString(c.text)
-	s.WriteString("; ")
-	s.WriteString(c.annotation)
+// appendCandidate appends the form of c in the responses to b. The text
+// and the annotation that would break the form are quoted by jisyo.Quote.
+func appendCandidate(b []byte, c Candidate) []byte {
+	b = append(b, EscapeText(c.Text())...)
+	if c.Annotation() != "" {
+		b = append(b, ';')
+		b = append(b, EscapeAnnotation(c.Annotation())...)
+	}
 
-	return s.String()
+	return b
 }
 
+// EscapeText returns text as it is written in the responses and the
+// dictionary files, quoted by jisyo.Quote if it has '/', ';' or a
+// newline.
+func EscapeText(text string) string {
+	if strings.ContainsAny(text, "/;\r\n") {
+		return jisyo.Quote(text)
+	}
+
+	return text
+}
+
+// UnescapeText returns the text escaped by EscapeText or EscapeAnnotation.
+// The other texts, including the Lisp forms other than those of strings,
+// are returned as they are.
+func UnescapeText(s string) string {
+	if !jisyo.IsLisp(s) {
+		return s
+	}
+	text, err := jisyo.Eval(s)
+	if err != nil {
+		return s
+	}
+
+	return text
+}
+
+// EscapeAnnotation is EscapeText of an annotation, which may have ';'.
+func EscapeAnnotation(annotation string) string {
+	if strings.ContainsAny(annotation, "/\r\n") {
+		return jisyo.Quote(annotation)
+	}
+
+	return annotation
+}
+
+// maxCandScan is the number of the candidates of an entry up to which a
+// duplicate is found by scanning them, instead of by a set.
+const maxCandScan = 16
+
 type entry struct {
-	candidates []*candidate
-	candSet    map[string]struct{}
+	candidates []Candidate
+	// candIndex maps the texts to the indexes of the candidates. It is
+	// made when the entry has more than maxCandScan candidates.
+	candIndex map[string]int
+
+	// payload is the pre-rendered "/cand1/cand2/" form of candidates.
+	payload []byte
+
+	// okuri reports whether the entry is okuri-ari
+	okuri bool
+	// foldCase reports whether the key is in lower case of a dictionary
+	// of Source.IgnoreCase
+	foldCase bool
+	// blocks are the okuri blocks of an okuri-ari entry. Their candidates
+	// are also in candidates.
+	blocks []okuriBlock
+}
+
+// okuriBlock is the candidates of an okuri-ari entry for an okurigana,
+// such as "[る/送/]".
+type okuriBlock struct {
+	okuri      string
+	candidates []Candidate
+}
+
+// newEntry returns an entry of key, which is okuri-ari if key looks like
+// one.
+func newEntry(key string) *entry {
+	return &entry{okuri: jisyo.IsOkuriAri(key)}
+}
+
+// clone returns a copy of e that can be changed without changing e.
+func (e *entry) clone() *entry {
+	c := &entry{
+		candidates: make([]Candidate, len(e.candidates), len(e.candidates)+1),
+		okuri:      e.okuri,
+		foldCase:   e.foldCase,
+	}
+	copy(c.candidates, e.candidates)
+	if len(e.blocks) > 0 {
+		c.blocks = make([]okuriBlock, len(e.blocks))
+		for i, ob := range e.blocks {
+			c.blocks[i] = okuriBlock{
+				okuri:      ob.okuri,
+				candidates: append([]Candidate(nil), ob.candidates...),
+			}
+		}
+	}
+	if e.candIndex != nil {
+		c.candIndex = make(map[string]int, len(e.candIndex)+1)
+		for text, i := range e.candIndex {
+			c.candIndex[text] = i
+		}
+	}
+
+	return c
 }
 
-func newEntry() *entry {
-	return &entry{
-		candSet: make(map[string]struct{}),
+// index returns the index of the candidate of text, or -1 if there is no
+// such candidate.
+func (e *entry) index(text string) int {
+	if e.candIndex != nil {
+		if i, ok := e.candIndex[text]; ok {
+			return i
+		}
+		return -1
+	}
+
+	for i, c := range e.candidates {
+		if c.Text() == text {
+			return i
+		}
 	}
+
+	return -1
+}
+
+func (e *entry) has(text string) bool {
+	return e.index(text) >= 0
+}
+
+// add adds a candidate from the dictionary source, allocating it from a if
+// a is not nil. A duplicate candidate is not added, but its annotation is
+// merged into that of the existing candidate by m. It reports whether the
+// candidate is added.
+func (e *entry) add(a *arena, m AnnotationMerge, text, annotation, source string) bool {
+	if i := e.index(text); i >= 0 {
+		if merged, ok := mergeAnnotation(m, e.candidates[i], annotation); ok {
+			e.replace(i, newCandidate(a, text, merged, e.candidates[i].Source()))
+		}
+		return false
+	}
+
+	e.push(newCandidate(a, text, annotation, source))
+
+	return true
 }
 
-func (e *entry) add(text, annotation string) bool {
-	if _, ok := e.candSet[text]; ok {
+// addCandidate adds c as add, sharing c instead of copying it.
+func (e *entry) addCandidate(a *arena, m AnnotationMerge, c Candidate) bool {
+	if i := e.index(c.Text()); i >= 0 {
+		if merged, ok := mergeAnnotation(m, e.candidates[i], c.Annotation()); ok {
+			e.replace(i, newCandidate(a, c.Text(), merged, e.candidates[i].Source()))
+		}
 		return false
 	}
 
-	cand := &candidate{
+	e.push(c)
+
+	return true
+}
+
+// addOkuri adds a candidate for okuri as add, both to the okuri block of
+// okuri and to the candidates.
+func (e *entry) addOkuri(a *arena, m AnnotationMerge, okuri, text, annotation, source string) {
+	e.add(a, m, text, annotation, source)
+	e.block(okuri).put(e.candidates[e.index(text)])
+	e.payload = nil
+}
+
+// addOkuriCandidate adds c for okuri as addOkuri, sharing c instead of
+// copying it.
+func (e *entry) addOkuriCandidate(a *arena, m AnnotationMerge, okuri string, c Candidate) {
+	e.addCandidate(a, m, c)
+	e.block(okuri).put(e.candidates[e.index(c.Text())])
+	e.payload = nil
+}
+
+// reindex updates candIndex and payload after the candidates are
+// reordered.
+func (e *entry) reindex() {
+	if e.candIndex != nil {
+		for i, c := range e.candidates {
+			e.candIndex[c.Text()] = i
+		}
+	}
+	e.payload = nil
+}
+
+// removeText removes the candidate of text, also from the okuri blocks.
+// It reports whether e has the candidate.
+func (e *entry) removeText(text string) bool {
+	i := e.index(text)
+	if i < 0 {
+		return false
+	}
+	e.candidates = append(e.candidates[:i], e.candidates[i+1:]...)
+	if e.candIndex != nil {
+		delete(e.candIndex, text)
+	}
+
+	blocks := e.blocks[:0]
+	for _, ob := range e.blocks {
+		candidates := ob.candidates[:0]
+		for _, c := range ob.candidates {
+			if c.Text() != text {
+				candidates = append(candidates, c)
+			}
+		}
+		if len(candidates) > 0 {
+			ob.candidates = candidates
+			blocks = append(blocks, ob)
+		}
+	}
+	e.blocks = blocks
+	e.reindex()
+
+	return true
+}
+
+// block returns the okuri block of okuri, adding it if there is none.
+func (e *entry) block(okuri string) *okuriBlock {
+	for i := range e.blocks {
+		if e.blocks[i].okuri == okuri {
+			return &e.blocks[i]
+		}
+	}
+	e.blocks = append(e.blocks, okuriBlock{okuri: okuri})
+
+	return &e.blocks[len(e.blocks)-1]
+}
+
+// put adds c to the block, replacing the candidate with the same text.
+func (ob *okuriBlock) put(c Candidate) {
+	for i, bc := range ob.candidates {
+		if bc.Text() == c.Text() {
+			ob.candidates[i] = c
+			return
+		}
+	}
+	ob.candidates = append(ob.candidates, c)
+}
+
+// replace replaces the i-th candidate with c of the same text, in the okuri
+// blocks as well.
+func (e *entry) replace(i int, c Candidate) {
+	e.candidates[i] = c
+	for j := range e.blocks {
+		for k, bc := range e.blocks[j].candidates {
+			if bc.Text() == c.Text() {
+				e.blocks[j].candidates[k] = c
+			}
+		}
+	}
+	e.payload = nil
+}
+
+func newCandidate(a *arena, text, annotation, source string) *candidate {
+	if a != nil {
+		return a.candidate(text, annotation, source)
+	}
+
+	return &candidate{
 		text:       text,
 		annotation: annotation,
+		source:     source,
 	}
-	e.candSet[text] = struct{}{}
-	e.candidates = append(e.candidates, cand)
+}
 
-	return true
+// push appends c, which must not be a duplicate.
+func (e *entry) push(c Candidate) {
+	e.candidates = append(e.candidates, c)
+	e.payload = nil
+
+	if e.candIndex != nil {
+		e.candIndex[c.Text()] = len(e.candidates) - 1
+	} else if len(e.candidates) > maxCandScan {
+		e.candIndex = make(map[string]int, len(e.candidates)*2)
+		for i, c := range e.candidates {
+			e.candIndex[c.Text()] = i
+		}
+	}
 }
 
+// render renders the payload, allocating it from a if a is not nil. The
+// okuri blocks are left out, as the clients take every field for a
+// candidate.
+func (e *entry) render(a *arena) {
+	if e.payload != nil || len(e.candidates) == 0 {
+		return
+	}
+
+	n := 1
+	for _, c := range e.candidates {
+		n += len(c.Text()) + len(c.Annotation()) + 3
+	}
+
+	var payload []byte
+	if a != nil {
+		payload = a.alloc(n)
+	} else {
+		payload = make([]byte, 0, n)
+	}
+	payload = append(payload, '/')
+	for _, c := range e.candidates {
+		payload = appendCandidate(payload, c)
+		payload = append(payload, '/')
+	}
+	e.payload = payload
+}
+
+// Candidates returns the candidates of e without copying. The callers must
+// not change the returned slice; it is capped so appending copies it.
 func (e *entry) Candidates() []Candidate {
 	if len(e.candidates) == 0 {
 		return nil
 	}
 
-	candidates := make([]Candidate, len(e.candidates))
-	for i, c := range e.candidates {
-		candidates[i] = c
+	return e.candidates[:len(e.candidates):len(e.candidates)]
+}
+
+// okuriCandidates returns the candidates of e for okuri, those in the okuri
+// block of okuri first. If there is no such block, it returns all the
+// candidates as Candidates.
+func (e *entry) okuriCandidates(okuri string) []Candidate {
+	var ob *okuriBlock
+	for i := range e.blocks {
+		if e.blocks[i].okuri == okuri {
+			ob = &e.blocks[i]
+			break
+		}
+	}
+	if ob == nil {
+		return e.Candidates()
+	}
+
+	candidates := make([]Candidate, 0, len(e.candidates))
+	candidates = append(candidates, ob.candidates...)
+	for _, c := range e.candidates {
+		if !containsText(ob.candidates, c.Text()) {
+			candidates = append(candidates, c)
+		}
+	}
+
+	return candidates
+}
+
+func containsText(candidates []Candidate, text string) bool {
+	for _, c := range candidates {
+		if c.Text() == text {
+			return true
+		}
+	}
+
+	return false
+}
+
+func NewCandidate(text, annotation string) Candidate {
+	return &candidate{
+		text:       text,
+		annotation: annotation,
+	}
+}
+
+// NewSourceCandidate returns a candidate from the named dictionary source.
+func NewSourceCandidate(text, annotation, source string) Candidate {
+	return &candidate{
+		text:       text,
+		annotation: annotation,
+		source:     source,
+	}
+}
+
+// ParseCandidates parses candidates in the form "/cand1/cand2;annotation/",
+// skipping the okuri blocks such as "[る/送/]".
+func ParseCandidates(s string) []Candidate {
+	var candidates []Candidate
+	for _, c := range jisyo.ParseCandidates(s) {
+		candidates = append(candidates, NewCandidate(c.Text, c.Annotation))
 	}
 
 	return candidates
 }
+
+func splitAnnotation(candidate string) (text, annotation string) {
+	return jisyo.SplitAnnotation(candidate)
+}
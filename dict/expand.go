@@ -0,0 +1,70 @@
+package dict
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Expand expands the directories and the glob patterns in names to the
+// dictionary files in them, in sorted order. The files in a directory
+// whose names start with '.' are skipped. The other names, including URLs
+// and the names of backends, are left as they are. A name that cannot be
+// expanded does not stop the others from being expanded, and the errors are
+// joined.
+func Expand(names []string) ([]string, error) {
+	var files []string
+	var errs []error
+	for _, name := range names {
+		if IsURL(name) || lookupBackend(name) != nil {
+			files = append(files, name)
+			continue
+		}
+
+		if strings.ContainsAny(name, "*?[") {
+			matches, err := filepath.Glob(name)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid pattern %s: %w", name, err))
+				continue
+			}
+			if len(matches) == 0 {
+				errs = append(errs, fmt.Errorf("no dictionary files match %s", name))
+				continue
+			}
+			for _, m := range matches {
+				if fi, err := os.Stat(m); err == nil && fi.IsDir() {
+					continue
+				}
+				files = append(files, m)
+			}
+			continue
+		}
+
+		fi, err := os.Stat(name)
+		if err != nil || !fi.IsDir() {
+			// let the loader report the error
+			files = append(files, name)
+			continue
+		}
+
+		entries, err := os.ReadDir(name)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read dictionary directory %s: %w", name, err))
+			continue
+		}
+		var dir []string
+		for _, e := range entries {
+			if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			dir = append(dir, filepath.Join(name, e.Name()))
+		}
+		sort.Strings(dir)
+		files = append(files, dir...)
+	}
+
+	return files, errors.Join(errs...)
+}
@@ -0,0 +1,86 @@
+package dict
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ExportEntry is a candidate of a user dictionary in the export format,
+// which is JSON Lines of ExportEntry in UTF-8.
+type ExportEntry struct {
+	Key        string `json:"key"`
+	Text       string `json:"text"`
+	Annotation string `json:"annotation,omitempty"`
+	// Count is the frequency learned by Learn.
+	Count int `json:"count,omitempty"`
+}
+
+// Export writes all the candidates of u with their frequency to w in the
+// export format, so they can be moved to another machine by Import.
+func (u *UserDictionary) Export(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	var err error
+	u.Walk(func(key string, candidates []Candidate) bool {
+		for _, c := range candidates {
+			err = enc.Encode(&ExportEntry{
+				Key:        key,
+				Text:       c.Text(),
+				Annotation: c.Annotation(),
+				Count:      u.freq.Count(key, c.Text()),
+			})
+			if err != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export user dictionary: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("failed to export user dictionary: %w", err)
+	}
+
+	return nil
+}
+
+// Import adds the candidates exported by Export to u, adding up their
+// frequency, and saves u, or lets it saved by AutoSave. The candidates u
+// already has are kept in place. It returns the number of the candidates
+// added.
+func (u *UserDictionary) Import(r io.Reader) (int, error) {
+	var entries []ExportEntry
+	dec := json.NewDecoder(r)
+	for {
+		var e ExportEntry
+		if err := dec.Decode(&e); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return 0, fmt.Errorf("failed to import user dictionary: %w", err)
+		}
+		if e.Key == "" || e.Text == "" || e.Count < 0 {
+			return 0, fmt.Errorf("failed to import user dictionary: invalid entry of %q", e.Key)
+		}
+		entries = append(entries, e)
+	}
+
+	n := 0
+	for _, e := range entries {
+		if u.AddEntry(e.Key, e.Text, e.Annotation) {
+			n++
+		}
+		if e.Count > 0 {
+			u.freq.Add(e.Key, e.Text, e.Count)
+		}
+	}
+	if len(entries) == 0 || u.changed() {
+		return n, nil
+	}
+
+	return n, u.Save()
+}
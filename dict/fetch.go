@@ -0,0 +1,271 @@
+package dict
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Fetcher downloads dictionary files from HTTP(S) URLs, or URLs of the
+// schemes registered by RegisterScheme, and keeps them in a local
+// directory, so they are downloaded only once.
+type Fetcher struct {
+	// Dir is the directory to keep the downloaded files in. Empty means
+	// DefaultFetchDir.
+	Dir string
+
+	// Client is used for the downloads. Nil means http.DefaultClient.
+	Client *http.Client
+}
+
+// DefaultFetchDir returns the default directory of the downloaded
+// dictionaries, under the user's cache directory.
+func DefaultFetchDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+
+	return filepath.Join(dir, "goskkserv", "dict")
+}
+
+// ErrNotModified is returned by a SchemeFunc if the object is not changed.
+var ErrNotModified = errors.New("not modified")
+
+// SchemeFunc gets the object of rawURL with client. If etag is not empty
+// and the object still has it as its ETag, it returns ErrNotModified.
+// Otherwise it returns the content and the ETag of the object.
+type SchemeFunc func(ctx context.Context, client *http.Client, rawURL, etag string) (io.ReadCloser, string, error)
+
+var (
+	schemesMu sync.RWMutex
+	schemes   = make(map[string]SchemeFunc)
+)
+
+// RegisterScheme makes the URLs of scheme (such as "s3") downloaded by get
+// in a Fetcher. Packages of storage services register themselves in their
+// init functions.
+func RegisterScheme(scheme string, get SchemeFunc) {
+	schemesMu.Lock()
+	defer schemesMu.Unlock()
+
+	schemes[strings.ToLower(scheme)] = get
+}
+
+func lookupScheme(rawURL string) SchemeFunc {
+	i := strings.Index(rawURL, "://")
+	if i <= 0 {
+		return nil
+	}
+
+	schemesMu.RLock()
+	defer schemesMu.RUnlock()
+
+	return schemes[strings.ToLower(rawURL[:i])]
+}
+
+// IsURL reports whether name is a HTTP(S) URL or a URL of a registered
+// scheme rather than a file name.
+func IsURL(name string) bool {
+	return strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") ||
+		lookupScheme(name) != nil
+}
+
+// Path returns the local file name of the dictionary of rawURL. The base
+// name of the URL is kept, so the format is detected by the extension.
+func (f *Fetcher) Path(rawURL string) string {
+	base := "dict"
+	if u, err := url.Parse(rawURL); err == nil {
+		if b := path.Base(u.Path); b != "." && b != "/" {
+			base = b
+		}
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+
+	return filepath.Join(f.dir(), hex.EncodeToString(sum[:8])+"-"+base)
+}
+
+// Fetch returns the local file name of the dictionary of rawURL,
+// downloading it if it is not downloaded yet.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (string, error) {
+	name := f.Path(rawURL)
+	if _, err := os.Stat(name); err == nil {
+		return name, nil
+	}
+
+	if _, err := f.download(ctx, rawURL, name, nil, nil); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// Update downloads the dictionary of rawURL again if it is changed since
+// it is downloaded, asking the server with the ETag and the Last-Modified
+// of the last download. It reports whether the file is changed.
+func (f *Fetcher) Update(ctx context.Context, rawURL string) (bool, error) {
+	name := f.Path(rawURL)
+
+	var meta *fetchMeta
+	if _, err := os.Stat(name); err == nil {
+		meta = readFetchMeta(name)
+	}
+
+	return f.download(ctx, rawURL, name, meta, nil)
+}
+
+// fetchMeta is kept next to a downloaded file for conditional requests.
+type fetchMeta struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+func metaPath(name string) string {
+	return name + ".meta"
+}
+
+// readFetchMeta returns the fetchMeta of the file name, which is empty if
+// it cannot be read.
+func readFetchMeta(name string) *fetchMeta {
+	meta := &fetchMeta{}
+	if b, err := os.ReadFile(metaPath(name)); err == nil {
+		json.Unmarshal(b, meta)
+	}
+
+	return meta
+}
+
+// download downloads rawURL to the file name. The file is written to a
+// temporary file first and renamed, so a partly downloaded file is never
+// loaded. If verify is not nil, it is called with the temporary file
+// before the rename. If meta is not nil, the file is downloaded only if it
+// is changed since meta. It reports whether the file is downloaded.
+func (f *Fetcher) download(ctx context.Context, rawURL, name string, meta *fetchMeta, verify func(name string) error) (downloaded bool, err error) {
+	body, newMeta, err := f.open(ctx, rawURL, meta)
+	if err != nil {
+		if errors.Is(err, ErrNotModified) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to download dictionary %s: %w", rawURL, err)
+	}
+	defer body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return false, fmt.Errorf("failed to download dictionary %s: %w", rawURL, err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return false, fmt.Errorf("failed to download dictionary %s: %w", rawURL, err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		return false, fmt.Errorf("failed to download dictionary %s: %w", rawURL, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return false, fmt.Errorf("failed to download dictionary %s: %w", rawURL, err)
+	}
+	if verify != nil {
+		if err := verify(tmp.Name()); err != nil {
+			return false, fmt.Errorf("failed to download dictionary %s: %w", rawURL, err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return false, fmt.Errorf("failed to download dictionary %s: %w", rawURL, err)
+	}
+
+	// without the meta, the next update downloads the file again
+	b, _ := json.Marshal(newMeta)
+	os.WriteFile(metaPath(name), b, 0o644)
+
+	return true, nil
+}
+
+// open returns the content of rawURL and its fetchMeta, or ErrNotModified
+// if it is not changed since meta.
+func (f *Fetcher) open(ctx context.Context, rawURL string, meta *fetchMeta) (io.ReadCloser, *fetchMeta, error) {
+	if get := lookupScheme(rawURL); get != nil {
+		var etag string
+		if meta != nil {
+			etag = meta.ETag
+		}
+		body, etag, err := get(ctx, f.client(), rawURL, etag)
+		if err != nil {
+			return nil, nil, err
+		}
+		return body, &fetchMeta{ETag: etag}, nil
+	}
+
+	resp, err := f.get(ctx, rawURL, meta)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return nil, nil, ErrNotModified
+	}
+
+	return resp.Body, &fetchMeta{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
+
+// get sends a GET request of rawURL, conditional on meta if it is not nil,
+// and returns the response if it is 200 OK or 304 Not Modified.
+func (f *Fetcher) get(ctx context.Context, rawURL string, meta *fetchMeta) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if meta != nil {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+	resp, err := f.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && (meta == nil || resp.StatusCode != http.StatusNotModified) {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return resp, nil
+}
+
+func (f *Fetcher) dir() string {
+	if f.Dir != "" {
+		return f.Dir
+	}
+
+	return DefaultFetchDir()
+}
+
+func (f *Fetcher) client() *http.Client {
+	if f.Client != nil {
+		return f.Client
+	}
+
+	return http.DefaultClient
+}
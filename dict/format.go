@@ -0,0 +1,55 @@
+package dict
+
+import (
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// OpenFunc opens a dictionary file of a format other than SKK-JISYO.
+type OpenFunc func(name string) (Searcher, error)
+
+var (
+	formatsMu sync.RWMutex
+	formats   = make(map[string]OpenFunc)
+	backends  = make(map[string]OpenFunc)
+)
+
+// RegisterFormat makes the files with the extension ext (such as ".cdb")
+// opened by open in a Loader. Packages of dictionary formats register
+// themselves in their init functions.
+func RegisterFormat(ext string, open OpenFunc) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	formats[strings.ToLower(ext)] = open
+}
+
+// RegisterBackend makes the names of the URLs of scheme (such as
+// "skkserv") opened by open in a Loader, for dictionaries that are not
+// files, such as other servers.
+func RegisterBackend(scheme string, open OpenFunc) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+
+	backends[strings.ToLower(scheme)] = open
+}
+
+func lookupBackend(name string) OpenFunc {
+	i := strings.Index(name, "://")
+	if i <= 0 {
+		return nil
+	}
+
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	return backends[strings.ToLower(name[:i])]
+}
+
+func lookupFormat(name string) OpenFunc {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	return formats[strings.ToLower(filepath.Ext(name))]
+}
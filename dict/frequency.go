@@ -0,0 +1,382 @@
+package dict
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Frequency is the usage frequency of the candidates, such as how often
+// users select them.
+type Frequency struct {
+	mu     sync.RWMutex
+	counts map[string]map[string]int
+}
+
+func NewFrequency() *Frequency {
+	return &Frequency{counts: make(map[string]map[string]int)}
+}
+
+// Count returns the frequency of the candidate of text of key.
+func (f *Frequency) Count(key, text string) int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.counts[key][text]
+}
+
+// Add adds n to the frequency of the candidate of text of key.
+func (f *Frequency) Add(key, text string, n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m := f.counts[key]
+	if m == nil {
+		m = make(map[string]int)
+		f.counts[key] = m
+	}
+	m[text] += n
+}
+
+// ReadFrequencyFile reads the named frequency file as ReadFrequency.
+func ReadFrequencyFile(name string) (*Frequency, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open frequency file %s: %w", name, err)
+	}
+	defer file.Close()
+
+	f, err := ReadFrequency(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read frequency file %s: %w", name, err)
+	}
+
+	return f, nil
+}
+
+// ReadFrequency reads frequency data in UTF-8, which is either a skk-study
+// file, or a TSV file that has a candidate per line in the form:
+//
+//	key<TAB>text[<TAB>count]
+//
+// The count defaults to 1, and the counts of the same candidate are added
+// up. Empty lines and lines starting with '#' are skipped. The frequency
+// of a candidate in a skk-study file is the number of the times it is
+// recorded.
+func ReadFrequency(r io.Reader) (*Frequency, error) {
+	br := bufio.NewReader(r)
+	if isStudy(br) {
+		return readStudy(br)
+	}
+
+	f := NewFrequency()
+	s := bufio.NewScanner(br)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(s.Text(), "\r")
+		if strings.TrimSpace(line) == "" || line[0] == '#' {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) < 2 || len(fields) > 3 || fields[0] == "" || fields[1] == "" {
+			return nil, fmt.Errorf("line %d: invalid frequency", n)
+		}
+		count := 1
+		if len(fields) == 3 {
+			var err error
+			if count, err = strconv.Atoi(fields[2]); err != nil {
+				return nil, fmt.Errorf("line %d: invalid count: %w", n, err)
+			}
+		}
+		f.Add(fields[0], fields[1], count)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// isStudy reports whether r is of a skk-study file, which is a Lisp form
+// after the comments.
+func isStudy(r *bufio.Reader) bool {
+	b, _ := r.Peek(r.Size())
+	for {
+		b = bytes.TrimLeft(b, " \t\r\n")
+		if len(b) == 0 || b[0] != ';' {
+			break
+		}
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			return false
+		}
+		b = b[i+1:]
+	}
+
+	return len(b) > 0 && b[0] == '('
+}
+
+// readStudy reads a skk-study file, which is an alist of the okuri-ari and
+// the okuri-nasi entries:
+//
+//	((okuri-ari . ((KEY . (((PREV-KEY . PREV-WORD) . (WORD ...)) ...)) ...))
+//	 (okuri-nasi . ...))
+func readStudy(r io.Reader) (*Frequency, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &sexpParser{s: string(data)}
+	v, err := p.read()
+	if err != nil {
+		return nil, err
+	}
+
+	f := NewFrequency()
+	for _, section := range v.list() {
+		for _, e := range section.cdr().list() {
+			key := e.car().str
+			if key == "" {
+				continue
+			}
+			for _, rel := range e.cdr().list() {
+				for _, word := range rel.cdr().list() {
+					if word.str != "" {
+						f.Add(key, word.str, 1)
+					}
+				}
+			}
+		}
+	}
+
+	return f, nil
+}
+
+// sexp is a Lisp value of a skk-study file: a string, a symbol, or a cons
+// cell, whose cdr is nil at the end of a list.
+type sexp struct {
+	str    string
+	symbol string
+	cons   *[2]*sexp
+}
+
+func (v *sexp) car() *sexp {
+	if v == nil || v.cons == nil {
+		return nil
+	}
+
+	return v.cons[0]
+}
+
+func (v *sexp) cdr() *sexp {
+	if v == nil || v.cons == nil {
+		return nil
+	}
+
+	return v.cons[1]
+}
+
+// list returns the elements of the list v.
+func (v *sexp) list() []*sexp {
+	var elems []*sexp
+	for ; v != nil && v.cons != nil; v = v.cons[1] {
+		elems = append(elems, v.cons[0])
+	}
+
+	return elems
+}
+
+type sexpParser struct {
+	s string
+	i int
+}
+
+func (p *sexpParser) skip() {
+	for p.i < len(p.s) {
+		switch c := p.s[p.i]; {
+		case c == ';':
+			for p.i < len(p.s) && p.s[p.i] != '\n' {
+				p.i++
+			}
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			p.i++
+		default:
+			return
+		}
+	}
+}
+
+func (p *sexpParser) read() (*sexp, error) {
+	p.skip()
+	if p.i >= len(p.s) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	switch p.s[p.i] {
+	case '(':
+		p.i++
+		return p.readList()
+	case ')':
+		return nil, fmt.Errorf("unexpected ')' at %d", p.i)
+	case '"':
+		return p.readString()
+	default:
+		start := p.i
+		for p.i < len(p.s) && !strings.ContainsRune(" \t\r\n()\";", rune(p.s[p.i])) {
+			p.i++
+		}
+		if sym := p.s[start:p.i]; sym != "nil" {
+			return &sexp{symbol: sym}, nil
+		}
+		return nil, nil
+	}
+}
+
+// readList reads the elements of a list after '(', with a dotted cdr.
+func (p *sexpParser) readList() (*sexp, error) {
+	var head *sexp
+	tail := &head
+	for {
+		p.skip()
+		if p.i >= len(p.s) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if p.s[p.i] == ')' {
+			p.i++
+			return head, nil
+		}
+		if p.s[p.i] == '.' && p.i+1 < len(p.s) && strings.IndexByte(" \t\r\n(\"", p.s[p.i+1]) >= 0 {
+			p.i++
+			v, err := p.read()
+			if err != nil {
+				return nil, err
+			}
+			*tail = v
+			if p.skip(); p.i >= len(p.s) || p.s[p.i] != ')' {
+				return nil, errors.New("invalid dotted pair")
+			}
+			p.i++
+			return head, nil
+		}
+
+		v, err := p.read()
+		if err != nil {
+			return nil, err
+		}
+		cell := &sexp{cons: &[2]*sexp{v, nil}}
+		*tail = cell
+		tail = &cell.cons[1]
+	}
+}
+
+func (p *sexpParser) readString() (*sexp, error) {
+	p.i++ // "
+	var b strings.Builder
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		p.i++
+		switch c {
+		case '"':
+			return &sexp{str: b.String()}, nil
+		case '\\':
+			if p.i < len(p.s) {
+				b.WriteByte(p.s[p.i])
+				p.i++
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return nil, io.ErrUnexpectedEOF
+}
+
+// Ranked is a Searcher that reorders the candidates of another Searcher by
+// Frequency at each search, the most frequent first. The candidates of the
+// same frequency are kept in order.
+type Ranked struct {
+	searcher  Searcher
+	frequency *Frequency
+}
+
+var _ Searcher = (*Ranked)(nil)
+
+// NewRanked returns a Ranked of s by f.
+func NewRanked(s Searcher, f *Frequency) *Ranked {
+	return &Ranked{searcher: s, frequency: f}
+}
+
+func (r *Ranked) Search(ctx context.Context, key string) ([]Candidate, error) {
+	candidates, err := r.searcher.Search(ctx, key)
+	if err != nil || len(candidates) < 2 {
+		return candidates, err
+	}
+
+	r.frequency.mu.RLock()
+	defer r.frequency.mu.RUnlock()
+
+	counts := r.frequency.counts[key]
+	if len(counts) == 0 {
+		return candidates, nil
+	}
+
+	// do not change the slice owned by the searcher
+	ranked := append([]Candidate(nil), candidates...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return counts[ranked[i].Text()] > counts[ranked[j].Text()]
+	})
+
+	return ranked, nil
+}
+
+func (r *Ranked) Complete(ctx context.Context, prefix string) ([]string, error) {
+	return r.searcher.Complete(ctx, prefix)
+}
+
+func (r *Ranked) Stats() Stats {
+	return r.searcher.Stats()
+}
+
+// WriteTo writes f to w in the TSV form of ReadFrequency, sorted by key
+// and then by frequency.
+func (f *Frequency) WriteTo(w io.Writer) (int64, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	keys := make([]string, 0, len(f.counts))
+	for key := range f.counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, key := range keys {
+		counts := f.counts[key]
+		texts := make([]string, 0, len(counts))
+		for text := range counts {
+			texts = append(texts, text)
+		}
+		sort.Slice(texts, func(i, j int) bool {
+			if counts[texts[i]] != counts[texts[j]] {
+				return counts[texts[i]] > counts[texts[j]]
+			}
+			return texts[i] < texts[j]
+		})
+		for _, text := range texts {
+			fmt.Fprintf(bw, "%s\t%s\t%d\n", key, text, counts[text])
+		}
+	}
+	err := bw.Flush()
+
+	return cw.n, err
+}
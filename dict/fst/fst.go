@@ -0,0 +1,272 @@
+// Package fst provides a read-only dictionary whose keys are stored in a
+// finite state transducer (FST). An FST shares both the prefixes and the
+// suffixes of the keys, so it is much smaller than the other formats, and
+// iterates the keys in order.
+//
+// An FST file consists of a header, the FST and the candidates:
+//
+//	magic      [8]byte  "SKKFST01"
+//	keys       uint32
+//	candidates uint32
+//	fstSize    uint64
+//	fst        [fstSize]byte  maps a key to the offset of its candidates
+//	records    uvarint length followed by "/cand1/cand2/" ...
+//
+// All integers are little endian, and the text is UTF-8.
+package fst
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/blevesearch/vellum"
+	"github.com/kechako/goskkserv/dict"
+	"github.com/kechako/goskkserv/internal/mmap"
+)
+
+const (
+	magic      = "SKKFST01"
+	headerSize = len(magic) + 16
+)
+
+var ErrInvalidFST = errors.New("invalid fst file")
+
+func init() {
+	dict.RegisterFormat(".fst", func(name string) (dict.Searcher, error) {
+		return Open(name)
+	})
+}
+
+// FST is a dictionary of a memory mapped FST file.
+type FST struct {
+	data    []byte
+	fst     *vellum.FST
+	records []byte
+	stats   dict.Stats
+}
+
+var _ dict.Searcher = (*FST)(nil)
+
+func Open(name string) (*FST, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dictionary file %s: %w", name, err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dictionary file %s: %w", name, err)
+	}
+
+	data, err := mmap.Map(f, int(fi.Size()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to map dictionary file %s: %w", name, err)
+	}
+
+	d, err := parse(data)
+	if err != nil {
+		mmap.Unmap(data)
+		return nil, fmt.Errorf("failed to open dictionary file %s: %w", name, err)
+	}
+
+	return d, nil
+}
+
+func parse(data []byte) (*FST, error) {
+	if len(data) < headerSize || string(data[:len(magic)]) != magic {
+		return nil, ErrInvalidFST
+	}
+
+	keys := binary.LittleEndian.Uint32(data[len(magic):])
+	candidates := binary.LittleEndian.Uint32(data[len(magic)+4:])
+	size := binary.LittleEndian.Uint64(data[len(magic)+8:])
+	if size > uint64(len(data)-headerSize) {
+		return nil, ErrInvalidFST
+	}
+	end := headerSize + int(size)
+
+	fst, err := vellum.Load(data[headerSize:end])
+	if err != nil {
+		return nil, err
+	}
+
+	return &FST{
+		data:    data,
+		fst:     fst,
+		records: data[end:],
+		stats: dict.Stats{
+			Keys:       int(keys),
+			Candidates: int(candidates),
+		},
+	}, nil
+}
+
+func (d *FST) candidates(key string) ([]byte, error) {
+	off, ok, err := d.fst.Get([]byte(key))
+	if err != nil || !ok {
+		return nil, err
+	}
+	if off >= uint64(len(d.records)) {
+		return nil, ErrInvalidFST
+	}
+
+	r := d.records[off:]
+	n, i := binary.Uvarint(r)
+	if i <= 0 || n > uint64(len(r)-i) {
+		return nil, ErrInvalidFST
+	}
+
+	return r[i : i+int(n)], nil
+}
+
+func (d *FST) Search(ctx context.Context, key string) ([]dict.Candidate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	candidates, err := d.candidates(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return dict.ParseCandidates(string(candidates)), nil
+}
+
+// WriteCandidates writes the candidates of key in the form "/cand1/cand2/"
+// to w, directly from the mapped file. It reports whether key is found.
+func (d *FST) WriteCandidates(w io.Writer, key string) (bool, error) {
+	candidates, err := d.candidates(key)
+	if err != nil || len(candidates) == 0 {
+		return false, err
+	}
+
+	if _, err := w.Write(candidates); err != nil {
+		return true, err
+	}
+
+	return true, nil
+}
+
+// Complete returns the keys starting with prefix in sorted order.
+func (d *FST) Complete(ctx context.Context, prefix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if prefix == "" {
+		return nil, nil
+	}
+
+	var keys []string
+	it, err := d.fst.Iterator([]byte(prefix), prefixEnd([]byte(prefix)))
+	for err == nil {
+		key, _ := it.Current()
+		keys = append(keys, string(key))
+		err = it.Next()
+	}
+	if !errors.Is(err, vellum.ErrIteratorDone) {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// prefixEnd returns the smallest key greater than all the keys starting
+// with prefix, or nil if there is no such key.
+func prefixEnd(prefix []byte) []byte {
+	end := append([]byte(nil), prefix...)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+
+	return nil
+}
+
+func (d *FST) Stats() dict.Stats {
+	return d.stats
+}
+
+// Close unmaps the file. The FST must not be used after that.
+func (d *FST) Close() error {
+	if err := d.fst.Close(); err != nil {
+		return err
+	}
+
+	return mmap.Unmap(d.data)
+}
+
+// Build writes the entries of src to the FST file name. The file is
+// written to a temporary file first and renamed, so a server mapping the
+// old file is not disturbed.
+func Build(name string, src *dict.Dictionary) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create dictionary file %s: %w", name, err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err := write(tmp, src); err != nil {
+		return fmt.Errorf("failed to write dictionary file %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write dictionary file %s: %w", name, err)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("failed to write dictionary file %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func write(w io.Writer, src *dict.Dictionary) error {
+	var fst, records, payload bytes.Buffer
+	b, err := vellum.New(&fst, nil)
+	if err != nil {
+		return err
+	}
+
+	var buf [binary.MaxVarintLen64]byte
+	for _, key := range src.Keys() {
+		payload.Reset()
+		if _, err := src.WriteCandidates(&payload, key); err != nil {
+			return err
+		}
+
+		// the keys are sorted as the builder requires
+		if err := b.Insert([]byte(key), uint64(records.Len())); err != nil {
+			return err
+		}
+		records.Write(buf[:binary.PutUvarint(buf[:], uint64(payload.Len()))])
+		payload.WriteTo(&records)
+	}
+	if err := b.Close(); err != nil {
+		return err
+	}
+
+	stats := src.Stats()
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(magic)
+	binary.Write(bw, binary.LittleEndian, uint32(stats.Keys))
+	binary.Write(bw, binary.LittleEndian, uint32(stats.Candidates))
+	binary.Write(bw, binary.LittleEndian, uint64(fst.Len()))
+	fst.WriteTo(bw)
+	records.WriteTo(bw)
+
+	return bw.Flush()
+}
@@ -0,0 +1,120 @@
+package dict
+
+import "context"
+
+// Fuzzy is a Searcher that searches another Searcher by the keys near the
+// given one only when it has no candidates, so typos such as
+// "こんぴゅうた" for "こんぴゅーた" still find candidates. The near keys
+// are those with a kana often confused replaced, such as "う" for "ー" or
+// "ゆ" for "ゅ", with a kana dropped, and with two adjacent kana swapped.
+// The candidates found by them are flagged as fuzzy, which IsFuzzy tells,
+// and annotated with the key they are found by.
+type Fuzzy struct {
+	searcher Searcher
+}
+
+var _ Searcher = (*Fuzzy)(nil)
+
+// NewFuzzy returns a Fuzzy of s.
+func NewFuzzy(s Searcher) *Fuzzy {
+	return &Fuzzy{searcher: s}
+}
+
+func (f *Fuzzy) Search(ctx context.Context, key string) ([]Candidate, error) {
+	candidates, err := f.searcher.Search(ctx, key)
+	if err != nil || len(candidates) > 0 {
+		return candidates, err
+	}
+
+	for _, near := range nearKeys(key) {
+		found, err := f.searcher.Search(ctx, near)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range found {
+			if containsText(candidates, c.Text()) {
+				continue
+			}
+			candidates = append(candidates, &fuzzyCandidate{
+				candidate: candidate{
+					text:       c.Text(),
+					annotation: tagAnnotation(c.Annotation(), near),
+					source:     c.Source(),
+				},
+				key: near,
+			})
+		}
+	}
+
+	return candidates, nil
+}
+
+func (f *Fuzzy) Complete(ctx context.Context, prefix string) ([]string, error) {
+	return f.searcher.Complete(ctx, prefix)
+}
+
+func (f *Fuzzy) Stats() Stats {
+	return f.searcher.Stats()
+}
+
+// fuzzyCandidate is a candidate found by a key near the one searched.
+type fuzzyCandidate struct {
+	candidate
+	key string
+}
+
+// IsFuzzy reports whether c is found by Fuzzy by a key other than the one
+// searched, and returns the key.
+func IsFuzzy(c Candidate) (key string, ok bool) {
+	if fc, ok := c.(*fuzzyCandidate); ok {
+		return fc.key, true
+	}
+
+	return "", false
+}
+
+// confusions are the kana often confused with each other.
+var confusions = map[rune][]rune{
+	'ー': {'う', 'あ', 'い', 'え', 'お'},
+	'う': {'ー'}, 'あ': {'ー', 'ぁ'}, 'い': {'ー', 'ぃ'}, 'え': {'ー', 'ぇ'}, 'お': {'ー', 'ぉ', 'を'},
+	'ぁ': {'あ'}, 'ぃ': {'い'}, 'ぅ': {'う'}, 'ぇ': {'え'}, 'ぉ': {'お'},
+	'ゃ': {'や'}, 'ゅ': {'ゆ'}, 'ょ': {'よ'}, 'っ': {'つ'},
+	'や': {'ゃ'}, 'ゆ': {'ゅ'}, 'よ': {'ょ'}, 'つ': {'っ'},
+	'じ': {'ぢ'}, 'ぢ': {'じ'}, 'ず': {'づ'}, 'づ': {'ず'},
+	'を': {'お'}, 'わ': {'は'}, 'は': {'わ'},
+}
+
+// nearKeys returns the keys near key, without duplicates, the more likely
+// ones first.
+func nearKeys(key string) []string {
+	runes := []rune(key)
+	seen := map[string]struct{}{key: {}}
+	var keys []string
+	add := func(r []rune) {
+		k := string(r)
+		if _, ok := seen[k]; ok || k == "" {
+			return
+		}
+		seen[k] = struct{}{}
+		keys = append(keys, k)
+	}
+
+	near := make([]rune, len(runes))
+	for i, r := range runes {
+		for _, alt := range confusions[r] {
+			copy(near, runes)
+			near[i] = alt
+			add(near)
+		}
+	}
+	for i := range runes {
+		add(append(append([]rune(nil), runes[:i]...), runes[i+1:]...))
+	}
+	for i := 0; i+1 < len(runes); i++ {
+		copy(near, runes)
+		near[i], near[i+1] = near[i+1], near[i]
+		add(near)
+	}
+
+	return keys
+}
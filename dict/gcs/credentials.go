@@ -0,0 +1,60 @@
+package gcs
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// anonymousPeriod is how long the objects are requested anonymously after
+// no credentials are found, before they are searched again.
+const anonymousPeriod = 10 * time.Minute
+
+// tokens gives the access tokens of the Application Default Credentials,
+// found at the first request. The tokens are cached until they expire.
+type tokens struct {
+	mu     sync.Mutex
+	source oauth2.TokenSource
+
+	// the objects are requested anonymously until anonymousUntil, as no
+	// credentials were found for the reason of noCredentials
+	anonymousUntil time.Time
+	noCredentials  error
+}
+
+var defaultTokens = &tokens{}
+
+// token returns an access token, or "" and the reason as noCredentials if
+// there are no credentials, such as off Google Cloud.
+func (t *tokens) token(client *http.Client) (token string, noCredentials, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.source == nil {
+		if time.Now().Before(t.anonymousUntil) {
+			return "", t.noCredentials, nil
+		}
+
+		// the token source keeps the context to refresh the tokens, which
+		// must outlive the request
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, client)
+		creds, err := google.FindDefaultCredentials(ctx, scope)
+		if err != nil {
+			t.anonymousUntil = time.Now().Add(anonymousPeriod)
+			t.noCredentials = err
+			return "", err, nil
+		}
+		t.source = creds.TokenSource
+	}
+
+	tok, err := t.source.Token()
+	if err != nil {
+		return "", nil, err
+	}
+
+	return tok.AccessToken, nil, nil
+}
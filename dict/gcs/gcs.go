@@ -0,0 +1,118 @@
+// Package gcs registers the scheme gs of dictionary URLs, such as
+// gs://bucket/SKK-JISYO.L.gz, to download dictionaries from Google Cloud
+// Storage. Import it for its side effect:
+//
+//	import _ "github.com/kechako/goskkserv/dict/gcs"
+//
+// The credentials are found as Application Default Credentials: the file
+// of GOOGLE_APPLICATION_CREDENTIALS, the file made by gcloud auth
+// application-default login, or the metadata server on Google Cloud, in
+// this order. The access tokens are kept until they expire. Without
+// credentials, objects are requested anonymously for a while before the
+// credentials are searched again.
+// STORAGE_EMULATOR_HOST sets the host of an emulator.
+//
+// It is a separate module so that the OAuth2 dependencies are only pulled
+// in by the programs that use it.
+package gcs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/kechako/goskkserv/dict"
+)
+
+func init() {
+	dict.RegisterScheme("gs", Get)
+}
+
+const scope = "https://www.googleapis.com/auth/devstorage.read_only"
+
+var endpoint = "https://storage.googleapis.com"
+
+// Get gets the object of rawURL in the form gs://bucket/object. It is a
+// dict.SchemeFunc.
+func Get(ctx context.Context, client *http.Client, rawURL, etag string) (io.ReadCloser, string, error) {
+	bucket, object, err := parseURL(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, objectURL(bucket, object), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	var noCredentials error
+	if os.Getenv("STORAGE_EMULATOR_HOST") == "" {
+		var token string
+		token, noCredentials, err = defaultTokens.token(client)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to get access token: %w", err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, resp.Header.Get("ETag"), nil
+	case http.StatusNotModified:
+		resp.Body.Close()
+		return nil, "", dict.ErrNotModified
+	case http.StatusUnauthorized, http.StatusForbidden:
+		resp.Body.Close()
+		if noCredentials != nil {
+			return nil, "", fmt.Errorf("unexpected status: %s, requested anonymously without credentials: %w", resp.Status, noCredentials)
+		}
+		return nil, "", fmt.Errorf("unexpected status: %s", resp.Status)
+	default:
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+}
+
+func parseURL(rawURL string) (bucket, object string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", err
+	}
+	object = strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || object == "" {
+		return "", "", fmt.Errorf("invalid gs url: %s", rawURL)
+	}
+
+	return u.Host, object, nil
+}
+
+// objectURL returns the URL of the object in the XML API, which supports
+// conditional requests with ETags.
+func objectURL(bucket, object string) string {
+	base := endpoint
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		base = host
+		if !strings.Contains(base, "://") {
+			base = "http://" + base
+		}
+	}
+
+	segments := strings.Split(object, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+
+	return strings.TrimRight(base, "/") + "/" + url.PathEscape(bucket) + "/" + strings.Join(segments, "/")
+}
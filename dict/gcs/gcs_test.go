@@ -0,0 +1,139 @@
+package gcs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kechako/goskkserv/dict"
+)
+
+func TestObjectURL(t *testing.T) {
+	t.Setenv("STORAGE_EMULATOR_HOST", "")
+	if got, want := objectURL("bucket", "dir/SKK JISYO#.L"), "https://storage.googleapis.com/bucket/dir/SKK%20JISYO%23.L"; got != want {
+		t.Errorf("objectURL() = %q, want %q", got, want)
+	}
+
+	t.Setenv("STORAGE_EMULATOR_HOST", "localhost:4443")
+	if got, want := objectURL("bucket", "SKK-JISYO.L"), "http://localhost:4443/bucket/SKK-JISYO.L"; got != want {
+		t.Errorf("objectURL() with an emulator = %q, want %q", got, want)
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	bucket, object, err := parseURL("gs://bucket/dir/SKK-JISYO.L.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bucket != "bucket" || object != "dir/SKK-JISYO.L.gz" {
+		t.Errorf("parseURL() = %q, %q", bucket, object)
+	}
+
+	for _, rawURL := range []string{"gs://bucket", "gs://bucket/", "gs:///SKK-JISYO.L"} {
+		if _, _, err := parseURL(rawURL); err == nil {
+			t.Errorf("parseURL(%q) succeeded", rawURL)
+		}
+	}
+}
+
+// setupEnv isolates the credentials from the environment, and serves the
+// objects by handler in place of Cloud Storage.
+func setupEnv(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	dir := t.TempDir()
+	t.Setenv("STORAGE_EMULATOR_HOST", "")
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+	t.Setenv("HOME", dir)
+	t.Setenv("CLOUDSDK_CONFIG", dir)
+	t.Setenv("GCE_METADATA_HOST", "")
+
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	oldEndpoint, oldTokens := endpoint, defaultTokens
+	endpoint, defaultTokens = srv.URL, &tokens{}
+	t.Cleanup(func() { endpoint, defaultTokens = oldEndpoint, oldTokens })
+
+	return srv
+}
+
+func TestGet(t *testing.T) {
+	var tokenRequests int
+	srv := setupEnv(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			tokenRequests++
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"access_token":"TOKEN","token_type":"Bearer","expires_in":3600}`)
+		case r.URL.Path != "/bucket/SKK-JISYO.L" || r.Header.Get("Authorization") != "Bearer TOKEN":
+			http.Error(w, "forbidden", http.StatusForbidden)
+		case r.Header.Get("If-None-Match") == `"v1"`:
+			w.WriteHeader(http.StatusNotModified)
+		default:
+			w.Header().Set("ETag", `"v1"`)
+			io.WriteString(w, "かんじ /漢字/\n")
+		}
+	})
+
+	name := filepath.Join(t.TempDir(), "credentials.json")
+	creds := fmt.Sprintf(`{"type":"authorized_user","client_id":"id","client_secret":"secret","refresh_token":"refresh","token_uri":"%s/token"}`, srv.URL)
+	if err := os.WriteFile(name, []byte(creds), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", name)
+
+	body, etag, err := Get(context.Background(), http.DefaultClient, "gs://bucket/SKK-JISYO.L", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "かんじ /漢字/\n" || etag != `"v1"` {
+		t.Errorf("Get() = %q, %q", data, etag)
+	}
+
+	if _, _, err := Get(context.Background(), http.DefaultClient, "gs://bucket/SKK-JISYO.L", etag); !errors.Is(err, dict.ErrNotModified) {
+		t.Errorf("Get() with the etag error = %v, want %v", err, dict.ErrNotModified)
+	}
+	if tokenRequests != 1 {
+		t.Errorf("token requests = %d, want 1", tokenRequests)
+	}
+}
+
+func TestGetAnonymous(t *testing.T) {
+	setupEnv(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("anonymous request has a token: %s", r.Header.Get("Authorization"))
+		}
+		if r.URL.Path != "/bucket/public" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		io.WriteString(w, "かんじ /漢字/\n")
+	})
+
+	body, _, err := Get(context.Background(), http.DefaultClient, "gs://bucket/public", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body.Close()
+	if defaultTokens.noCredentials == nil {
+		t.Error("missing credentials are not remembered")
+	}
+
+	_, _, err = Get(context.Background(), http.DefaultClient, "gs://bucket/private", "")
+	if err == nil || !strings.Contains(err.Error(), "without credentials") {
+		t.Errorf("Get() of a private object error = %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+module github.com/kechako/goskkserv/dict/gcs
+
+go 1.22
+
+require (
+	github.com/kechako/goskkserv v0.0.0
+	golang.org/x/oauth2 v0.26.0
+)
+
+require (
+	cloud.google.com/go/compute/metadata v0.3.0 // indirect
+	github.com/fsnotify/fsnotify v1.9.0 // indirect
+	github.com/ulikunitz/xz v0.5.15 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/text v0.3.3 // indirect
+)
+
+replace github.com/kechako/goskkserv => ../../
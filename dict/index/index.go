@@ -0,0 +1,274 @@
+// Package index provides a compact binary dictionary format that is memory
+// mapped when opened, so a dictionary is ready in milliseconds and its
+// pages are shared among processes.
+//
+// An index file consists of a header, the offsets of the records, and the
+// records sorted by key:
+//
+//	magic      [8]byte  "SKKIDX01"
+//	keys       uint32
+//	candidates uint32
+//	offsets    [keys+1]uint32  offsets of the records from the first record
+//	records    key " /cand1/cand2/" ...
+//
+// All integers are little endian, and the text is UTF-8.
+package index
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kechako/goskkserv/dict"
+	"github.com/kechako/goskkserv/internal/mmap"
+)
+
+const (
+	magic      = "SKKIDX01"
+	headerSize = len(magic) + 8
+)
+
+var ErrInvalidIndex = errors.New("invalid index file")
+
+func init() {
+	dict.RegisterFormat(".skkidx", func(name string) (dict.Searcher, error) {
+		return Open(name)
+	})
+}
+
+// Index is a dictionary of a memory mapped index file.
+type Index struct {
+	data    []byte
+	offsets []byte
+	records []byte
+	stats   dict.Stats
+}
+
+var _ dict.Searcher = (*Index)(nil)
+
+func Open(name string) (*Index, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dictionary file %s: %w", name, err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dictionary file %s: %w", name, err)
+	}
+	if fi.Size() > math.MaxInt32 {
+		return nil, fmt.Errorf("failed to open dictionary file %s: %w", name, ErrInvalidIndex)
+	}
+
+	data, err := mmap.Map(f, int(fi.Size()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to map dictionary file %s: %w", name, err)
+	}
+
+	idx, err := parse(data)
+	if err != nil {
+		mmap.Unmap(data)
+		return nil, fmt.Errorf("failed to open dictionary file %s: %w", name, err)
+	}
+
+	return idx, nil
+}
+
+func parse(data []byte) (*Index, error) {
+	if len(data) < headerSize || string(data[:len(magic)]) != magic {
+		return nil, ErrInvalidIndex
+	}
+
+	keys := int(binary.LittleEndian.Uint32(data[len(magic):]))
+	candidates := int(binary.LittleEndian.Uint32(data[len(magic)+4:]))
+
+	end := headerSize + (keys+1)*4
+	if keys < 0 || end > len(data) {
+		return nil, ErrInvalidIndex
+	}
+
+	idx := &Index{
+		data:    data,
+		offsets: data[headerSize:end],
+		records: data[end:],
+		stats: dict.Stats{
+			Keys:       keys,
+			Candidates: candidates,
+		},
+	}
+	// the records are sliced at the offsets without checks
+	var prev uint32
+	for i := 0; i <= keys; i++ {
+		off := idx.offset(i)
+		if off < prev || int(off) > len(idx.records) {
+			return nil, ErrInvalidIndex
+		}
+		prev = off
+	}
+	if int(idx.offset(keys)) != len(idx.records) {
+		return nil, ErrInvalidIndex
+	}
+
+	return idx, nil
+}
+
+func (idx *Index) offset(i int) uint32 {
+	return binary.LittleEndian.Uint32(idx.offsets[i*4:])
+}
+
+// record returns the key and the candidates of the i-th record.
+func (idx *Index) record(i int) (key, candidates []byte) {
+	r := idx.records[idx.offset(i):idx.offset(i+1)]
+	if j := bytes.IndexByte(r, ' '); j >= 0 {
+		return r[:j], r[j+1:]
+	}
+
+	return r, nil
+}
+
+// find returns the index of the first record whose key is not less than
+// key.
+func (idx *Index) find(key string) int {
+	return sort.Search(idx.stats.Keys, func(i int) bool {
+		k, _ := idx.record(i)
+		return string(k) >= key
+	})
+}
+
+func (idx *Index) lookup(key string) []byte {
+	i := idx.find(key)
+	if i >= idx.stats.Keys {
+		return nil
+	}
+
+	k, candidates := idx.record(i)
+	if string(k) != key {
+		return nil
+	}
+
+	return candidates
+}
+
+func (idx *Index) Search(ctx context.Context, key string) ([]dict.Candidate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return dict.ParseCandidates(string(idx.lookup(key))), nil
+}
+
+// WriteCandidates writes the candidates of key in the form "/cand1/cand2/"
+// to w, directly from the mapped file. It reports whether key is found.
+func (idx *Index) WriteCandidates(w io.Writer, key string) (bool, error) {
+	candidates := idx.lookup(key)
+	if len(candidates) == 0 {
+		return false, nil
+	}
+
+	if _, err := w.Write(candidates); err != nil {
+		return true, err
+	}
+
+	return true, nil
+}
+
+// Complete returns the keys starting with prefix in sorted order.
+func (idx *Index) Complete(ctx context.Context, prefix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if prefix == "" {
+		return nil, nil
+	}
+
+	var keys []string
+	for i := idx.find(prefix); i < idx.stats.Keys; i++ {
+		k, _ := idx.record(i)
+		if !strings.HasPrefix(string(k), prefix) {
+			break
+		}
+		keys = append(keys, string(k))
+	}
+
+	return keys, nil
+}
+
+func (idx *Index) Stats() dict.Stats {
+	return idx.stats
+}
+
+// Close unmaps the file. The Index must not be used after that.
+func (idx *Index) Close() error {
+	return mmap.Unmap(idx.data)
+}
+
+// Compile writes the entries of src to the index file name. The file is
+// written to a temporary file first and renamed, so a server mapping the
+// old file is not disturbed.
+func Compile(name string, src *dict.Dictionary) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create dictionary file %s: %w", name, err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if err := write(tmp, src); err != nil {
+		return fmt.Errorf("failed to write dictionary file %s: %w", name, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write dictionary file %s: %w", name, err)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("failed to write dictionary file %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func write(w io.Writer, src *dict.Dictionary) error {
+	keys := src.Keys()
+
+	var records bytes.Buffer
+	offsets := make([]uint32, 0, len(keys)+1)
+	for _, key := range keys {
+		if records.Len() > math.MaxUint32 {
+			return errors.New("index exceeds 4GB")
+		}
+		offsets = append(offsets, uint32(records.Len()))
+		records.WriteString(key)
+		records.WriteByte(' ')
+		if _, err := src.WriteCandidates(&records, key); err != nil {
+			return err
+		}
+	}
+	if records.Len() > math.MaxUint32 {
+		return errors.New("index exceeds 4GB")
+	}
+	offsets = append(offsets, uint32(records.Len()))
+
+	stats := src.Stats()
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString(magic)
+	binary.Write(bw, binary.LittleEndian, uint32(len(keys)))
+	binary.Write(bw, binary.LittleEndian, uint32(stats.Candidates))
+	binary.Write(bw, binary.LittleEndian, offsets)
+	records.WriteTo(bw)
+
+	return bw.Flush()
+}
@@ -0,0 +1,75 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/kechako/goskkserv/dict"
+)
+
+func testIndex(t *testing.T) []byte {
+	t.Helper()
+
+	src, err := dict.Load(strings.NewReader("かんじ /漢字/感じ/\nかな /仮名/\nさ /差/\n"), dict.Encoding("utf-8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := write(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestParse(t *testing.T) {
+	data := testIndex(t)
+
+	idx, err := parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	candidates, err := idx.Search(context.Background(), "かんじ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 2 || candidates[0].Text() != "漢字" {
+		t.Errorf("Search() = %v", candidates)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	data := testIndex(t)
+	keys := int(binary.LittleEndian.Uint32(data[len(magic):]))
+
+	tests := []struct {
+		name    string
+		corrupt func(b []byte) []byte
+	}{
+		{"short header", func(b []byte) []byte { return b[:headerSize-1] }},
+		{"bad magic", func(b []byte) []byte { b[0] = 'X'; return b }},
+		{"truncated", func(b []byte) []byte { return b[:len(b)-1] }},
+		{"too many keys", func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(b[len(magic):], 1<<20)
+			return b
+		}},
+		{"decreasing offset", func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(b[headerSize+4:], 1<<10)
+			return b
+		}},
+		{"offset out of range", func(b []byte) []byte {
+			binary.LittleEndian.PutUint32(b[headerSize+(keys-1)*4:], 1<<30)
+			return b
+		}},
+	}
+	for _, tt := range tests {
+		b := tt.corrupt(append([]byte(nil), data...))
+		if _, err := parse(b); !errors.Is(err, ErrInvalidIndex) {
+			t.Errorf("%s: parse() error = %v, want %v", tt.name, err, ErrInvalidIndex)
+		}
+	}
+}
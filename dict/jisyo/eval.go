@@ -0,0 +1,197 @@
+package jisyo
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var errUnsupportedForm = errors.New("unsupported form")
+
+// IsLisp reports whether s is a Lisp form, such as `(concat "a\057b")`,
+// which SKK clients evaluate to get the text.
+func IsLisp(s string) bool {
+	return len(s) >= 2 && s[0] == '(' && s[len(s)-1] == ')'
+}
+
+// Eval evaluates a Lisp form of a candidate. The supported forms are
+// concat of strings and of the forms, and a string. The strings may have
+// the escapes of Emacs Lisp, such as "\057" for "/".
+func Eval(s string) (string, error) {
+	p := &evalParser{s: s}
+	v, err := p.form()
+	if err != nil {
+		return "", err
+	}
+	if p.skipSpaces(); p.i != len(p.s) {
+		return "", errors.New("trailing characters")
+	}
+	if !utf8.ValidString(v) {
+		return "", errors.New("invalid encoding sequence")
+	}
+
+	return v, nil
+}
+
+type evalParser struct {
+	s string
+	i int
+}
+
+func (p *evalParser) skipSpaces() {
+	for p.i < len(p.s) && strings.IndexByte(" \t\n", p.s[p.i]) >= 0 {
+		p.i++
+	}
+}
+
+// form parses a string or a list, and returns its value.
+func (p *evalParser) form() (string, error) {
+	p.skipSpaces()
+	if p.i >= len(p.s) {
+		return "", errors.New("unexpected end of form")
+	}
+	switch p.s[p.i] {
+	case '"':
+		return p.str()
+	case '(':
+		return p.list()
+	default:
+		return "", errUnsupportedForm
+	}
+}
+
+func (p *evalParser) list() (string, error) {
+	p.i++ // (
+	p.skipSpaces()
+	start := p.i
+	for p.i < len(p.s) && strings.IndexByte(" \t\n()\"", p.s[p.i]) < 0 {
+		p.i++
+	}
+	if p.s[start:p.i] != "concat" {
+		return "", errUnsupportedForm
+	}
+
+	var b strings.Builder
+	for {
+		p.skipSpaces()
+		if p.i >= len(p.s) {
+			return "", errors.New("unterminated list")
+		}
+		if p.s[p.i] == ')' {
+			p.i++
+			break
+		}
+		v, err := p.form()
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(v)
+	}
+
+	return b.String(), nil
+}
+
+func (p *evalParser) str() (string, error) {
+	p.i++ // "
+	var b []byte
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		p.i++
+		switch c {
+		case '"':
+			return string(b), nil
+		case '\\':
+			var err error
+			if b, err = p.escape(b); err != nil {
+				return "", err
+			}
+		default:
+			b = append(b, c)
+		}
+	}
+
+	return "", errors.New("unterminated string")
+}
+
+// escape appends the character of the escape sequence after a backslash.
+func (p *evalParser) escape(b []byte) ([]byte, error) {
+	if p.i >= len(p.s) {
+		return nil, errors.New("unterminated string")
+	}
+	c := p.s[p.i]
+	p.i++
+	switch {
+	case c >= '0' && c <= '7':
+		// up to three octal digits of a byte
+		start := p.i - 1
+		for p.i < len(p.s) && p.i-start < 3 && p.s[p.i] >= '0' && p.s[p.i] <= '7' {
+			p.i++
+		}
+		n, err := strconv.ParseUint(p.s[start:p.i], 8, 16)
+		if err != nil || n > 0xff {
+			return nil, errors.New("invalid octal escape")
+		}
+		return append(b, byte(n)), nil
+	case c == 'x':
+		start := p.i
+		for p.i < len(p.s) && strings.IndexByte("0123456789abcdefABCDEF", p.s[p.i]) >= 0 {
+			p.i++
+		}
+		n, err := strconv.ParseUint(p.s[start:p.i], 16, 32)
+		if err != nil || n > utf8.MaxRune {
+			return nil, errors.New("invalid hex escape")
+		}
+		if n <= 0xff {
+			return append(b, byte(n)), nil
+		}
+		return utf8.AppendRune(b, rune(n)), nil
+	case c == '\n':
+		// an escaped newline is ignored
+		return b, nil
+	}
+
+	if r, ok := lispEscapes[c]; ok {
+		return append(b, r), nil
+	}
+
+	return append(b, c), nil
+}
+
+var lispEscapes = map[byte]byte{
+	'a': '\a',
+	'b': '\b',
+	'e': 0x1b,
+	'f': '\f',
+	'n': '\n',
+	'r': '\r',
+	't': '\t',
+	'v': '\v',
+}
+
+// Quote returns a Lisp form evaluating to s, such as `(concat "a\057b")`
+// for "a/b", so s can be written as a candidate even if it has '/' or ';'.
+func Quote(s string) string {
+	var b strings.Builder
+	b.WriteString(`(concat "`)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '/':
+			b.WriteString(`\057`)
+		case ';':
+			b.WriteString(`\073`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteString(`")`)
+
+	return b.String()
+}
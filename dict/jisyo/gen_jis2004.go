@@ -0,0 +1,140 @@
+//go:build ignore
+
+// This program generates jis2004_table.go from the EUC-JIS-2004 mapping in
+// testdata/euc-jis-2004-std.txt. Run it by go generate.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	input  = "testdata/euc-jis-2004-std.txt"
+	output = "jis2004_table.go"
+)
+
+func main() {
+	single, pairs, err := readMapping(input)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by gen_jis2004.go from %s. DO NOT EDIT.\n\n", input)
+	buf.WriteString("package jisyo\n\n")
+	buf.WriteString(`// jis0213 maps the index of a code of JIS X 0213, (plane-1)*94*94 +
+// (row-1)*94 + (cell-1), to its character. The codes of two characters
+// are in jis0213Pairs instead.
+var jis0213 = [2 * 94 * 94]rune{
+`)
+	n := 0
+	for i, r := range single {
+		if r == 0 {
+			continue
+		}
+		if n%6 == 0 {
+			buf.WriteByte('\t')
+		} else {
+			buf.WriteByte(' ')
+		}
+		fmt.Fprintf(&buf, "%d: 0x%04X,", i, r)
+		if n++; n%6 == 0 {
+			buf.WriteByte('\n')
+		}
+	}
+	if n%6 != 0 {
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(`}
+
+// jis0213Pairs maps the index of a code of JIS X 0213 to the pair of
+// characters of it, such as "か" and the combining semi-voiced sound mark.
+var jis0213Pairs = map[int][2]rune{
+`)
+	for i, p := range pairs {
+		if p[0] != 0 {
+			fmt.Fprintf(&buf, "\t%d: {0x%04X, 0x%04X},\n", i, p[0], p[1])
+		}
+	}
+	buf.WriteString("}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(output, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// readMapping reads the lines of the mapping such as "0xA1A1\tU+3000" and
+// "0x8FA1A1\tU+20089", and returns the characters and the pairs of
+// characters of the codes by their indexes.
+func readMapping(name string) (single []rune, pairs [][2]rune, err error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	single = make([]rune, 2*94*94)
+	pairs = make([][2]rune, 2*94*94)
+	s := bufio.NewScanner(file)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 || !strings.HasPrefix(fields[1], "U+") {
+			return nil, nil, fmt.Errorf("%s:%d: invalid line", name, n)
+		}
+
+		code, err := strconv.ParseUint(strings.TrimPrefix(fields[0], "0x"), 16, 32)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s:%d: invalid code: %w", name, n, err)
+		}
+		plane := 0
+		if code>>16 == 0x8f {
+			plane = 1
+			code &= 0xffff
+		}
+		c0, c1 := code>>8, code&0xff
+		if code>>16 != 0 || c0 < 0xa1 || c0 > 0xfe || c1 < 0xa1 || c1 > 0xfe {
+			return nil, nil, fmt.Errorf("%s:%d: code out of JIS X 0213", name, n)
+		}
+		i := plane*94*94 + int(c0-0xa1)*94 + int(c1-0xa1)
+
+		var runes []rune
+		for _, u := range strings.Split(strings.TrimPrefix(fields[1], "U+"), "+") {
+			r, err := strconv.ParseUint(u, 16, 32)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s:%d: invalid character: %w", name, n, err)
+			}
+			runes = append(runes, rune(r))
+		}
+		switch len(runes) {
+		case 1:
+			single[i] = runes[0]
+		case 2:
+			pairs[i] = [2]rune{runes[0], runes[1]}
+		default:
+			return nil, nil, fmt.Errorf("%s:%d: too many characters", name, n)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return single, pairs, nil
+}
@@ -0,0 +1,212 @@
+package jisyo
+
+//go:generate go run gen_jis2004.go
+
+import (
+	"errors"
+	"sync"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+)
+
+// EUCJIS2004 is the EUC-JIS-2004 encoding of JIS X 0213, such as of
+// SKK-JISYO.JIS2004. Unlike EUC-JP, the codes after 0x8F are of the plane
+// 2 of JIS X 0213 rather than of JIS X 0212, and some codes are of two
+// characters, such as "か" with the combining semi-voiced sound mark.
+var EUCJIS2004 encoding.Encoding = eucJIS2004{}
+
+type eucJIS2004 struct{}
+
+func (eucJIS2004) NewDecoder() *encoding.Decoder {
+	return &encoding.Decoder{Transformer: jis2004Decoder{}}
+}
+
+func (eucJIS2004) NewEncoder() *encoding.Encoder {
+	return &encoding.Encoder{Transformer: jis2004Encoder{}}
+}
+
+func (eucJIS2004) String() string {
+	return "EUC-JIS-2004"
+}
+
+// errUnsupportedRune is returned by the encoder for a character not in
+// JIS X 0213.
+var errUnsupportedRune = errors.New("encoding: rune not supported by encoding.")
+
+type jis2004Decoder struct {
+	transform.NopResetter
+}
+
+func (jis2004Decoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		var r, r2 rune
+		size := 1
+		switch c0 := src[nSrc]; {
+		case c0 < utf8.RuneSelf:
+			r = rune(c0)
+		case c0 == 0x8e:
+			size = 2
+			if nSrc+1 >= len(src) {
+				break
+			}
+			r = utf8.RuneError
+			if c1 := src[nSrc+1]; c1 >= 0xa1 && c1 <= 0xdf {
+				r = rune(c1) - 0xa1 + 0xff61
+			} else {
+				size = 1
+			}
+		case c0 == 0x8f:
+			size = 3
+			if nSrc+2 >= len(src) {
+				break
+			}
+			r, r2, size = decodeJIS0213(1, src[nSrc+1], src[nSrc+2])
+			if size > 0 {
+				size++
+			} else {
+				size = 1
+			}
+		case c0 >= 0xa1 && c0 <= 0xfe:
+			size = 2
+			if nSrc+1 >= len(src) {
+				break
+			}
+			r, r2, size = decodeJIS0213(0, c0, src[nSrc+1])
+			if size == 0 {
+				size = 1
+			}
+		default:
+			r = utf8.RuneError
+		}
+
+		if nSrc+size > len(src) {
+			if !atEOF {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			r, r2, size = utf8.RuneError, 0, 1
+		}
+		n := utf8.RuneLen(r)
+		if r2 != 0 {
+			n += utf8.RuneLen(r2)
+		}
+		if nDst+n > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += utf8.EncodeRune(dst[nDst:], r)
+		if r2 != 0 {
+			nDst += utf8.EncodeRune(dst[nDst:], r2)
+		}
+		nSrc += size
+	}
+
+	return nDst, nSrc, nil
+}
+
+// decodeJIS0213 returns the characters of the code c0 c1 of plane (0 or
+// 1) of JIS X 0213, and 2, the size of the code, or 0 if c1 is not a byte
+// of a code. The character is utf8.RuneError if the code is not defined.
+func decodeJIS0213(plane int, c0, c1 byte) (rune, rune, int) {
+	if c0 < 0xa1 || c0 > 0xfe || c1 < 0xa1 || c1 > 0xfe {
+		return utf8.RuneError, 0, 0
+	}
+
+	i := plane*94*94 + int(c0-0xa1)*94 + int(c1-0xa1)
+	if r := jis0213[i]; r != 0 {
+		return r, 0, 2
+	}
+	if p, ok := jis0213Pairs[i]; ok {
+		return p[0], p[1], 2
+	}
+
+	return utf8.RuneError, 0, 2
+}
+
+var (
+	jis0213EncodeOnce  sync.Once
+	jis0213Encode      map[rune]int
+	jis0213EncodePairs map[[2]rune]int
+)
+
+// initJIS0213Encode makes the maps of the characters to the indexes of
+// the codes of JIS X 0213, the first one of those of the same character.
+func initJIS0213Encode() {
+	jis0213Encode = make(map[rune]int, len(jis0213))
+	for i := len(jis0213) - 1; i >= 0; i-- {
+		if r := jis0213[i]; r != 0 {
+			jis0213Encode[r] = i
+		}
+	}
+	jis0213EncodePairs = make(map[[2]rune]int, len(jis0213Pairs))
+	for i, p := range jis0213Pairs {
+		jis0213EncodePairs[p] = i
+	}
+}
+
+type jis2004Encoder struct {
+	transform.NopResetter
+}
+
+func (jis2004Encoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	jis0213EncodeOnce.Do(initJIS0213Encode)
+
+	for nSrc < len(src) {
+		r, size := rune(src[nSrc]), 1
+		if r >= utf8.RuneSelf {
+			if !atEOF && !utf8.FullRune(src[nSrc:]) {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			r, size = utf8.DecodeRune(src[nSrc:])
+		}
+
+		var code []byte
+		switch {
+		case r < utf8.RuneSelf:
+			code = []byte{byte(r)}
+		case r >= 0xff61 && r <= 0xff9f:
+			code = []byte{0x8e, byte(r - 0xff61 + 0xa1)}
+		default:
+			// a character followed by a combining mark may be a code
+			rest := src[nSrc+size:]
+			if !atEOF && !utf8.FullRune(rest) && isPairHead(r) {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			i, ok := -1, false
+			if r2, size2 := utf8.DecodeRune(rest); size2 > 0 {
+				if i, ok = jis0213EncodePairs[[2]rune{r, r2}]; ok {
+					size += size2
+				}
+			}
+			if !ok {
+				if i, ok = jis0213Encode[r]; !ok {
+					return nDst, nSrc, errUnsupportedRune
+				}
+			}
+			code = []byte{byte(i/94%94) + 0xa1, byte(i%94) + 0xa1}
+			if i >= 94*94 {
+				code = append([]byte{0x8f}, code...)
+			}
+		}
+
+		if nDst+len(code) > len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += copy(dst[nDst:], code)
+		nSrc += size
+	}
+
+	return nDst, nSrc, nil
+}
+
+// isPairHead reports whether r is the first character of a code of two
+// characters.
+func isPairHead(r rune) bool {
+	for p := range jis0213EncodePairs {
+		if p[0] == r {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,120 @@
+package jisyo
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestEUCJIS2004Decode(t *testing.T) {
+	tests := []struct {
+		desc string
+		src  string
+		want string
+	}{
+		{"ascii", "skk", "skk"},
+		{"jis x 0208", "\xb4\xc1\xbb\xfa", "漢字"},
+		{"halfwidth katakana", "\x8e\xb1", "ｱ"},
+		{"plane 1 extension", "\xae\xa1", "俱"},
+		{"plane 1 extension of a symbol", "\xa9\xa1", "€"},
+		{"plane 2", "\x8f\xa1\xa1", "\U00020089"},
+		{"last code of plane 2", "\x8f\xfe\xf6", "\U0002A6B2"},
+		{"pair of kana", "\xa4\xf7", "か゚"},
+		{"pair of katakana", "\xa5\xf7", "カ゚"},
+		{"pair of a latin letter", "\xab\xc4", "æ̀"},
+		{"pair of tone letters", "\xab\xe5", "˩˥"},
+		{"tone letter alone", "\xab\xe4", "˩"},
+		{"row of jis x 0212 only", "\x8f\xb0\xa1", "�"},
+		{"truncated code", "\xb4", "�"},
+	}
+	for _, tt := range tests {
+		got, err := EUCJIS2004.NewDecoder().String(tt.src)
+		if err != nil {
+			t.Errorf("%s: Decode(%q) error = %v", tt.desc, tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: Decode(%q) = %q, want %q", tt.desc, tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestEUCJIS2004Encode(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"漢字", "\xb4\xc1\xbb\xfa"},
+		{"俱", "\xae\xa1"},
+		{"\U00020089", "\x8f\xa1\xa1"},
+		{"か゚", "\xa4\xf7"},
+		{"か", "\xa4\xab"},
+		{"˩˥", "\xab\xe5"},
+		{"ｱ", "\x8e\xb1"},
+	}
+	for _, tt := range tests {
+		got, err := EUCJIS2004.NewEncoder().String(tt.src)
+		if err != nil {
+			t.Errorf("Encode(%q) error = %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Encode(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+
+	if _, err := EUCJIS2004.NewEncoder().String("\U0001F600"); err == nil {
+		t.Error("Encode() of a character not in JIS X 0213 succeeded")
+	}
+}
+
+// TestJIS0213Table checks that the table is generated from the mapping in
+// testdata, by decoding each code of the mapping.
+func TestJIS0213Table(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "euc-jis-2004-std.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "0x") {
+			continue
+		}
+		code, err := hex.DecodeString(strings.TrimPrefix(fields[0], "0x"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want []rune
+		for _, u := range strings.Split(strings.TrimPrefix(fields[1], "U+"), "+") {
+			r, err := strconv.ParseUint(u, 16, 32)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want = append(want, rune(r))
+		}
+
+		got, err := EUCJIS2004.NewDecoder().Bytes(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("Decode(%s) = %q, want %q", fields[0], got, string(want))
+		}
+		n++
+	}
+
+	var entries int
+	for _, r := range jis0213 {
+		if r != 0 {
+			entries++
+		}
+	}
+	if entries+len(jis0213Pairs) != n {
+		t.Errorf("the table has %d codes, want %d", entries+len(jis0213Pairs), n)
+	}
+}
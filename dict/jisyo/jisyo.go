@@ -0,0 +1,353 @@
+// Package jisyo parses SKK-JISYO dictionary files.
+package jisyo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/transform"
+)
+
+// Entry is an entry of a SKK-JISYO file, a key and its candidates.
+type Entry struct {
+	Key        string
+	Candidates []Candidate
+
+	// Okuri reports whether the entry is okuri-ari, whose key ends with
+	// the consonant of its okurigana, such as "おくr".
+	Okuri bool
+
+	// Blocks are the okuri blocks of an okuri-ari entry, such as
+	// "[る/送/]", which list the candidates for each okurigana.
+	Blocks []OkuriBlock
+
+	// Line is the line number of the entry in the file.
+	Line int
+}
+
+type Candidate struct {
+	Text       string
+	Annotation string
+}
+
+// OkuriBlock is the candidates of an okuri-ari entry for an okurigana.
+type OkuriBlock struct {
+	Okuri      string
+	Candidates []Candidate
+}
+
+// SyntaxError is a malformed entry.
+type SyntaxError struct {
+	Line   int
+	Reason string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+}
+
+// The markers of the sections of okuri-ari and okuri-nasi entries.
+const (
+	OkuriAriMarker  = ";; okuri-ari entries."
+	OkuriNasiMarker = ";; okuri-nasi entries."
+)
+
+// IsOkuriAri reports whether key looks like the key of an okuri-ari entry,
+// that is, a lowercase letter after a non-ASCII character, such as "おくr".
+// It is used for the entries out of the sections.
+func IsOkuriAri(key string) bool {
+	n := len(key)
+	if n < 2 || key[n-1] < 'a' || key[n-1] > 'z' {
+		return false
+	}
+	r, _ := utf8.DecodeLastRuneInString(key[:n-1])
+
+	return r >= utf8.RuneSelf
+}
+
+// SplitOkurigana splits a key of an okuri-ari entry followed by its
+// okurigana, such as "おくrる", into the key "おくr" and the okurigana
+// "る". It reports false if key is not of the form.
+func SplitOkurigana(key string) (base, okuri string, ok bool) {
+	for i := len(key) - 1; i > 0; i-- {
+		if key[i] < utf8.RuneSelf {
+			if i == len(key)-1 || !IsOkuriAri(key[:i+1]) {
+				return "", "", false
+			}
+			return key[:i+1], key[i+1:], true
+		}
+	}
+
+	return "", "", false
+}
+
+// DefaultEncoding is the encoding of the files without a magic comment.
+const DefaultEncoding = "euc-jp"
+
+var magicCommentRegex = regexp.MustCompile(`-\*-.*[ \t]coding:[ \t]*([^ \t;]+?)[ \t;].*-\*-`)
+
+// DetectEncoding returns the encoding in the magic comment of line, such as
+// ";; -*- coding: utf-8 -*-", or DefaultEncoding if there is none.
+func DetectEncoding(line string) string {
+	if matches := magicCommentRegex.FindStringSubmatch(line); len(matches) > 1 {
+		return matches[1]
+	}
+
+	return DefaultEncoding
+}
+
+// LookupEncoding returns the encoding named in a magic comment.
+func LookupEncoding(enc string) (encoding.Encoding, error) {
+	switch enc {
+	case "euc-jp":
+		return japanese.EUCJP, nil
+	case "euc-jis-2004":
+		return EUCJIS2004, nil
+	case "sjis":
+		return japanese.ShiftJIS, nil
+	case "iso-2022-jp", "junet":
+		return japanese.ISO2022JP, nil
+	case "utf-8":
+		return encoding.Nop, nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding: %s", enc)
+	}
+}
+
+type Option func(*Decoder)
+
+// WithEncoding makes a Decoder decode the file from enc, such as "euc-jp",
+// instead of from the encoding in its magic comment.
+func WithEncoding(enc string) Option {
+	return func(d *Decoder) {
+		d.enc = enc
+	}
+}
+
+// Decoder reads the entries of a SKK-JISYO file one by one.
+type Decoder struct {
+	src  io.Reader
+	r    *bufio.Reader
+	enc  string
+	line int
+	err  error
+
+	// section is the marker of the current section, if any
+	section string
+}
+
+// NewDecoder returns a Decoder reading from r. The encoding is detected
+// from the magic comment of the first line, unless WithEncoding is given.
+func NewDecoder(r io.Reader, opts ...Option) *Decoder {
+	d := &Decoder{src: r}
+	for _, opt := range opts {
+		opt(d)
+	}
+
+	return d
+}
+
+// Encoding returns the encoding of the file, which is known after the
+// first call of Next.
+func (d *Decoder) Encoding() string {
+	return d.enc
+}
+
+// Next returns the next entry, or io.EOF at the end of the file. Empty
+// lines and comments are skipped. If the entry is malformed, it returns a
+// *SyntaxError, and the next call continues with the next line.
+func (d *Decoder) Next() (Entry, error) {
+	if d.err != nil {
+		return Entry{}, d.err
+	}
+	if d.r == nil {
+		if err := d.init(); err != nil {
+			d.err = err
+			return Entry{}, err
+		}
+	}
+
+	for {
+		line, err := d.r.ReadString('\n')
+		if line != "" {
+			d.line++
+			if marker := strings.TrimSpace(line); marker == OkuriAriMarker || marker == OkuriNasiMarker {
+				d.section = marker
+				continue
+			}
+			e, perr := ParseLine(line)
+			if perr != nil {
+				perr.(*SyntaxError).Line = d.line
+				return Entry{}, perr
+			}
+			if e.Key != "" {
+				e.Line = d.line
+				if d.section != "" {
+					e.Okuri = d.section == OkuriAriMarker
+				}
+				return e, nil
+			}
+		}
+		if err != nil {
+			d.err = err
+			return Entry{}, err
+		}
+	}
+}
+
+// init detects the encoding from the first line and sets up the reader.
+func (d *Decoder) init() error {
+	br := bufio.NewReader(d.src)
+	first, err := br.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	if d.enc == "" {
+		d.enc = DetectEncoding(first)
+	}
+	e, err := LookupEncoding(d.enc)
+	if err != nil {
+		return err
+	}
+
+	// the first line may be an entry as well
+	r := io.MultiReader(strings.NewReader(first), br)
+	if e == encoding.Nop {
+		d.r = bufio.NewReader(r)
+	} else {
+		d.r = bufio.NewReader(transform.NewReader(r, e.NewDecoder()))
+	}
+
+	return nil
+}
+
+// ParseLine parses a decoded line of a SKK-JISYO file, such as
+// "かんじ /漢字/感じ;feeling/". CR of CRLF and the spaces around the line
+// are ignored. Okuri of the Entry is guessed by IsOkuriAri, as the section
+// of the line is not known. For an empty line or a comment, it returns an
+// Entry with an empty Key. For a malformed line, it returns a
+// *SyntaxError.
+func ParseLine(line string) (Entry, error) {
+	line = strings.Trim(line, " \t\r\n")
+	if line == "" || line[0] == ';' {
+		return Entry{}, nil
+	}
+
+	i := strings.IndexAny(line, " \t")
+	if i < 0 {
+		return Entry{}, &SyntaxError{Reason: "missing candidates"}
+	}
+	key := line[:i]
+	block := strings.TrimLeft(line[i:], " \t")
+	if !validEncoding(key) || !validEncoding(block) {
+		return Entry{}, &SyntaxError{Reason: "invalid encoding sequence"}
+	}
+	if len(block) < 2 || block[0] != '/' || block[len(block)-1] != '/' {
+		return Entry{}, &SyntaxError{Reason: "bad candidate block"}
+	}
+
+	parts := strings.Split(block[1:len(block)-1], "/")
+	if reason := check(parts); reason != "" {
+		return Entry{}, &SyntaxError{Reason: reason}
+	}
+	e := Entry{
+		Key:        key,
+		Candidates: make([]Candidate, 0, len(parts)),
+		Okuri:      IsOkuriAri(key),
+	}
+	var ob *OkuriBlock
+	for _, c := range parts {
+		switch {
+		case c[0] == '[':
+			e.Blocks = append(e.Blocks, OkuriBlock{Okuri: c[1:]})
+			ob = &e.Blocks[len(e.Blocks)-1]
+		case c == "]":
+			ob = nil
+		case ob != nil:
+			text, annotation := SplitAnnotation(c)
+			ob.Candidates = append(ob.Candidates, Candidate{Text: text, Annotation: annotation})
+		default:
+			text, annotation := SplitAnnotation(c)
+			e.Candidates = append(e.Candidates, Candidate{Text: text, Annotation: annotation})
+		}
+	}
+
+	return e, nil
+}
+
+// ParseCandidates parses candidates in the form "/cand1/cand2;annotation/".
+// Empty candidates and okuri blocks, such as "[る/送/]", are skipped; the
+// candidates in the blocks are also outside them.
+func ParseCandidates(block string) []Candidate {
+	candidates := make([]Candidate, 0, strings.Count(block, "/"))
+	inBlock := false
+	for _, c := range strings.Split(block, "/") {
+		switch {
+		case c == "":
+			continue
+		case c[0] == '[':
+			inBlock = true
+			continue
+		case c == "]":
+			inBlock = false
+			continue
+		case inBlock:
+			continue
+		}
+		text, annotation := SplitAnnotation(c)
+		candidates = append(candidates, Candidate{Text: text, Annotation: annotation})
+	}
+
+	return candidates
+}
+
+// SplitAnnotation splits a candidate in the form "text;annotation".
+func SplitAnnotation(candidate string) (text, annotation string) {
+	i := strings.IndexByte(candidate, ';')
+	if i < 0 {
+		return candidate, ""
+	}
+
+	return candidate[:i], candidate[i+1:]
+}
+
+// validEncoding reports whether s is valid UTF-8 without the replacement
+// characters of the bytes that fail to decode.
+func validEncoding(s string) bool {
+	return utf8.ValidString(s) && !strings.ContainsRune(s, utf8.RuneError)
+}
+
+// check returns the reason why the candidates of an entry are malformed,
+// or an empty string if they are well-formed.
+func check(candidates []string) string {
+	okuri := false
+	for _, c := range candidates {
+		switch {
+		case c == "":
+			return "empty candidate"
+		case c[0] == '[':
+			if okuri {
+				return "nested okuri group"
+			}
+			okuri = true
+		case c == "]":
+			if !okuri {
+				return "unmatched okuri group end"
+			}
+			okuri = false
+		}
+	}
+	if okuri {
+		return "unterminated okuri group"
+	}
+
+	return ""
+}
@@ -0,0 +1,95 @@
+package dict
+
+import "context"
+
+// Lazy is a Searcher that loads another Searcher in the background, so a
+// server can accept connections while its dictionaries are loading. Until
+// the Searcher is loaded, nothing is found, and nothing is found either if
+// it fails to load.
+type Lazy struct {
+	ready    chan struct{}
+	searcher Searcher
+	err      error
+}
+
+var _ Searcher = (*Lazy)(nil)
+
+// NewLazy returns a Lazy that calls load in a new goroutine.
+func NewLazy(load func() (Searcher, error)) *Lazy {
+	l := &Lazy{
+		ready: make(chan struct{}),
+	}
+	go func() {
+		defer close(l.ready)
+		l.searcher, l.err = load()
+		if l.err != nil {
+			l.searcher = nil
+		}
+	}()
+
+	return l
+}
+
+// Ready returns a channel that is closed when loading ends.
+func (l *Lazy) Ready() <-chan struct{} {
+	return l.ready
+}
+
+// Wait waits until loading ends, and returns the error of loading.
+func (l *Lazy) Wait(ctx context.Context) error {
+	select {
+	case <-l.ready:
+		return l.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Err returns the error of loading, or nil if loading has not ended.
+func (l *Lazy) Err() error {
+	select {
+	case <-l.ready:
+		return l.err
+	default:
+		return nil
+	}
+}
+
+// Searcher returns the loaded Searcher, or nil if it is not loaded.
+func (l *Lazy) Searcher() Searcher {
+	select {
+	case <-l.ready:
+		return l.searcher
+	default:
+		return nil
+	}
+}
+
+func (l *Lazy) Search(ctx context.Context, key string) ([]Candidate, error) {
+	s := l.Searcher()
+	if s == nil {
+		return nil, nil
+	}
+
+	return s.Search(ctx, key)
+}
+
+func (l *Lazy) Complete(ctx context.Context, prefix string) ([]string, error) {
+	s := l.Searcher()
+	if s == nil {
+		return nil, nil
+	}
+
+	return s.Complete(ctx, prefix)
+}
+
+// Stats returns the Stats of the loaded Searcher, or zero if it is not
+// loaded.
+func (l *Lazy) Stats() Stats {
+	s := l.Searcher()
+	if s == nil {
+		return Stats{}
+	}
+
+	return s.Stats()
+}
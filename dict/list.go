@@ -0,0 +1,196 @@
+package dict
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Source is a dictionary to load.
+type Source struct {
+	// Name is a file name, a URL, a directory or a glob pattern.
+	Name string
+
+	// Encoding is the encoding of the file, such as "euc-jp". Empty means
+	// the encoding in the magic comment of the file.
+	Encoding string
+
+	// Priority orders the dictionaries; the ones of higher Priority are
+	// loaded first.
+	Priority int
+
+	// Tag is appended to the annotations of the candidates, as "[Tag]".
+	// Empty means no tag, or the short name of the file with TagSources.
+	Tag string
+
+	// Writable marks the user dictionary, which is opened by
+	// OpenUserDictionary rather than with the others. See SplitSources.
+	Writable bool
+
+	// IgnoreCase makes the keys of the file match the search keys
+	// regardless of case, such as "SKK" and "skk" of an abbrev dictionary.
+	IgnoreCase bool
+}
+
+// shortName returns the short name of the named dictionary file, such as
+// "L" of SKK-JISYO.L.gz.
+func shortName(name string) string {
+	name = filepath.Base(name)
+	for _, ext := range []string{".gz", ".bz2", ".xz"} {
+		name = strings.TrimSuffix(name, ext)
+	}
+	if rest, ok := strings.CutPrefix(name, "SKK-JISYO."); ok && rest != "" {
+		return rest
+	}
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		name = name[:i]
+	}
+
+	return name
+}
+
+func sourcesOf(names []string) []Source {
+	sources := make([]Source, len(names))
+	for i, name := range names {
+		sources[i] = Source{Name: name}
+	}
+
+	return sources
+}
+
+// sortSources returns a copy of sources sorted by Priority, keeping the
+// order of the same Priority.
+func sortSources(sources []Source) []Source {
+	sorted := append([]Source(nil), sources...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority > sorted[j].Priority
+	})
+
+	return sorted
+}
+
+// ReadList reads a dictionary list, which has a Source per line in the
+// form:
+//
+//	name [encoding=enc] [priority=n] [tag=t] [writable=true] [ignorecase=true]
+//
+// Empty lines and lines starting with '#' are skipped. A name containing
+// spaces can be quoted as a Go string.
+func ReadList(r io.Reader) ([]Source, error) {
+	var sources []Source
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		src, err := parseListLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid dictionary list at line %d: %w", n, err)
+		}
+		sources = append(sources, src)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return sources, nil
+}
+
+func parseListLine(line string) (Source, error) {
+	var src Source
+	var rest string
+	if line[0] == '"' {
+		quoted, err := strconv.QuotedPrefix(line)
+		if err != nil {
+			return Source{}, fmt.Errorf("invalid name: %s", line)
+		}
+		src.Name, _ = strconv.Unquote(quoted)
+		rest = line[len(quoted):]
+	} else {
+		i := strings.IndexAny(line, " \t")
+		if i < 0 {
+			i = len(line)
+		}
+		src.Name, rest = line[:i], line[i:]
+	}
+
+	for _, field := range strings.Fields(rest) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return Source{}, fmt.Errorf("invalid annotation: %s", field)
+		}
+		switch key {
+		case "encoding":
+			if _, err := lookupEncoding(value); err != nil {
+				return Source{}, err
+			}
+			src.Encoding = value
+		case "priority":
+			p, err := strconv.Atoi(value)
+			if err != nil {
+				return Source{}, fmt.Errorf("invalid priority: %s", value)
+			}
+			src.Priority = p
+		case "tag":
+			src.Tag = value
+		case "writable":
+			w, err := strconv.ParseBool(value)
+			if err != nil {
+				return Source{}, fmt.Errorf("invalid writable: %s", value)
+			}
+			src.Writable = w
+		case "ignorecase":
+			ic, err := strconv.ParseBool(value)
+			if err != nil {
+				return Source{}, fmt.Errorf("invalid ignorecase: %s", value)
+			}
+			src.IgnoreCase = ic
+		default:
+			return Source{}, fmt.Errorf("unknown annotation: %s", key)
+		}
+	}
+
+	return src, nil
+}
+
+// ReadListFile reads the named dictionary list file as ReadList. Relative
+// file names in the list are relative to the directory of the list.
+func ReadListFile(name string) ([]Source, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dictionary list %s: %w", name, err)
+	}
+	defer f.Close()
+
+	sources, err := ReadList(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dictionary list %s: %w", name, err)
+	}
+
+	dir := filepath.Dir(name)
+	for i, src := range sources {
+		if !IsURL(src.Name) && !filepath.IsAbs(src.Name) {
+			sources[i].Name = filepath.Join(dir, src.Name)
+		}
+	}
+
+	return sources, nil
+}
+
+// OpenList loads the dictionaries of the named list file into a new
+// Dictionary, as OpenSources.
+func OpenList(name string, opts ...Option) (*Dictionary, error) {
+	sources, err := ReadListFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return OpenSources(sources, opts...)
+}
@@ -0,0 +1,268 @@
+package dict
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kechako/goskkserv/log"
+)
+
+// Loader loads dictionary files, sharing a Dictionary among all the users
+// of the same file.
+type Loader struct {
+	// CacheDir is the directory to keep the parsed SKK-JISYO files in. A
+	// file not changed since it is cached is loaded from the cache instead
+	// of being parsed. Empty disables the cache.
+	CacheDir string
+
+	// Fetcher downloads the dictionaries named by URLs. Nil means
+	// a Fetcher with the default settings.
+	Fetcher *Fetcher
+
+	Logger log.Logger
+
+	mu        sync.Mutex
+	dicts     map[string]*Dictionary
+	searchers map[string]Searcher
+	// urls maps the URLs of the downloaded dictionaries to their files
+	urls map[string]string
+}
+
+// Open returns the Dictionary of the named file, loading it if it is not
+// loaded yet. name may be a URL, whose file is downloaded first.
+func (l *Loader) Open(name string) (*Dictionary, error) {
+	name, err := l.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := filepath.Abs(name)
+	if err != nil {
+		path = name
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if d, ok := l.dicts[path]; ok {
+		return d, nil
+	}
+
+	d := &Dictionary{onParseError: l.warnParse}
+	if l.CacheDir != "" {
+		err = d.addCached(name, l.CacheDir)
+	} else {
+		err = d.Add(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if l.dicts == nil {
+		l.dicts = make(map[string]*Dictionary)
+	}
+	l.dicts[path] = d
+
+	return d, nil
+}
+
+// OpenChain opens the named files and returns a Chain of them in order. As
+// OpenDictionary, directories and glob patterns are expanded, and files
+// that fail to load do not stop the others from being loaded. Names of the
+// backends registered by RegisterBackend, such as "skkserv://host:1178",
+// are opened by them, so local dictionaries can be layered on top of a
+// remote server.
+func (l *Loader) OpenChain(names []string, opts ...Option) (Chain, error) {
+	o := newOptions(opts)
+	sources, errs := o.expand(sourcesOf(names))
+
+	var chain Chain
+	for _, src := range sources {
+		d, err := l.open(src.Name)
+		if err != nil {
+			errs = o.fail(errs, src.Name, err)
+			continue
+		}
+		chain = append(chain, d)
+	}
+
+	return chain, errors.Join(errs...)
+}
+
+// open opens the named backend, or the named file with the format
+// registered for its extension, or as a SKK-JISYO file if no format is
+// registered.
+func (l *Loader) open(name string) (Searcher, error) {
+	path := name
+	open := lookupBackend(name)
+	if open == nil {
+		var err error
+		if name, err = l.resolve(name); err != nil {
+			return nil, err
+		}
+
+		if open = lookupFormat(name); open == nil {
+			return l.Open(name)
+		}
+
+		if path, err = filepath.Abs(name); err != nil {
+			path = name
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if s, ok := l.searchers[path]; ok {
+		return s, nil
+	}
+
+	s, err := open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.searchers == nil {
+		l.searchers = make(map[string]Searcher)
+	}
+	l.searchers[path] = s
+
+	return s, nil
+}
+
+// resolve returns the local file name of name, downloading it if name is a
+// URL.
+func (l *Loader) resolve(name string) (string, error) {
+	if !IsURL(name) {
+		return name, nil
+	}
+
+	file, err := l.fetcher().Fetch(context.Background(), name)
+	if err != nil {
+		return "", err
+	}
+
+	l.mu.Lock()
+	if l.urls == nil {
+		l.urls = make(map[string]string)
+	}
+	l.urls[name] = file
+	l.mu.Unlock()
+
+	return file, nil
+}
+
+// Update downloads the dictionaries opened from URLs again if they are
+// changed, and reloads the changed ones. A Dictionary is reloaded at once,
+// so searches see either the old entries or the new ones. Dictionaries of
+// other formats are not reloaded.
+func (l *Loader) Update(ctx context.Context) error {
+	l.mu.Lock()
+	urls := make([]string, 0, len(l.urls))
+	for u := range l.urls {
+		urls = append(urls, u)
+	}
+	l.mu.Unlock()
+	sort.Strings(urls)
+
+	var errs []error
+	for _, u := range urls {
+		changed, err := l.fetcher().Update(ctx, u)
+		if err != nil {
+			l.logger().Warnf("failed to update dictionary %s: %v", u, err)
+			errs = append(errs, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+
+		if err := l.reload(u); err != nil {
+			l.logger().Warnf("failed to update dictionary %s: %v", u, err)
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// AutoUpdate calls Update every interval until ctx is done.
+func (l *Loader) AutoUpdate(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.Update(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// warnParse logs a malformed entry skipped.
+func (l *Loader) warnParse(err *ParseError) error {
+	l.logger().Warnf("skipped malformed dictionary entry: %v", err)
+
+	return nil
+}
+
+// reload reloads the dictionary downloaded from u.
+func (l *Loader) reload(u string) error {
+	l.mu.Lock()
+	name := l.urls[u]
+	path, err := filepath.Abs(name)
+	if err != nil {
+		path = name
+	}
+	d := l.dicts[path]
+	_, opened := l.searchers[path]
+	l.mu.Unlock()
+
+	if d == nil {
+		if opened {
+			l.logger().Warnf("dictionary %s is updated, but it cannot be reloaded", u)
+		}
+		return nil
+	}
+
+	before := d.Stats()
+
+	tx := d.Begin()
+	defer tx.Rollback()
+
+	tx.Clear()
+	if err := tx.AddFile(name); err != nil {
+		return err
+	}
+	tx.Commit()
+
+	after := d.Stats()
+	l.logger().Infof("dictionary %s is updated: %d keys (%+d), %d candidates (%+d)",
+		u, after.Keys, after.Keys-before.Keys, after.Candidates, after.Candidates-before.Candidates)
+
+	return nil
+}
+
+func (l *Loader) fetcher() *Fetcher {
+	if l.Fetcher != nil {
+		return l.Fetcher
+	}
+
+	return &Fetcher{}
+}
+
+var nopLogger = log.NewNop()
+
+func (l *Loader) logger() log.Logger {
+	if l.Logger != nil {
+		return l.Logger
+	}
+
+	return nopLogger
+}
@@ -0,0 +1,60 @@
+package dict
+
+import "strings"
+
+// AnnotationMerge decides the annotation of a candidate found in more than
+// one dictionary, from the annotation kept so far and the different one of
+// a later dictionary. The annotation kept so far may be empty.
+type AnnotationMerge func(kept, later string) string
+
+// KeepFirst keeps the annotation of the first dictionary that has one. It
+// is the default.
+func KeepFirst(kept, later string) string {
+	if kept != "" {
+		return kept
+	}
+
+	return later
+}
+
+// PreferLongest keeps the longest annotation, the earliest one of those of
+// the same length.
+func PreferLongest(kept, later string) string {
+	if len(later) > len(kept) {
+		return later
+	}
+
+	return kept
+}
+
+// JoinAnnotations returns an AnnotationMerge that joins all the different
+// annotations in order with sep, such as "|".
+func JoinAnnotations(sep string) AnnotationMerge {
+	return func(kept, later string) string {
+		if kept == "" {
+			return later
+		}
+		for _, a := range strings.Split(kept, sep) {
+			if a == later {
+				return kept
+			}
+		}
+
+		return kept + sep + later
+	}
+}
+
+// mergeAnnotation merges annotation into the annotation of c by m, or by
+// KeepFirst if m is nil. It reports false if the annotation is not changed.
+func mergeAnnotation(m AnnotationMerge, c Candidate, annotation string) (string, bool) {
+	kept := c.Annotation()
+	if annotation == "" || annotation == kept {
+		return kept, false
+	}
+	if m == nil {
+		m = KeepFirst
+	}
+	merged := m(kept, annotation)
+
+	return merged, merged != kept
+}
@@ -0,0 +1,63 @@
+// Package normalize provides the normalizations of the keys of
+// dictionaries, to be given to dict.NormalizeKeys and dict.NewNormalizer.
+package normalize
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Hiragana converts the katakana in s to hiragana, such as "カンジ" to
+// "かんじ". The katakana without hiragana, such as "ヷ", and the prolonged
+// sound mark are kept.
+func Hiragana(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'ァ' && r <= 'ヶ':
+			return r - 'ァ' + 'ぁ'
+		case r == 'ヽ' || r == 'ヾ':
+			return r - 'ヽ' + 'ゝ'
+		default:
+			return r
+		}
+	}, s)
+}
+
+// NFC normalizes s to the Unicode Normalization Form C, such as the
+// decomposed "が" to "が", so the strings of the different forms
+// match.
+func NFC(s string) string {
+	return norm.NFC.String(s)
+}
+
+// Narrow converts the full-width ASCII characters in s, such as "ＡＢＣ",
+// and the ideographic space to the half-width ones.
+func Narrow(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '！' && r <= '～':
+			return r - '！' + '!'
+		case r == '　':
+			return ' '
+		default:
+			return r
+		}
+	}, s)
+}
+
+// Wide converts the half-width ASCII characters in s to the full-width
+// ones, as the reverse of Narrow, for the dictionaries whose keys are in
+// full-width.
+func Wide(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '!' && r <= '~':
+			return r - '!' + '！'
+		case r == ' ':
+			return '　'
+		default:
+			return r
+		}
+	}, s)
+}
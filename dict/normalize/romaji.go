@@ -0,0 +1,99 @@
+package normalize
+
+import "strings"
+
+// romaji is the hiragana of the romaji syllables, of both Hepburn and
+// kunrei.
+var romaji = map[string]string{
+	"a": "あ", "i": "い", "u": "う", "e": "え", "o": "お",
+	"ka": "か", "ki": "き", "ku": "く", "ke": "け", "ko": "こ",
+	"kya": "きゃ", "kyu": "きゅ", "kyo": "きょ",
+	"sa": "さ", "si": "し", "shi": "し", "su": "す", "se": "せ", "so": "そ",
+	"sya": "しゃ", "syu": "しゅ", "syo": "しょ", "sha": "しゃ", "shu": "しゅ", "sho": "しょ", "she": "しぇ",
+	"ta": "た", "ti": "ち", "chi": "ち", "tu": "つ", "tsu": "つ", "te": "て", "to": "と",
+	"tya": "ちゃ", "tyu": "ちゅ", "tyo": "ちょ", "cha": "ちゃ", "chu": "ちゅ", "cho": "ちょ", "che": "ちぇ",
+	"na": "な", "ni": "に", "nu": "ぬ", "ne": "ね", "no": "の",
+	"nya": "にゃ", "nyu": "にゅ", "nyo": "にょ",
+	"ha": "は", "hi": "ひ", "hu": "ふ", "fu": "ふ", "he": "へ", "ho": "ほ",
+	"hya": "ひゃ", "hyu": "ひゅ", "hyo": "ひょ",
+	"fa": "ふぁ", "fi": "ふぃ", "fe": "ふぇ", "fo": "ふぉ",
+	"ma": "ま", "mi": "み", "mu": "む", "me": "め", "mo": "も",
+	"mya": "みゃ", "myu": "みゅ", "myo": "みょ",
+	"ya": "や", "yu": "ゆ", "yo": "よ",
+	"ra": "ら", "ri": "り", "ru": "る", "re": "れ", "ro": "ろ",
+	"rya": "りゃ", "ryu": "りゅ", "ryo": "りょ",
+	"wa": "わ", "wi": "ゐ", "we": "ゑ", "wo": "を",
+	"ga": "が", "gi": "ぎ", "gu": "ぐ", "ge": "げ", "go": "ご",
+	"gya": "ぎゃ", "gyu": "ぎゅ", "gyo": "ぎょ",
+	"za": "ざ", "zi": "じ", "ji": "じ", "zu": "ず", "ze": "ぜ", "zo": "ぞ",
+	"zya": "じゃ", "zyu": "じゅ", "zyo": "じょ", "ja": "じゃ", "ju": "じゅ", "jo": "じょ", "je": "じぇ",
+	"jya": "じゃ", "jyu": "じゅ", "jyo": "じょ",
+	"da": "だ", "di": "ぢ", "du": "づ", "de": "で", "do": "ど",
+	"dya": "ぢゃ", "dyu": "ぢゅ", "dyo": "ぢょ",
+	"ba": "ば", "bi": "び", "bu": "ぶ", "be": "べ", "bo": "ぼ",
+	"bya": "びゃ", "byu": "びゅ", "byo": "びょ",
+	"pa": "ぱ", "pi": "ぴ", "pu": "ぷ", "pe": "ぺ", "po": "ぽ",
+	"pya": "ぴゃ", "pyu": "ぴゅ", "pyo": "ぴょ",
+	"vu": "ゔ",
+	"xa": "ぁ", "xi": "ぃ", "xu": "ぅ", "xe": "ぇ", "xo": "ぉ",
+	"la": "ぁ", "li": "ぃ", "lu": "ぅ", "le": "ぇ", "lo": "ぉ",
+	"xya": "ゃ", "xyu": "ゅ", "xyo": "ょ", "lya": "ゃ", "lyu": "ゅ", "lyo": "ょ",
+	"xtu": "っ", "ltu": "っ", "xtsu": "っ", "ltsu": "っ", "xwa": "ゎ", "lwa": "ゎ",
+	"-": "ー",
+}
+
+// Romaji converts s in romaji, such as "kanji" or "kanzi", to hiragana,
+// such as "かんじ". A consonant left at the end is kept as the okurigana
+// of an okuri-ari key, such as "okur" to "おくr". s is returned as it is
+// if it is not in lower case romaji, so the keys in kana or of
+// abbreviations in upper case are not converted.
+func Romaji(s string) string {
+	if s == "" {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < 'a' && c != '-' && c != '\'' || c > 'z' {
+			return s
+		}
+
+		switch {
+		case c == 'n' && i+1 < len(s) && (s[i+1] == 'n' || s[i+1] == '\''):
+			b.WriteString("ん")
+			i += 2
+			continue
+		case c == 'n' && (i+1 == len(s) || !strings.ContainsRune("aiueoy", rune(s[i+1]))):
+			b.WriteString("ん")
+			i++
+			continue
+		case i+1 < len(s) && c == s[i+1] && !strings.ContainsRune("aiueo-'", rune(c)),
+			c == 't' && strings.HasPrefix(s[i+1:], "ch"):
+			b.WriteString("っ")
+			i++
+			continue
+		}
+
+		n := 4
+		for ; n > 0; n-- {
+			if i+n <= len(s) {
+				if kana, ok := romaji[s[i:i+n]]; ok {
+					b.WriteString(kana)
+					break
+				}
+			}
+		}
+		if n == 0 {
+			if i+1 < len(s) || c == '-' || c == '\'' {
+				return s
+			}
+			// okurigana
+			b.WriteByte(c)
+			n = 1
+		}
+		i += n
+	}
+
+	return b.String()
+}
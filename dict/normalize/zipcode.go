@@ -0,0 +1,39 @@
+package normalize
+
+// Zipcode converts a postal code, such as "100-0001" or "１００－０００１",
+// to the key of SKK-JISYO.zipcode, which is of the 7 digits, such as
+// "1000001". The keys other than postal codes are returned as they are.
+func Zipcode(s string) string {
+	digits := make([]byte, 0, 7)
+	hyphen := false
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits = append(digits, byte(r))
+		case r >= '０' && r <= '９':
+			digits = append(digits, byte(r-'０'+'0'))
+		case isHyphen(r) && len(digits) == 3 && !hyphen:
+			hyphen = true
+		default:
+			return s
+		}
+		if len(digits) > 7 {
+			return s
+		}
+	}
+	if len(digits) != 7 {
+		return s
+	}
+
+	return string(digits)
+}
+
+// isHyphen reports whether r is a hyphen of a postal code.
+func isHyphen(r rune) bool {
+	switch r {
+	case '-', '－', 'ー', '‐', '−', '‑', '–':
+		return true
+	}
+
+	return false
+}
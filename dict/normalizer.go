@@ -0,0 +1,57 @@
+package dict
+
+import "context"
+
+// Normalizer is a Searcher that searches another Searcher by the keys
+// normalized, such as by normalize.Hiragana, so the keys in different
+// forms find the same candidates. The key as it is is searched first, and
+// then the normalized one if it differs, and the candidates of both are
+// merged as Chain.
+type Normalizer struct {
+	searcher  Searcher
+	normalize []func(key string) string
+}
+
+var _ Searcher = (*Normalizer)(nil)
+
+// NewNormalizer returns a Normalizer of s, which normalizes the keys by
+// normalize in order.
+func NewNormalizer(s Searcher, normalize ...func(key string) string) *Normalizer {
+	return &Normalizer{searcher: s, normalize: normalize}
+}
+
+func (n *Normalizer) Search(ctx context.Context, key string) ([]Candidate, error) {
+	normalized := normalizeKey(n.normalize, key)
+	if normalized == key {
+		return n.searcher.Search(ctx, key)
+	}
+
+	return Chain{n.searcher, keySearcher{n.searcher, normalized}}.Search(ctx, key)
+}
+
+// Complete completes the normalized prefix.
+func (n *Normalizer) Complete(ctx context.Context, prefix string) ([]string, error) {
+	return n.searcher.Complete(ctx, normalizeKey(n.normalize, prefix))
+}
+
+func (n *Normalizer) Stats() Stats {
+	return n.searcher.Stats()
+}
+
+// keySearcher is a Searcher searching key instead of the given one.
+type keySearcher struct {
+	Searcher
+	key string
+}
+
+func (s keySearcher) Search(ctx context.Context, _ string) ([]Candidate, error) {
+	return s.Searcher.Search(ctx, s.key)
+}
+
+func normalizeKey(normalize []func(key string) string, key string) string {
+	for _, f := range normalize {
+		key = f(key)
+	}
+
+	return key
+}
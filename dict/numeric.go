@@ -0,0 +1,226 @@
+package dict
+
+import (
+	"context"
+	"strings"
+)
+
+// Numeric is a Searcher that does the numeric conversion of SKK. A key
+// with digits, such as "12がつ", also matches the key with "#" in place of
+// each number, "#がつ", and the placeholders "#0" to "#5" in its
+// candidates are replaced with the numbers in the key, in order:
+//
+//	#0  as is, "12"
+//	#1  in full-width digits, "１２"
+//	#2  in kanji digits, "一二"
+//	#3  in kanji numerals, "十二"
+//	#4  converted by searching the number itself
+//	#5  in formal kanji numerals, "壱拾弐"
+type Numeric struct {
+	searcher Searcher
+}
+
+var _ Searcher = (*Numeric)(nil)
+
+// NewNumeric returns a Numeric of s.
+func NewNumeric(s Searcher) *Numeric {
+	return &Numeric{searcher: s}
+}
+
+func (n *Numeric) Search(ctx context.Context, key string) ([]Candidate, error) {
+	candidates, err := n.searcher.Search(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	pattern, numbers := splitNumbers(key)
+	if len(numbers) == 0 {
+		return candidates, nil
+	}
+	found, err := n.searcher.Search(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return candidates, nil
+	}
+
+	// do not append to the slice owned by the searcher
+	candidates = candidates[:len(candidates):len(candidates)]
+	for _, c := range found {
+		text, ok := n.expand(ctx, c.Text(), numbers)
+		if !ok || containsText(candidates, text) {
+			continue
+		}
+		candidates = append(candidates, &candidate{
+			text:       text,
+			annotation: c.Annotation(),
+			source:     c.Source(),
+		})
+	}
+
+	return candidates, nil
+}
+
+func (n *Numeric) Complete(ctx context.Context, prefix string) ([]string, error) {
+	return n.searcher.Complete(ctx, prefix)
+}
+
+func (n *Numeric) Stats() Stats {
+	return n.searcher.Stats()
+}
+
+// expand replaces the placeholders in text with numbers. It reports false
+// if a placeholder is not supported, a number cannot be converted, or
+// there are fewer numbers than placeholders.
+func (n *Numeric) expand(ctx context.Context, text string, numbers []string) (string, bool) {
+	var b strings.Builder
+	i := 0
+	for {
+		j := strings.IndexByte(text, '#')
+		if j < 0 || j+1 >= len(text) {
+			break
+		}
+		typ := text[j+1]
+		if !isDigit(typ) {
+			b.WriteString(text[:j+1])
+			text = text[j+1:]
+			continue
+		}
+		if typ > '5' || i >= len(numbers) {
+			return "", false
+		}
+
+		var s string
+		switch typ {
+		case '0':
+			s = numbers[i]
+		case '1':
+			s = fullWidthDigits(numbers[i])
+		case '2':
+			s = kanjiDigits(numbers[i])
+		case '3':
+			s = kanjiNumber(numbers[i], kanjiNumerals)
+		case '4':
+			found, err := n.searcher.Search(ctx, numbers[i])
+			if err != nil || len(found) == 0 {
+				return "", false
+			}
+			s = found[0].Text()
+		case '5':
+			s = kanjiNumber(numbers[i], formalNumerals)
+		}
+		if s == "" {
+			return "", false
+		}
+		b.WriteString(text[:j])
+		b.WriteString(s)
+		text = text[j+2:]
+		i++
+	}
+	b.WriteString(text)
+
+	return b.String(), true
+}
+
+// splitNumbers replaces each run of ASCII digits in key with "#", and
+// returns the result and the numbers.
+func splitNumbers(key string) (string, []string) {
+	var b strings.Builder
+	var numbers []string
+	for i := 0; i < len(key); {
+		if !isDigit(key[i]) {
+			b.WriteByte(key[i])
+			i++
+			continue
+		}
+		j := i
+		for j < len(key) && isDigit(key[j]) {
+			j++
+		}
+		numbers = append(numbers, key[i:j])
+		b.WriteByte('#')
+		i = j
+	}
+
+	return b.String(), numbers
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func fullWidthDigits(number string) string {
+	var b strings.Builder
+	for _, c := range []byte(number) {
+		b.WriteRune('０' + rune(c-'0'))
+	}
+
+	return b.String()
+}
+
+func kanjiDigits(number string) string {
+	var b strings.Builder
+	for _, c := range []byte(number) {
+		b.WriteString(kanjiNumerals.digits[c-'0'])
+	}
+
+	return b.String()
+}
+
+type numerals struct {
+	digits [10]string
+	// tens are the units of the digits in a group of four, from the
+	// lowest, and groups the units of the groups
+	tens   [4]string
+	groups []string
+	// one reports whether "one" is written before the units of tens, as
+	// "一千" rather than "千"
+	one bool
+}
+
+var kanjiNumerals = &numerals{
+	digits: [10]string{"〇", "一", "二", "三", "四", "五", "六", "七", "八", "九"},
+	tens:   [4]string{"", "十", "百", "千"},
+	groups: []string{"", "万", "億", "兆", "京", "垓"},
+}
+
+var formalNumerals = &numerals{
+	digits: [10]string{"〇", "壱", "弐", "参", "四", "伍", "六", "七", "八", "九"},
+	tens:   [4]string{"", "拾", "百", "阡"},
+	groups: []string{"", "萬", "億", "兆", "京", "垓"},
+	one:    true,
+}
+
+// kanjiNumber writes number with the units of nums, such as "千二百三十四".
+// It returns an empty string if number is too large.
+func kanjiNumber(number string, nums *numerals) string {
+	number = strings.TrimLeft(number, "0")
+	if number == "" {
+		return nums.digits[0]
+	}
+	if (len(number)+3)/4 > len(nums.groups) {
+		return ""
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(number); i++ {
+		pos := len(number) - 1 - i
+		d := number[i] - '0'
+		if d != 0 {
+			if d != 1 || nums.one || pos%4 == 0 {
+				b.WriteString(nums.digits[d])
+			}
+			b.WriteString(nums.tens[pos%4])
+		}
+		if pos%4 == 0 && pos > 0 && !allZero(number[max(i-3, 0):i+1]) {
+			b.WriteString(nums.groups[pos/4])
+		}
+	}
+
+	return b.String()
+}
+
+func allZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
@@ -0,0 +1,287 @@
+package dict
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+type Option func(*options)
+
+type options struct {
+	lenient   bool
+	warn      func(name string, err error)
+	encoding  string
+	tag       bool
+	strict    bool
+	warnParse func(err *ParseError)
+	merge     AnnotationMerge
+	order     CandidateOrder
+	normalize []func(key string) string
+	text      []func(s string) string
+	emoji     EmojiPolicy
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// fail reports err of the named dictionary to warn if lenient, or adds it
+// to errs otherwise.
+func (o *options) fail(errs []error, name string, err error) []error {
+	if o.lenient {
+		if o.warn != nil {
+			o.warn(name, err)
+		}
+		return errs
+	}
+
+	return append(errs, err)
+}
+
+// expand expands the names of sources as Expand, failing the names that
+// cannot be expanded.
+func (o *options) expand(sources []Source) ([]Source, []error) {
+	var expanded []Source
+	var errs []error
+	for _, src := range sources {
+		names, err := Expand([]string{src.Name})
+		if err != nil {
+			errs = o.fail(errs, src.Name, err)
+		}
+		for _, name := range names {
+			s := src
+			s.Name = name
+			expanded = append(expanded, s)
+		}
+	}
+
+	return expanded, errs
+}
+
+// parseErrorFunc returns the onParseError of a builder for o.
+func (o *options) parseErrorFunc() func(err *ParseError) error {
+	switch {
+	case o.strict:
+		return func(err *ParseError) error {
+			return err
+		}
+	case o.warnParse != nil:
+		return func(err *ParseError) error {
+			o.warnParse(err)
+			return nil
+		}
+	default:
+		return nil
+	}
+}
+
+// Lenient makes OpenDictionary skip dictionary files that fail to load,
+// reporting each of them to warn (if not nil) instead of returning an error.
+func Lenient(warn func(name string, err error)) Option {
+	return func(o *options) {
+		o.lenient = true
+		o.warn = warn
+	}
+}
+
+// TagSources makes OpenSources append the Tag of the source to the
+// annotations of the candidates, as "候補;[L]", so users can tell which
+// dictionary a candidate comes from. The sources without Tag are tagged
+// with their short names, such as "L" of SKK-JISYO.L.
+func TagSources() Option {
+	return func(o *options) {
+		o.tag = true
+	}
+}
+
+// Strict makes a dictionary file with a malformed entry fail to load with
+// the ParseError of the first one. Otherwise malformed entries are skipped,
+// and the other entries are loaded.
+func Strict() Option {
+	return func(o *options) {
+		o.strict = true
+	}
+}
+
+// WarnParse makes warn called with each malformed entry skipped, including
+// those of the files added later by Attach or reloaded.
+func WarnParse(warn func(err *ParseError)) Option {
+	return func(o *options) {
+		o.warnParse = warn
+	}
+}
+
+// MergeAnnotations makes the annotations of a candidate found in more than
+// one dictionary file merged by m, instead of by KeepFirst.
+func MergeAnnotations(m AnnotationMerge) Option {
+	return func(o *options) {
+		o.merge = m
+	}
+}
+
+// OrderCandidates makes the candidates of a key loaded from the files
+// sorted in order, instead of in DictionaryOrder. The candidates added
+// later by Tx or AddEntry come after them.
+func OrderCandidates(order CandidateOrder) Option {
+	return func(o *options) {
+		o.order = order
+	}
+}
+
+// NormalizeKeys makes the keys of the dictionary files and of the searches
+// normalized by normalize in order, such as by normalize.Hiragana, so the
+// keys in different forms find the same candidates.
+func NormalizeKeys(normalize ...func(key string) string) Option {
+	return func(o *options) {
+		o.normalize = append(o.normalize, normalize...)
+	}
+}
+
+// NormalizeCandidates makes the texts and the annotations of the
+// candidates normalized by normalize in order, such as by normalize.NFC,
+// so the candidates in different forms are merged.
+func NormalizeCandidates(normalize ...func(s string) string) Option {
+	return func(o *options) {
+		o.text = append(o.text, normalize...)
+	}
+}
+
+// Emoji makes the emoji candidates, of which IsEmoji reports true,
+// treated by policy.
+func Emoji(policy EmojiPolicy) Option {
+	return func(o *options) {
+		o.emoji |= policy
+	}
+}
+
+// Encoding makes Load decode the dictionary from enc, such as "euc-jp" or
+// "utf-8", instead of from the encoding in its magic comment.
+func Encoding(enc string) Option {
+	return func(o *options) {
+		o.encoding = enc
+	}
+}
+
+// OpenDictionary loads all the named dictionary files into a new Dictionary.
+// A file that fails to load does not stop the others from being loaded; the
+// errors of all such files are joined and returned along with the
+// Dictionary.
+//
+// The files are parsed in parallel, but the candidates of a key are in the
+// order of names, as if the files were loaded one by one. Directories and
+// glob patterns in names are expanded as Expand.
+func OpenDictionary(names []string, opts ...Option) (*Dictionary, error) {
+	return OpenSources(sourcesOf(names), opts...)
+}
+
+// OpenSources loads the dictionary files of sources into a new Dictionary,
+// as OpenDictionary. It is an error if more than one source is Writable.
+// The sources are loaded in the order of Priority, and in the given order
+// among the same Priority.
+//
+// The candidates of a key from an earlier source come first. A candidate
+// found in more than one source is kept once, at its first place and with
+// the source of it, taking the annotation of the earliest source that has
+// one unless MergeAnnotations is given. Candidate.Source tells the source
+// of a candidate.
+func OpenSources(sources []Source, opts ...Option) (*Dictionary, error) {
+	o := newOptions(opts)
+
+	if _, _, err := SplitSources(sources); err != nil {
+		return nil, err
+	}
+	sources = sortSources(sources)
+	sources, errs := o.expand(sources)
+	if o.tag {
+		for i, src := range sources {
+			if src.Tag == "" {
+				sources[i].Tag = shortName(src.Name)
+			}
+		}
+	}
+
+	d := &Dictionary{
+		onParseError:     o.parseErrorFunc(),
+		mergeAnnotations: o.merge,
+		order:            o.order,
+		normalize:        o.normalize,
+		normalizeText:    o.text,
+		emoji:            o.emoji,
+	}
+	tx := d.Begin()
+	defer tx.Rollback()
+
+	tx.b.setOrder(o.order)
+	for _, r := range tx.b.addFiles(sources) {
+		if r.Err != nil {
+			errs = o.fail(errs, r.Source.Name, r.Err)
+		}
+	}
+	tx.b.sort()
+	tx.Commit()
+
+	return d, errors.Join(errs...)
+}
+
+// Load loads a SKK-JISYO dictionary read from r into a new Dictionary.
+func Load(r io.Reader, opts ...Option) (*Dictionary, error) {
+	o := newOptions(opts)
+
+	d := &Dictionary{
+		onParseError:     o.parseErrorFunc(),
+		mergeAnnotations: o.merge,
+		order:            o.order,
+		normalize:        o.normalize,
+		normalizeText:    o.text,
+		emoji:            o.emoji,
+	}
+	tx := d.Begin()
+	defer tx.Rollback()
+
+	tx.b.setOrder(o.order)
+	if err := tx.b.read(r, o.encoding); err != nil {
+		return nil, fmt.Errorf("failed to read dictionary: %w", err)
+	}
+	tx.b.sort()
+	tx.Commit()
+
+	return d, nil
+}
+
+// LoadFS loads the SKK-JISYO files in fsys matching patterns, as of
+// fs.Glob, into a new Dictionary. As OpenDictionary, the errors of the
+// files that fail to load are joined and returned along with the
+// Dictionary. A pattern matching no files is an error.
+func LoadFS(fsys fs.FS, patterns ...string) (*Dictionary, error) {
+	d := &Dictionary{}
+	tx := d.Begin()
+	defer tx.Rollback()
+
+	var errs []error
+	for _, pattern := range patterns {
+		names, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid pattern %s: %w", pattern, err))
+			continue
+		}
+		if len(names) == 0 {
+			// report the error of opening the pattern as a file name
+			names = []string{pattern}
+		}
+
+		for _, name := range names {
+			if err := tx.b.addFS(fsys, name); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	tx.Commit()
+
+	return d, errors.Join(errs...)
+}
@@ -0,0 +1,65 @@
+package dict
+
+import "sort"
+
+// CandidateOrder is the order of the candidates of a key in a Dictionary
+// loaded from more than one dictionary file.
+type CandidateOrder int
+
+const (
+	// DictionaryOrder orders the candidates in the order of the files,
+	// and in the order in a file. It is the default.
+	DictionaryOrder CandidateOrder = iota
+	// LexicalOrder orders the candidates by text.
+	LexicalOrder
+	// FrequencyOrder orders the candidates by the number of the files
+	// that have them, in DictionaryOrder among the same number.
+	FrequencyOrder
+)
+
+// freqKey returns the key of the candidate of text of key in freq of a
+// builder.
+func freqKey(key, text string) string {
+	return key + "\x00" + text
+}
+
+// count counts the candidate of text of key for FrequencyOrder, once for
+// each dictionary source.
+func (b *builder) count(key, text string, added bool) {
+	if b.freq == nil {
+		return
+	}
+	if !added {
+		e := b.table[key]
+		if c := e.candidates[e.index(text)]; c.Source() == b.source {
+			return
+		}
+	}
+	b.freq[freqKey(key, text)]++
+}
+
+// sort sorts the candidates of all the entries by the order of b, and
+// moves the emoji candidates last by the emoji of b.
+func (b *builder) sort() {
+	if b.order == DictionaryOrder && b.emoji&EmojiLast == 0 {
+		return
+	}
+
+	for key := range b.table {
+		e := b.entry(key)
+		switch b.order {
+		case LexicalOrder:
+			sort.SliceStable(e.candidates, func(i, j int) bool {
+				return e.candidates[i].Text() < e.candidates[j].Text()
+			})
+		case FrequencyOrder:
+			sort.SliceStable(e.candidates, func(i, j int) bool {
+				return b.freq[freqKey(key, e.candidates[i].Text())] > b.freq[freqKey(key, e.candidates[j].Text())]
+			})
+		}
+		if b.emoji&EmojiLast != 0 {
+			e.emojiLast()
+		}
+		e.reindex()
+	}
+}
@@ -0,0 +1,215 @@
+package dict
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const parseCacheVersion = 4
+
+// parseCacheHeader identifies the dictionary file a parse cache is made
+// from.
+type parseCacheHeader struct {
+	Version int
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Hash    []byte
+}
+
+// parseCacheEntries holds the entries in flat slices, which are encoded
+// and decoded much faster than a slice of structs. Counts[i] is the number
+// of the candidates of Keys[i], and Okuri[i] reports whether it is
+// okuri-ari.
+type parseCacheEntries struct {
+	Keys        []string
+	Counts      []int
+	Okuri       []bool
+	Texts       []string
+	Annotations []string
+	Blocks      []parseCacheBlock
+}
+
+// parseCacheBlock is an okuri block of Keys[Key].
+type parseCacheBlock struct {
+	Key         int
+	Okuri       string
+	Texts       []string
+	Annotations []string
+}
+
+var errStaleCache = errors.New("stale parse cache")
+
+// addCached adds the entries of the named file, from the parse cache in dir
+// if the file is not changed since the cache is made. Otherwise the file
+// is parsed and the cache is made for the next time.
+func (d *Dictionary) addCached(name, dir string) error {
+	path, err := filepath.Abs(name)
+	if err != nil {
+		path = name
+	}
+	sum := sha256.Sum256([]byte(path))
+	cachePath := filepath.Join(dir, hex.EncodeToString(sum[:])+".cache")
+
+	header, err := fileHeader(path)
+	if err != nil {
+		// let Add report the error
+		return d.Add(name)
+	}
+
+	if err := d.readParseCache(cachePath, header, name); err == nil {
+		return nil
+	}
+
+	if err := d.Add(name); err != nil {
+		return err
+	}
+
+	// the cache is only for speed, failing to make it is not an error
+	d.writeParseCache(cachePath, header)
+
+	return nil
+}
+
+func fileHeader(path string) (*parseCacheHeader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+
+	return &parseCacheHeader{
+		Version: parseCacheVersion,
+		Path:    path,
+		Size:    fi.Size(),
+		ModTime: fi.ModTime(),
+		Hash:    h.Sum(nil),
+	}, nil
+}
+
+// readParseCache adds the entries in the parse cache, as those of the
+// dictionary source.
+func (d *Dictionary) readParseCache(cachePath string, want *parseCacheHeader, source string) error {
+	f, err := os.Open(cachePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dec := gob.NewDecoder(bufio.NewReader(f))
+
+	var header parseCacheHeader
+	if err := dec.Decode(&header); err != nil {
+		return err
+	}
+	if header.Version != want.Version || header.Path != want.Path ||
+		header.Size != want.Size || !header.ModTime.Equal(want.ModTime) ||
+		!bytes.Equal(header.Hash, want.Hash) {
+		return errStaleCache
+	}
+
+	var entries parseCacheEntries
+	if err := dec.Decode(&entries); err != nil {
+		return err
+	}
+	if len(entries.Counts) != len(entries.Keys) || len(entries.Okuri) != len(entries.Keys) ||
+		len(entries.Annotations) != len(entries.Texts) {
+		return errStaleCache
+	}
+
+	tx := d.Begin()
+	defer tx.Rollback()
+	tx.b.source = source
+	tx.b.sources = append(tx.b.sources, Source{Name: source})
+
+	j := 0
+	for i, key := range entries.Keys {
+		key = normalizeKey(tx.b.normalize, key)
+		tx.b.entry(key).okuri = entries.Okuri[i]
+		for n := entries.Counts[i]; n > 0 && j < len(entries.Texts); n-- {
+			tx.Add(key, entries.Texts[j], entries.Annotations[j])
+			j++
+		}
+	}
+	for _, ob := range entries.Blocks {
+		if ob.Key < 0 || ob.Key >= len(entries.Keys) || len(ob.Annotations) != len(ob.Texts) {
+			return errStaleCache
+		}
+		for k, text := range ob.Texts {
+			tx.b.addOkuri(normalizeKey(tx.b.normalize, entries.Keys[ob.Key]), ob.Okuri, text, ob.Annotations[k])
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (d *Dictionary) writeParseCache(cachePath string, header *parseCacheHeader) error {
+	s := d.load()
+	var entries parseCacheEntries
+	entries.Keys = s.keys()
+	entries.Counts = make([]int, len(entries.Keys))
+	entries.Okuri = make([]bool, len(entries.Keys))
+	for i, key := range entries.Keys {
+		e := s.get(key)
+		candidates := e.candidates
+		entries.Counts[i] = len(candidates)
+		entries.Okuri[i] = e.okuri
+		for _, c := range candidates {
+			entries.Texts = append(entries.Texts, c.Text())
+			entries.Annotations = append(entries.Annotations, c.Annotation())
+		}
+		for _, ob := range e.blocks {
+			block := parseCacheBlock{Key: i, Okuri: ob.okuri}
+			for _, c := range ob.candidates {
+				block.Texts = append(block.Texts, c.Text())
+				block.Annotations = append(block.Annotations, c.Annotation())
+			}
+			entries.Blocks = append(entries.Blocks, block)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(cachePath), filepath.Base(cachePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w := bufio.NewWriter(tmp)
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+	if err := enc.Encode(entries); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), cachePath)
+}
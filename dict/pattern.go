@@ -0,0 +1,53 @@
+package dict
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// SearchPattern returns up to limit keys matching pattern in sorted order,
+// or all of them if limit is not positive. pattern is a glob pattern as of
+// path.Match, such as "かん*", or a RE2 regular expression between '/',
+// such as "/^かん.じ$/". It scans all the keys, so it is meant for tools
+// auditing the dictionary rather than for serving clients.
+func (d *Dictionary) SearchPattern(pattern string, limit int) ([]string, error) {
+	match, err := compilePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, key := range d.load().keys() {
+		if limit > 0 && len(keys) >= limit {
+			break
+		}
+		if match(key) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+// compilePattern returns the function reporting whether a key matches
+// pattern of SearchPattern.
+func compilePattern(pattern string) (func(key string) bool, error) {
+	if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+		}
+		return re.MatchString, nil
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %s: %w", pattern, err)
+	}
+
+	return func(key string) bool {
+		ok, _ := path.Match(pattern, key)
+		return ok
+	}, nil
+}
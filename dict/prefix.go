@@ -0,0 +1,88 @@
+package dict
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// prefixIndex is the sorted keys of the okuri-nasi entries of the base of
+// snapshots, built at the first search.
+type prefixIndex struct {
+	once sync.Once
+	keys []string
+}
+
+// SearchPrefix returns up to limit keys of the okuri-nasi entries starting
+// with prefix in sorted order, or all of them if limit is not positive. The
+// index for it is built at the first call after the entries are reloaded.
+func (d *Dictionary) SearchPrefix(prefix string, limit int) []string {
+	return d.load().searchPrefix(d.key(prefix), limit)
+}
+
+// completable reports whether e is of a key to complete.
+func completable(e *entry) bool {
+	return len(e.candidates) > 0 && !e.okuri
+}
+
+func (s *snapshot) searchPrefix(prefix string, limit int) []string {
+	var base []string
+	if s.prefix != nil {
+		s.prefix.once.Do(func() {
+			for key, e := range s.base {
+				if completable(e) {
+					s.prefix.keys = append(s.prefix.keys, key)
+				}
+			}
+			sort.Strings(s.prefix.keys)
+		})
+		base = s.prefix.keys
+	}
+
+	// the entries of overlay take the place of those of base
+	var changed []string
+	for key, e := range s.overlay {
+		if completable(e) && strings.HasPrefix(key, prefix) {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+
+	var keys []string
+	i := sort.SearchStrings(base, prefix)
+	for limit <= 0 || len(keys) < limit {
+		hasBase := i < len(base) && strings.HasPrefix(base[i], prefix)
+		switch {
+		case len(changed) > 0 && (!hasBase || changed[0] <= base[i]):
+			if hasBase && changed[0] == base[i] {
+				i++
+			}
+			keys = append(keys, changed[0])
+			changed = changed[1:]
+		case hasBase:
+			if _, ok := s.overlay[base[i]]; !ok {
+				keys = append(keys, base[i])
+			}
+			i++
+		default:
+			return keys
+		}
+	}
+
+	return keys
+}
+
+// Complete returns the keys of the okuri-nasi entries starting with prefix
+// in sorted order, as SearchPrefix without limit. An empty prefix
+// completes nothing.
+func (d *Dictionary) Complete(ctx context.Context, prefix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if prefix == "" {
+		return nil, nil
+	}
+
+	return d.SearchPrefix(prefix, 0), nil
+}
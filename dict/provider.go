@@ -0,0 +1,25 @@
+package dict
+
+import "context"
+
+// Provider is a programmatic source of candidates, such as a calculator, a
+// unit converter or a lookup of a directory service, which is queried
+// after the dictionaries for each key.
+type Provider interface {
+	// Candidates returns the candidates of key, or none if the Provider
+	// does not handle key.
+	Candidates(ctx context.Context, key string) ([]Candidate, error)
+}
+
+// ProviderFunc is a Provider of a function.
+type ProviderFunc func(ctx context.Context, key string) ([]Candidate, error)
+
+func (f ProviderFunc) Candidates(ctx context.Context, key string) ([]Candidate, error) {
+	return f(ctx, key)
+}
+
+// Filter post-processes the candidates of a key found by the dictionaries
+// and the Providers, such as to drop, reorder or rewrite them.
+type Filter interface {
+	Filter(ctx context.Context, key string, candidates []Candidate) ([]Candidate, error)
+}
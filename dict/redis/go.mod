@@ -0,0 +1,19 @@
+module github.com/kechako/goskkserv/dict/redis
+
+go 1.22
+
+require (
+	github.com/kechako/goskkserv v0.0.0
+	github.com/redis/go-redis/v9 v9.7.3
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/fsnotify/fsnotify v1.9.0 // indirect
+	github.com/ulikunitz/xz v0.5.15 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/text v0.3.3 // indirect
+)
+
+replace github.com/kechako/goskkserv => ../../
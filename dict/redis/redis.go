@@ -0,0 +1,138 @@
+// Package redis provides a dictionary backend that looks up candidates in
+// Redis, so several servers can share a centrally managed dictionary.
+//
+// The candidates of a key are stored in a hash named KeyPrefix+key, whose
+// fields "0", "1", ... hold the candidates in order in the form
+// "text;annotation" or "text":
+//
+//	HSET skk:かんじ 0 漢字 1 感じ;feeling
+//
+// Wrap a Dictionary with dict.NewCache to cache the candidates locally.
+//
+// It is a separate module so that the Redis client is only pulled in by
+// the programs that use it.
+package redis
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kechako/goskkserv/dict"
+	"github.com/redis/go-redis/v9"
+)
+
+const DefaultKeyPrefix = "skk:"
+
+// scanCount is the hint of the number of keys scanned at a time.
+const scanCount = 1000
+
+type Dictionary struct {
+	Client *redis.Client
+
+	// KeyPrefix is prepended to the keys of the entries in Redis. Default
+	// is DefaultKeyPrefix.
+	KeyPrefix string
+}
+
+var _ dict.Searcher = (*Dictionary)(nil)
+
+func New(client *redis.Client) *Dictionary {
+	return &Dictionary{
+		Client:    client,
+		KeyPrefix: DefaultKeyPrefix,
+	}
+}
+
+// Open returns a Dictionary on the Redis server of url, such as
+// "redis://localhost:6379/0".
+func Open(url string) (*Dictionary, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse redis url %s: %w", url, err)
+	}
+
+	return New(redis.NewClient(opts)), nil
+}
+
+func (d *Dictionary) Search(ctx context.Context, key string) ([]dict.Candidate, error) {
+	fields, err := d.Client.HGetAll(ctx, d.KeyPrefix+key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to search [%s] on redis: %w", key, err)
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	type field struct {
+		n     int
+		value string
+	}
+	sorted := make([]field, 0, len(fields))
+	for name, value := range fields {
+		n, err := strconv.Atoi(name)
+		if err != nil || value == "" {
+			continue
+		}
+		sorted = append(sorted, field{n, value})
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].n < sorted[j].n
+	})
+
+	candidates := make([]dict.Candidate, 0, len(sorted))
+	for _, f := range sorted {
+		text, annotation, _ := strings.Cut(f.value, ";")
+		candidates = append(candidates, dict.NewCandidate(text, annotation))
+	}
+
+	return candidates, nil
+}
+
+// Complete returns the keys starting with prefix in sorted order. It scans
+// the keys of Redis.
+func (d *Dictionary) Complete(ctx context.Context, prefix string) ([]string, error) {
+	if prefix == "" {
+		return nil, nil
+	}
+
+	var keys []string
+	pattern := escapePattern(d.KeyPrefix+prefix) + "*"
+	iter := d.Client.Scan(ctx, 0, pattern, scanCount).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, strings.TrimPrefix(iter.Val(), d.KeyPrefix))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to complete [%s] on redis: %w", prefix, err)
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// Stats returns zero Stats, as counting the entries in Redis needs a scan
+// of all the keys.
+func (d *Dictionary) Stats() dict.Stats {
+	return dict.Stats{}
+}
+
+func (d *Dictionary) Close() error {
+	return d.Client.Close()
+}
+
+// escapePattern escapes the special characters of the glob-style patterns
+// of Redis.
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\', '^', '-':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,69 @@
+package dict
+
+// Remove removes all the candidates of key. It reports whether key has
+// any. Searches see either all of them or none.
+func (d *Dictionary) Remove(key string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key = d.key(key)
+	s := d.load()
+	entry := s.get(key)
+	if entry == nil || len(entry.candidates) == 0 {
+		return false
+	}
+	empty := newEntry(key)
+	empty.render(nil)
+
+	d.snap.Store(s.with(key, empty))
+
+	return true
+}
+
+// RemoveCandidate removes the candidate of text of key. It reports whether
+// key has the candidate.
+func (d *Dictionary) RemoveCandidate(key, text string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key = d.key(key)
+	text = d.text(text)
+	s := d.load()
+	entry := s.get(key)
+	if entry == nil || entry.index(text) < 0 {
+		return false
+	}
+	entry = entry.clone()
+	entry.removeText(text)
+	entry.render(nil)
+
+	d.snap.Store(s.with(key, entry))
+
+	return true
+}
+
+// Remove removes all the candidates of key as Dictionary.Remove, and
+// saves u, or lets it saved by AutoSave.
+func (u *UserDictionary) Remove(key string) (bool, error) {
+	if !u.Dictionary.Remove(key) {
+		return false, nil
+	}
+	if u.changed() {
+		return true, nil
+	}
+
+	return true, u.Save()
+}
+
+// RemoveCandidate removes the candidate of text of key as
+// Dictionary.RemoveCandidate, and saves u, or lets it saved by AutoSave.
+func (u *UserDictionary) RemoveCandidate(key, text string) (bool, error) {
+	if !u.Dictionary.RemoveCandidate(key, text) {
+		return false, nil
+	}
+	if u.changed() {
+		return true, nil
+	}
+
+	return true, u.Save()
+}
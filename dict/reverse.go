@@ -0,0 +1,32 @@
+package dict
+
+import "sort"
+
+// ReverseSearch returns the keys that have a candidate of text in sorted
+// order, such as "かんじ" for "漢字". The index for it is built at the first
+// call after the entries change, so the Dictionaries not reverse searched
+// do not pay for it.
+func (d *Dictionary) ReverseSearch(text string) []string {
+	s := d.load()
+	s.reverseOnce.Do(func() {
+		s.reverse = s.reverseIndex()
+	})
+
+	return append([]string(nil), s.reverse[text]...)
+}
+
+// reverseIndex returns the index of the texts of the candidates to their
+// sorted keys.
+func (s *snapshot) reverseIndex() map[string][]string {
+	index := make(map[string][]string)
+	s.each(func(key string, e *entry) {
+		for _, c := range e.candidates {
+			index[c.Text()] = append(index[c.Text()], key)
+		}
+	})
+	for _, keys := range index {
+		sort.Strings(keys)
+	}
+
+	return index
+}
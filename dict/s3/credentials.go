@@ -0,0 +1,98 @@
+package s3
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// anonymousPeriod is how long the objects are requested anonymously after
+// no credentials are found, before they are searched again.
+const anonymousPeriod = 10 * time.Minute
+
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// awsConfig is the default config of the AWS SDK, loaded at the first
+// request. The credentials are cached by the SDK until they expire.
+type awsConfig struct {
+	mu  sync.Mutex
+	cfg *aws.Config
+
+	// the objects are requested anonymously until anonymousUntil, as no
+	// credentials were found for the reason of noCredentials
+	anonymousUntil time.Time
+	noCredentials  error
+}
+
+var defaultConfig = &awsConfig{}
+
+func (c *awsConfig) load(ctx context.Context, client *http.Client) (aws.Config, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cfg == nil {
+		// the SDK adds the CA bundle of AWS_CA_BUNDLE only to its own client
+		var opts []func(*config.LoadOptions) error
+		if os.Getenv("AWS_CA_BUNDLE") == "" {
+			opts = append(opts, config.WithHTTPClient(client))
+		}
+		cfg, err := config.LoadDefaultConfig(ctx, opts...)
+		if err != nil {
+			return aws.Config{}, err
+		}
+		c.cfg = &cfg
+	}
+
+	return *c.cfg, nil
+}
+
+// credentials returns the credentials of cfg, or nil and the reason if
+// there are none, such as off EC2. Then the objects are requested
+// anonymously for anonymousPeriod without searching the credentials, which
+// may wait for the instance metadata.
+func (c *awsConfig) credentials(ctx context.Context, cfg aws.Config) (*aws.Credentials, error) {
+	c.mu.Lock()
+	if time.Now().Before(c.anonymousUntil) {
+		defer c.mu.Unlock()
+		return nil, c.noCredentials
+	}
+	c.mu.Unlock()
+
+	if cfg.Credentials == nil {
+		return nil, nil
+	}
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			c.mu.Lock()
+			c.anonymousUntil = time.Now().Add(anonymousPeriod)
+			c.noCredentials = err
+			c.mu.Unlock()
+		}
+		return nil, err
+	}
+
+	return &creds, nil
+}
+
+// sign signs req with Signature Version 4, leaving the payload unsigned.
+func sign(ctx context.Context, req *http.Request, creds aws.Credentials, region string, now time.Time) error {
+	payloadHash := req.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = unsignedPayload
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	// the path of the object is escaped by objectURL
+	signer := v4.NewSigner(func(o *v4.SignerOptions) {
+		o.DisableURIPathEscaping = true
+	})
+
+	return signer.SignHTTP(ctx, creds, req, payloadHash, "s3", region, now)
+}
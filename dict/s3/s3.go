@@ -0,0 +1,144 @@
+// Package s3 registers the scheme s3 of dictionary URLs, such as
+// s3://bucket/SKK-JISYO.L.gz, to download dictionaries from Amazon S3 or
+// S3 compatible storage. Import it for its side effect:
+//
+//	import _ "github.com/kechako/goskkserv/dict/s3"
+//
+// The credentials and the region are found by the default chain of the AWS
+// SDK: the environment variables such as AWS_ACCESS_KEY_ID and AWS_REGION,
+// the shared config and credentials files with the profile of AWS_PROFILE,
+// the web identity token of AWS_WEB_IDENTITY_TOKEN_FILE as of EKS, the
+// container credentials of AWS_CONTAINER_CREDENTIALS_RELATIVE_URI as of
+// ECS, and the EC2 instance metadata. The credentials are kept until they
+// expire. Without credentials, objects are requested anonymously for a
+// while before the credentials are searched again. A custom endpoint is
+// taken from AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL.
+//
+// It is a separate module so that the AWS SDK is only pulled in by the
+// programs that use it.
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kechako/goskkserv/dict"
+)
+
+func init() {
+	dict.RegisterScheme("s3", Get)
+}
+
+const defaultRegion = "us-east-1"
+
+// Get gets the object of rawURL in the form s3://bucket/key. It is a
+// dict.SchemeFunc.
+func Get(ctx context.Context, client *http.Client, rawURL, etag string) (io.ReadCloser, string, error) {
+	bucket, key, err := parseURL(rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cfg, err := defaultConfig.load(ctx, client)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to load config: %w", err)
+	}
+	creds, noCredentials := defaultConfig.credentials(ctx, cfg)
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	region := cfg.Region
+	if region == "" {
+		region = defaultRegion
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, objectURL(bucket, key, region), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if creds != nil {
+		if err := sign(ctx, req, *creds, region, time.Now()); err != nil {
+			return nil, "", fmt.Errorf("failed to sign request: %w", err)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, resp.Header.Get("ETag"), nil
+	case http.StatusNotModified:
+		resp.Body.Close()
+		return nil, "", dict.ErrNotModified
+	case http.StatusForbidden:
+		resp.Body.Close()
+		if noCredentials != nil {
+			return nil, "", fmt.Errorf("unexpected status: %s, requested anonymously without credentials: %w", resp.Status, noCredentials)
+		}
+		return nil, "", fmt.Errorf("unexpected status: %s", resp.Status)
+	default:
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+}
+
+func parseURL(rawURL string) (bucket, key string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", err
+	}
+	key = strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return "", "", fmt.Errorf("invalid s3 url: %s", rawURL)
+	}
+
+	return u.Host, key, nil
+}
+
+// objectURL returns the URL of the object, in the virtual-hosted style if
+// possible.
+func objectURL(bucket, key, region string) string {
+	for _, name := range []string{"AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"} {
+		if endpoint := os.Getenv(name); endpoint != "" {
+			return strings.TrimRight(endpoint, "/") + "/" + bucket + "/" + escape(key)
+		}
+	}
+
+	// a bucket with dots does not match the wildcard certificate
+	if strings.Contains(bucket, ".") {
+		return "https://s3." + region + ".amazonaws.com/" + bucket + "/" + escape(key)
+	}
+
+	return "https://" + bucket + ".s3." + region + ".amazonaws.com/" + escape(key)
+}
+
+// escape escapes s as the URI encoding of Signature Version 4, which
+// leaves only the unreserved characters and '/'.
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
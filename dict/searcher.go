@@ -0,0 +1,20 @@
+package dict
+
+import "context"
+
+// Searcher is a source of candidates.
+type Searcher interface {
+	Search(ctx context.Context, key string) ([]Candidate, error)
+	// Complete returns the keys starting with prefix.
+	Complete(ctx context.Context, prefix string) ([]string, error)
+	Stats() Stats
+}
+
+// Stats is the size of a Searcher. Searchers that do not know their size,
+// such as remote ones, report zero.
+type Stats struct {
+	Keys       int
+	Candidates int
+}
+
+var _ Searcher = (*Dictionary)(nil)
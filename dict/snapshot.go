@@ -0,0 +1,346 @@
+package dict
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kechako/goskkserv/dict/jisyo"
+)
+
+// snapshot is an immutable state of a Dictionary. Searches read the
+// current snapshot without locks, and changes make a new snapshot.
+type snapshot struct {
+	// base holds most of the entries, and overlay the entries changed
+	// since base was made, which take precedence. A small change copies
+	// only overlay, and overlay is merged into base when it grows.
+	base    map[string]*entry
+	overlay map[string]*entry
+
+	// sources are the dictionary files the entries are loaded from, and
+	// fsSources the files in file systems, as of LoadFS
+	sources   []Source
+	fsSources []fsSource
+
+	stats Stats
+
+	// prefix is the index of the keys of base for SearchPrefix, shared
+	// by the snapshots of the same base
+	prefix *prefixIndex
+
+	// reverse is the index of the texts of the candidates to their keys,
+	// built at the first ReverseSearch
+	reverseOnce sync.Once
+	reverse     map[string][]string
+}
+
+var emptySnapshot = &snapshot{}
+
+func (s *snapshot) get(key string) *entry {
+	if e, ok := s.overlay[key]; ok {
+		return e
+	}
+
+	return s.base[key]
+}
+
+// getOkuri returns the okuri-ari entry of key followed by its okurigana,
+// such as "おくrる", and the okurigana, or nil if there is no such entry.
+func (s *snapshot) getOkuri(key string) (*entry, string) {
+	base, okuri, ok := jisyo.SplitOkurigana(key)
+	if !ok {
+		return nil, ""
+	}
+	e := s.get(base)
+	if e == nil || !e.okuri {
+		return nil, ""
+	}
+
+	return e, okuri
+}
+
+// getFolded returns the entry of key in lower case, if it is of a
+// dictionary of Source.IgnoreCase.
+func (s *snapshot) getFolded(key string) *entry {
+	folded := strings.ToLower(key)
+	if folded == key {
+		return nil
+	}
+	if e := s.get(folded); e != nil && e.foldCase {
+		return e
+	}
+
+	return nil
+}
+
+// each calls fn with each entry.
+func (s *snapshot) each(fn func(key string, e *entry)) {
+	for key, e := range s.overlay {
+		fn(key, e)
+	}
+	for key, e := range s.base {
+		if _, ok := s.overlay[key]; !ok {
+			fn(key, e)
+		}
+	}
+}
+
+// keys returns the keys that have candidates in sorted order.
+func (s *snapshot) keys() []string {
+	keys := make([]string, 0, len(s.base)+len(s.overlay))
+	s.each(func(key string, e *entry) {
+		if len(e.candidates) > 0 {
+			keys = append(keys, key)
+		}
+	})
+	sort.Strings(keys)
+
+	return keys
+}
+
+// maxOverlay returns the size of overlay at which it is merged into a base
+// of n entries.
+func maxOverlay(n int) int {
+	return 64 + n/256
+}
+
+// with returns a new snapshot with e as the entry of key.
+func (s *snapshot) with(key string, e *entry) *snapshot {
+	if len(s.overlay) >= maxOverlay(len(s.base)) {
+		b := newBuilder(s)
+		b.set(key, e)
+		return b.snapshot()
+	}
+
+	overlay := make(map[string]*entry, len(s.overlay)+1)
+	for k, v := range s.overlay {
+		overlay[k] = v
+	}
+	overlay[key] = e
+
+	stats := s.stats
+	if old := s.get(key); old != nil && len(old.candidates) > 0 {
+		stats.Keys--
+		stats.Candidates -= len(old.candidates)
+	}
+	if len(e.candidates) > 0 {
+		stats.Keys++
+		stats.Candidates += len(e.candidates)
+	}
+
+	return &snapshot{
+		base:      s.base,
+		overlay:   overlay,
+		sources:   s.sources,
+		fsSources: s.fsSources,
+		stats:     stats,
+		prefix:    s.prefix,
+	}
+}
+
+// builder makes a new snapshot from an old one, leaving the old one as it
+// is. The entries of the old snapshot are copied before being changed.
+type builder struct {
+	table map[string]*entry
+	owned map[*entry]struct{}
+	arena *arena
+
+	// source is the name of the dictionary being added, tag its tag, and
+	// foldCase its IgnoreCase
+	source   string
+	tag      string
+	foldCase bool
+
+	sources   []Source
+	fsSources []fsSource
+	// counts counts the entries read from the current file
+	counts Stats
+
+	// onParseError, if not nil, is called with each malformed entry. If it
+	// returns an error, reading the file fails with it.
+	onParseError func(err *ParseError) error
+
+	// mergeAnnotations merges the annotations of the duplicate candidates
+	mergeAnnotations AnnotationMerge
+
+	// order is the order sort sorts the candidates in, and freq counts
+	// the sources of the candidates for FrequencyOrder
+	order CandidateOrder
+	freq  map[string]int
+
+	// normalize normalizes the keys read from the files
+	normalize []func(key string) string
+	// normalizeText normalizes the texts and the annotations
+	normalizeText []func(s string) string
+	// emoji is the policy of the emoji candidates
+	emoji EmojiPolicy
+}
+
+func newBuilder(old *snapshot) *builder {
+	table := make(map[string]*entry, len(old.base)+len(old.overlay))
+	old.each(func(key string, e *entry) {
+		table[key] = e
+	})
+
+	return &builder{
+		table:     table,
+		owned:     make(map[*entry]struct{}),
+		arena:     newArena(),
+		sources:   old.sources[:len(old.sources):len(old.sources)],
+		fsSources: old.fsSources[:len(old.fsSources):len(old.fsSources)],
+	}
+}
+
+// entry returns the entry of key that can be changed.
+func (b *builder) entry(key string) *entry {
+	e := b.table[key]
+	if e == nil {
+		e = newEntry(key)
+		key = b.arena.string(key)
+	} else if _, ok := b.owned[e]; ok {
+		return e
+	} else {
+		e = e.clone()
+	}
+
+	b.table[key] = e
+	b.owned[e] = struct{}{}
+
+	return e
+}
+
+func (b *builder) add(key, text, annotation string) bool {
+	if b.tag != "" {
+		annotation = tagAnnotation(annotation, b.tag)
+	}
+
+	added := b.entry(key).add(b.arena, b.mergeAnnotations, text, annotation, b.source)
+	b.count(key, text, added)
+
+	return added
+}
+
+// addOkuri adds a candidate of key for okuri as add.
+func (b *builder) addOkuri(key, okuri, text, annotation string) {
+	if b.tag != "" {
+		annotation = tagAnnotation(annotation, b.tag)
+	}
+
+	b.entry(key).addOkuri(b.arena, b.mergeAnnotations, okuri, text, annotation, b.source)
+}
+
+// text returns s normalized by the normalizeText of b.
+func (b *builder) text(s string) string {
+	return normalizeKey(b.normalizeText, s)
+}
+
+// annotation returns the annotation of the candidate of text read from a
+// file, normalized by the normalizeText of b and stripped by the emoji of
+// b.
+func (b *builder) annotation(text, annotation string) string {
+	if b.emoji&StripEmojiAnnotations != 0 && IsEmoji(text) {
+		return ""
+	}
+
+	return b.text(annotation)
+}
+
+// tagAnnotation appends tag to annotation.
+func tagAnnotation(annotation, tag string) string {
+	if annotation == "" {
+		return "[" + tag + "]"
+	}
+
+	return annotation + " [" + tag + "]"
+}
+
+func (b *builder) remove(key string) bool {
+	if _, ok := b.table[key]; !ok {
+		return false
+	}
+	delete(b.table, key)
+
+	return true
+}
+
+// child returns a new builder of no entries with the settings of b, whose
+// entries are to be merged into b.
+func (b *builder) child() *builder {
+	c := newBuilder(emptySnapshot)
+	c.onParseError = b.onParseError
+	c.mergeAnnotations = b.mergeAnnotations
+	c.normalize = b.normalize
+	c.normalizeText = b.normalizeText
+	c.emoji = b.emoji
+	c.setOrder(b.order)
+
+	return c
+}
+
+// setOrder sets the order sort sorts the candidates in.
+func (b *builder) setOrder(order CandidateOrder) {
+	b.order = order
+	if order == FrequencyOrder {
+		b.freq = make(map[string]int)
+	}
+}
+
+// merge adds the entries of part, which must not be used after that.
+func (b *builder) merge(part *builder) {
+	b.sources = append(b.sources, part.sources...)
+	b.fsSources = append(b.fsSources, part.fsSources...)
+	if b.freq != nil {
+		for k, n := range part.freq {
+			b.freq[k] += n
+		}
+	}
+	for key, e := range part.table {
+		if _, ok := b.table[key]; !ok {
+			b.table[key] = e
+			if _, ok := part.owned[e]; ok {
+				b.owned[e] = struct{}{}
+			}
+			continue
+		}
+
+		// the candidates are immutable, so they are shared with part
+		t := b.entry(key)
+		t.foldCase = t.foldCase || e.foldCase
+		for _, c := range e.candidates {
+			t.addCandidate(b.arena, b.mergeAnnotations, c)
+		}
+		for _, ob := range e.blocks {
+			for _, c := range ob.candidates {
+				t.addOkuriCandidate(b.arena, b.mergeAnnotations, ob.okuri, c)
+			}
+		}
+	}
+}
+
+// clear removes all the entries.
+func (b *builder) clear() {
+	b.table = make(map[string]*entry)
+	b.owned = make(map[*entry]struct{})
+	b.sources = nil
+	b.fsSources = nil
+}
+
+// set sets e, which must not be changed after that, as the entry of key.
+func (b *builder) set(key string, e *entry) {
+	b.table[key] = e
+}
+
+func (b *builder) snapshot() *snapshot {
+	s := &snapshot{base: b.table, sources: b.sources, fsSources: b.fsSources, prefix: &prefixIndex{}}
+	for e := range b.owned {
+		e.render(b.arena)
+	}
+	for _, e := range b.table {
+		if len(e.candidates) > 0 {
+			s.stats.Keys++
+			s.stats.Candidates += len(e.candidates)
+		}
+	}
+
+	return s
+}
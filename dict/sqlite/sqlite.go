@@ -0,0 +1,236 @@
+// Package sqlite provides a dictionary backend stored in a SQLite database,
+// so dictionaries can be maintained with SQL tools and served directly.
+//
+// The package uses database/sql and does not import a driver. Programs
+// must import a SQLite driver registered as "sqlite3" or "sqlite", such as
+// github.com/mattn/go-sqlite3 or modernc.org/sqlite.
+//
+// The candidates of a key are the rows of the entries table with the key,
+// in the order of id:
+//
+//	CREATE TABLE entries (
+//		id         INTEGER PRIMARY KEY,
+//		key        TEXT NOT NULL,
+//		text       TEXT NOT NULL,
+//		annotation TEXT NOT NULL DEFAULT '',
+//		UNIQUE (key, text)
+//	);
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kechako/goskkserv/dict"
+)
+
+// Schema creates the tables of a dictionary if they do not exist.
+const Schema = `
+CREATE TABLE IF NOT EXISTS entries (
+	id         INTEGER PRIMARY KEY,
+	key        TEXT NOT NULL,
+	text       TEXT NOT NULL,
+	annotation TEXT NOT NULL DEFAULT '',
+	UNIQUE (key, text)
+);
+`
+
+var driverNames = []string{"sqlite3", "sqlite"}
+
+var ErrNoDriver = errors.New("no sqlite driver registered")
+
+func init() {
+	dict.RegisterFormat(".sqlite", func(name string) (dict.Searcher, error) {
+		return Open(name)
+	})
+	dict.RegisterFormat(".sqlite3", func(name string) (dict.Searcher, error) {
+		return Open(name)
+	})
+}
+
+// Dictionary is a dictionary stored in a SQLite database.
+type Dictionary struct {
+	db *sql.DB
+}
+
+var _ dict.Searcher = (*Dictionary)(nil)
+
+// Open opens the database file name with the registered SQLite driver. It
+// returns an error wrapping fs.ErrNotExist if the file does not exist,
+// rather than serving an empty dictionary.
+func Open(name string) (*Dictionary, error) {
+	if _, err := os.Stat(name); err != nil {
+		return nil, fmt.Errorf("failed to open dictionary file %s: %w", name, err)
+	}
+
+	return Create(name)
+}
+
+// Create opens the database file name with the registered SQLite driver,
+// creating it and the tables if they do not exist, such as to Import a
+// dictionary into.
+func Create(name string) (*Dictionary, error) {
+	driver, err := driverName()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open(driver, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dictionary file %s: %w", name, err)
+	}
+
+	d, err := New(db)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open dictionary file %s: %w", name, err)
+	}
+
+	return d, nil
+}
+
+// New returns a Dictionary stored in db, creating the tables if they do
+// not exist.
+func New(db *sql.DB) (*Dictionary, error) {
+	if _, err := db.Exec(Schema); err != nil {
+		return nil, fmt.Errorf("failed to create tables: %w", err)
+	}
+
+	return &Dictionary{db: db}, nil
+}
+
+func driverName() (string, error) {
+	registered := sql.Drivers()
+	for _, name := range driverNames {
+		for _, r := range registered {
+			if r == name {
+				return name, nil
+			}
+		}
+	}
+
+	return "", ErrNoDriver
+}
+
+func (d *Dictionary) Search(ctx context.Context, key string) ([]dict.Candidate, error) {
+	rows, err := d.db.QueryContext(ctx, `SELECT text, annotation FROM entries WHERE key = ? ORDER BY id`, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []dict.Candidate
+	for rows.Next() {
+		var text, annotation string
+		if err := rows.Scan(&text, &annotation); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, dict.NewCandidate(text, annotation))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return candidates, nil
+}
+
+// Complete returns the keys starting with prefix in sorted order.
+func (d *Dictionary) Complete(ctx context.Context, prefix string) ([]string, error) {
+	if prefix == "" {
+		return nil, nil
+	}
+
+	// the keys in [prefix, prefix+U+10FFFF) start with prefix, and the
+	// range can use the index of key unlike LIKE
+	rows, err := d.db.QueryContext(ctx,
+		`SELECT DISTINCT key FROM entries WHERE key >= ? AND key < ? ORDER BY key`,
+		prefix, prefix+"\U0010FFFF")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (d *Dictionary) Stats() dict.Stats {
+	var stats dict.Stats
+	d.db.QueryRow(`SELECT COUNT(DISTINCT key), COUNT(*) FROM entries`).Scan(&stats.Keys, &stats.Candidates)
+
+	return stats
+}
+
+// AddEntry adds a candidate of key. It reports whether the candidate is
+// added, that is, key does not have a candidate with the same text yet.
+func (d *Dictionary) AddEntry(key, text, annotation string) (bool, error) {
+	res, err := d.db.Exec(
+		`INSERT OR IGNORE INTO entries (key, text, annotation) VALUES (?, ?, ?)`,
+		key, text, annotation)
+	if err != nil {
+		return false, fmt.Errorf("failed to add [%s] to dictionary: %w", key, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to add [%s] to dictionary: %w", key, err)
+	}
+
+	return n > 0, nil
+}
+
+// Import adds all the entries of src in a transaction. Candidates already
+// in the database are left as they are.
+func (d *Dictionary) Import(src *dict.Dictionary) error {
+	ctx := context.Background()
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to import dictionary: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, `INSERT OR IGNORE INTO entries (key, text, annotation) VALUES (?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to import dictionary: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, key := range src.Keys() {
+		candidates, err := src.Search(ctx, key)
+		if err != nil {
+			return fmt.Errorf("failed to import dictionary: %w", err)
+		}
+		for _, c := range candidates {
+			if _, err := stmt.ExecContext(ctx, key, c.Text(), c.Annotation()); err != nil {
+				return fmt.Errorf("failed to import [%s]: %w", key, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to import dictionary: %w", err)
+	}
+
+	return nil
+}
+
+func (d *Dictionary) Close() error {
+	return d.db.Close()
+}
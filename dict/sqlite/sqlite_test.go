@@ -0,0 +1,20 @@
+package sqlite
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenNotExist(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "SKK-JISYO.sqlite")
+
+	if _, err := Open(name); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open() error = %v, want %v", err, fs.ErrNotExist)
+	}
+	if _, err := os.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open() created %s", name)
+	}
+}
@@ -0,0 +1,135 @@
+package dict
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Standard is a dictionary distributed by the SKK project, with the URL of
+// its MD5 checksum.
+type Standard struct {
+	Name        string
+	URL         string
+	ChecksumURL string
+}
+
+const standardBaseURL = "https://skk-dev.github.io/dict/"
+
+// StandardDictionaries are the dictionaries FetchStandard knows.
+var StandardDictionaries = []Standard{
+	newStandard("SKK-JISYO.L"),
+	newStandard("SKK-JISYO.M"),
+	newStandard("SKK-JISYO.S"),
+	newStandard("SKK-JISYO.jinmei"),
+	newStandard("SKK-JISYO.fullname"),
+	newStandard("SKK-JISYO.geo"),
+	newStandard("SKK-JISYO.propernoun"),
+	newStandard("SKK-JISYO.station"),
+	newStandard("SKK-JISYO.law"),
+	newStandard("SKK-JISYO.okinawa"),
+	newStandard("SKK-JISYO.assoc"),
+}
+
+// DefaultStandard is the name of the dictionary fetched by FetchStandard
+// without names.
+const DefaultStandard = "SKK-JISYO.L"
+
+func newStandard(name string) Standard {
+	return Standard{
+		Name:        name,
+		URL:         standardBaseURL + name + ".gz",
+		ChecksumURL: standardBaseURL + name + ".gz.md5",
+	}
+}
+
+var ErrChecksum = errors.New("checksum mismatch")
+
+// FetchStandard returns the local file names of the named standard
+// dictionaries, or of DefaultStandard if no names are given, downloading
+// the ones not downloaded yet. A downloaded file is verified against its
+// checksum.
+func (f *Fetcher) FetchStandard(ctx context.Context, names ...string) ([]string, error) {
+	if len(names) == 0 {
+		names = []string{DefaultStandard}
+	}
+
+	var files []string
+	for _, name := range names {
+		std, ok := lookupStandard(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown standard dictionary: %s", name)
+		}
+
+		file := f.Path(std.URL)
+		if _, err := os.Stat(file); err != nil {
+			sum, err := f.checksum(ctx, std.ChecksumURL)
+			if err != nil {
+				return nil, fmt.Errorf("failed to download checksum %s: %w", std.ChecksumURL, err)
+			}
+			if _, err := f.download(ctx, std.URL, file, nil, func(name string) error {
+				return verifyMD5(name, sum)
+			}); err != nil {
+				return nil, err
+			}
+		}
+		files = append(files, file)
+	}
+
+	return files, nil
+}
+
+func lookupStandard(name string) (Standard, bool) {
+	for _, std := range StandardDictionaries {
+		if std.Name == name {
+			return std, true
+		}
+	}
+
+	return Standard{}, false
+}
+
+// checksum downloads a checksum file in the form of md5sum, and returns
+// the checksum in it.
+func (f *Fetcher) checksum(ctx context.Context, rawURL string) (string, error) {
+	resp, err := f.get(ctx, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	line, err := bufio.NewReader(io.LimitReader(resp.Body, 4096)).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", errors.New("empty checksum file")
+	}
+
+	return strings.ToLower(fields[0]), nil
+}
+
+func verifyMD5(name, sum string) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != sum {
+		return ErrChecksum
+	}
+
+	return nil
+}
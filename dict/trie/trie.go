@@ -0,0 +1,265 @@
+// Package trie provides a read-only dictionary whose keys are stored in a
+// double-array trie. It takes much less memory than Dictionary for large
+// dictionaries, and completes keys by traversing the trie.
+package trie
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/kechako/goskkserv/dict"
+)
+
+// Trie is a read-only dictionary of a double-array trie. The children of
+// node s are at base[s]+c, where c is the byte of the key plus one, and c
+// 0 is the terminator of a key. A slot t belongs to s if check[t] is s.
+// The terminator has the negative value -(i+1) as its base, where i is the
+// index of the candidates of the key.
+type Trie struct {
+	base  []int32
+	check []int32
+
+	// the candidates of the i-th key in the form "/cand1/cand2/" are
+	// payload[offsets[i]:offsets[i+1]]
+	payload []byte
+	offsets []uint32
+
+	stats dict.Stats
+}
+
+var _ dict.Searcher = (*Trie)(nil)
+
+// Build builds a Trie of all the entries of src.
+func Build(src *dict.Dictionary) *Trie {
+	keys := src.Keys()
+
+	t := &Trie{
+		offsets: make([]uint32, 0, len(keys)+1),
+		stats:   src.Stats(),
+	}
+
+	var payload strings.Builder
+	for _, key := range keys {
+		t.offsets = append(t.offsets, uint32(payload.Len()))
+		src.WriteCandidates(&payload, key)
+	}
+	t.offsets = append(t.offsets, uint32(payload.Len()))
+	t.payload = []byte(payload.String())
+
+	b := &builder{t: t, keys: keys, next: 1}
+	b.grow(256)
+	t.check[0] = 0
+	if len(keys) > 0 {
+		b.insert(0, 0, len(keys), 0)
+	}
+
+	// drop the unused slots at the end
+	n := len(t.check)
+	for n > 1 && t.check[n-1] < 0 {
+		n--
+	}
+	t.base = t.base[:n:n]
+	t.check = t.check[:n:n]
+
+	return t
+}
+
+type builder struct {
+	t    *Trie
+	keys []string
+
+	// next is the first slot that may be free
+	next int
+}
+
+func (b *builder) grow(n int) {
+	for len(b.t.check) < n {
+		b.t.base = append(b.t.base, 0)
+		b.t.check = append(b.t.check, -1)
+	}
+}
+
+// insert adds the children of node s for keys[lo:hi], which share the
+// first depth bytes.
+func (b *builder) insert(s int32, lo, hi, depth int) {
+	type child struct {
+		code   int
+		lo, hi int
+	}
+
+	// the keys are sorted, so the children come in the order of code
+	var children []child
+	for i := lo; i < hi; i++ {
+		code := 0
+		if len(b.keys[i]) > depth {
+			code = int(b.keys[i][depth]) + 1
+		}
+		if n := len(children); n > 0 && children[n-1].code == code {
+			children[n-1].hi = i + 1
+			continue
+		}
+		children = append(children, child{code: code, lo: i, hi: i + 1})
+	}
+
+	first, last := children[0].code, children[len(children)-1].code
+	base := b.findBase(first, last, func(base int) bool {
+		for _, c := range children {
+			if b.t.check[base+c.code] >= 0 {
+				return false
+			}
+		}
+		return true
+	})
+
+	b.t.base[s] = int32(base)
+	for _, c := range children {
+		b.t.check[base+c.code] = s
+	}
+	for _, c := range children {
+		t := int32(base + c.code)
+		if c.code == 0 {
+			b.t.base[t] = -int32(c.lo) - 1
+			continue
+		}
+		b.insert(t, c.lo, c.hi, depth+1)
+	}
+}
+
+// findBase returns the smallest base for the children of the codes from
+// first to last such that fits reports true, growing the arrays to hold
+// them.
+func (b *builder) findBase(first, last int, fits func(base int) bool) int {
+	for b.next < len(b.t.check) && b.t.check[b.next] >= 0 {
+		b.next++
+	}
+
+	for pos := b.next; ; pos++ {
+		b.grow(pos + 1)
+		if b.t.check[pos] >= 0 {
+			continue
+		}
+		base := pos - first
+		if base < 1 {
+			continue
+		}
+		b.grow(base + last + 1)
+		if fits(base) {
+			return base
+		}
+	}
+}
+
+// lookup returns the index of key, or -1 if key is not found.
+func (t *Trie) lookup(key string) int {
+	s, ok := t.walk(key)
+	if !ok {
+		return -1
+	}
+
+	n := int(t.base[s])
+	if n < 0 || n >= len(t.check) || t.check[n] != s || t.base[n] >= 0 {
+		return -1
+	}
+
+	return int(-t.base[n] - 1)
+}
+
+// walk returns the node of prefix.
+func (t *Trie) walk(prefix string) (int32, bool) {
+	if len(t.base) == 0 {
+		return 0, false
+	}
+
+	var s int32
+	for i := 0; i < len(prefix); i++ {
+		n := int(t.base[s]) + int(prefix[i]) + 1
+		if t.base[s] < 0 || n >= len(t.check) || t.check[n] != s {
+			return 0, false
+		}
+		s = int32(n)
+	}
+
+	return s, true
+}
+
+func (t *Trie) candidates(key string) []byte {
+	i := t.lookup(key)
+	if i < 0 {
+		return nil
+	}
+
+	return t.payload[t.offsets[i]:t.offsets[i+1]]
+}
+
+func (t *Trie) Search(ctx context.Context, key string) ([]dict.Candidate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return dict.ParseCandidates(string(t.candidates(key))), nil
+}
+
+// WriteCandidates writes the candidates of key in the form "/cand1/cand2/"
+// to w. It reports whether key is found.
+func (t *Trie) WriteCandidates(w io.Writer, key string) (bool, error) {
+	candidates := t.candidates(key)
+	if len(candidates) == 0 {
+		return false, nil
+	}
+
+	if _, err := w.Write(candidates); err != nil {
+		return true, err
+	}
+
+	return true, nil
+}
+
+// Complete returns the keys starting with prefix in sorted order.
+func (t *Trie) Complete(ctx context.Context, prefix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if prefix == "" {
+		return nil, nil
+	}
+
+	s, ok := t.walk(prefix)
+	if !ok {
+		return nil, nil
+	}
+
+	var keys []string
+	t.traverse(s, []byte(prefix), func(key []byte) {
+		keys = append(keys, string(key))
+	})
+
+	return keys, nil
+}
+
+// traverse calls fn with the keys under node s in sorted order.
+func (t *Trie) traverse(s int32, key []byte, fn func(key []byte)) {
+	base := int(t.base[s])
+	if base < 0 {
+		return
+	}
+
+	for code := 0; code <= 256; code++ {
+		n := base + code
+		if n >= len(t.check) {
+			break
+		}
+		if t.check[n] != s {
+			continue
+		}
+		if code == 0 {
+			fn(key)
+			continue
+		}
+		t.traverse(int32(n), append(key, byte(code-1)), fn)
+	}
+}
+
+func (t *Trie) Stats() dict.Stats {
+	return t.stats
+}
@@ -0,0 +1,110 @@
+package dict
+
+import (
+	"errors"
+
+	"github.com/kechako/goskkserv/dict/jisyo"
+)
+
+var ErrTxDone = errors.New("transaction has already been committed or rolled back")
+
+// Tx is a batch of changes to a Dictionary. The changes are made on a new
+// snapshot aside, and Commit swaps it in at once, so searches never see a
+// partly applied batch and are never blocked by it. Other changes of the
+// Dictionary wait until the Tx is committed or rolled back.
+type Tx struct {
+	d *Dictionary
+	b *builder
+}
+
+// Begin starts a Tx. The caller must call Commit or Rollback.
+func (d *Dictionary) Begin() *Tx {
+	d.mu.Lock()
+
+	b := newBuilder(d.load())
+	b.onParseError = d.onParseError
+	b.mergeAnnotations = d.mergeAnnotations
+	b.order = d.order
+	b.normalize = d.normalize
+	b.normalizeText = d.normalizeText
+	b.emoji = d.emoji
+
+	return &Tx{
+		d: d,
+		b: b,
+	}
+}
+
+// Add adds a candidate of key. It reports whether the candidate is added,
+// that is, key does not have a candidate with the same text yet.
+func (tx *Tx) Add(key, text, annotation string) bool {
+	if tx.b == nil {
+		return false
+	}
+
+	return tx.b.add(normalizeKey(tx.b.normalize, key), tx.b.text(text), tx.b.text(annotation))
+}
+
+// AddJisyoEntry adds the candidates and the okuri blocks of e, as if read
+// from a SKK-JISYO file, such as an entry of jisyo.Decoder.
+func (tx *Tx) AddJisyoEntry(e jisyo.Entry) {
+	if tx.b == nil {
+		return
+	}
+
+	tx.b.addEntry(e)
+}
+
+// Remove removes all the candidates of key. It reports whether key is
+// found.
+func (tx *Tx) Remove(key string) bool {
+	if tx.b == nil {
+		return false
+	}
+
+	return tx.b.remove(normalizeKey(tx.b.normalize, key))
+}
+
+// Clear removes all the entries, such as for reloading the dictionary.
+func (tx *Tx) Clear() {
+	if tx.b == nil {
+		return
+	}
+
+	tx.b.clear()
+}
+
+// AddFile adds the entries of the named SKK-JISYO file.
+func (tx *Tx) AddFile(name string) error {
+	if tx.b == nil {
+		return ErrTxDone
+	}
+
+	return tx.b.addSource(Source{Name: name})
+}
+
+// Commit applies the changes to the Dictionary.
+func (tx *Tx) Commit() error {
+	if tx.b == nil {
+		return ErrTxDone
+	}
+
+	tx.d.snap.Store(tx.b.snapshot())
+	tx.b = nil
+	tx.d.mu.Unlock()
+
+	return nil
+}
+
+// Rollback discards the changes. It returns ErrTxDone after Commit, so it
+// can be deferred.
+func (tx *Tx) Rollback() error {
+	if tx.b == nil {
+		return ErrTxDone
+	}
+
+	tx.b = nil
+	tx.d.mu.Unlock()
+
+	return nil
+}
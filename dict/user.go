@@ -0,0 +1,229 @@
+package dict
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UserDictionary is the writable dictionary of a user, which new entries
+// are added to and which is saved to its file. The other dictionaries are
+// read-only, and their files are never changed.
+type UserDictionary struct {
+	*Dictionary
+
+	name string
+	freq *Frequency
+
+	// autosave, and saving serializes Flush
+	saving    sync.Mutex
+	mu        sync.Mutex
+	delay     time.Duration
+	saveError func(err error)
+	timer     *time.Timer
+	dirty     bool
+}
+
+// OpenUserDictionary loads the named user dictionary file, and the
+// frequency of its candidates from the file of the name with ".freq"
+// appended. The files do not have to exist yet; they are made by Save.
+func OpenUserDictionary(name string) (*UserDictionary, error) {
+	u := &UserDictionary{
+		Dictionary: &Dictionary{},
+		name:       name,
+		freq:       NewFrequency(),
+	}
+	if err := u.Add(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if f, err := ReadFrequencyFile(u.freqName()); err == nil {
+		u.freq = f
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// Name returns the name of the file of u.
+func (u *UserDictionary) Name() string {
+	return u.name
+}
+
+func (u *UserDictionary) freqName() string {
+	return u.name + ".freq"
+}
+
+// Frequency returns the frequency of the candidates learned by Learn, to
+// rank the candidates of all the dictionaries by NewRanked.
+func (u *UserDictionary) Frequency() *Frequency {
+	return u.freq
+}
+
+// Learn records that the user selected the candidate of text of key. The
+// candidate is moved to the first of key in u, and its frequency is
+// counted up. u is saved, or let saved by AutoSave, as by Register.
+func (u *UserDictionary) Learn(key, text string) error {
+	if !validEntry(key, text) {
+		return errors.New("invalid entry")
+	}
+
+	u.promote(key, text)
+	u.freq.Add(key, text, 1)
+	if u.changed() {
+		return nil
+	}
+
+	return u.Save()
+}
+
+// Register adds a candidate of key registered by the user, and saves u,
+// or lets it saved by AutoSave. It reports whether the candidate is
+// added, that is, key does not have a candidate with the same text yet.
+func (u *UserDictionary) Register(key, text, annotation string) (bool, error) {
+	if !validEntry(key, text) {
+		return false, errors.New("invalid entry")
+	}
+
+	if !u.AddEntry(key, text, annotation) {
+		return false, nil
+	}
+	if u.changed() {
+		return true, nil
+	}
+
+	return true, u.Save()
+}
+
+// validEntry reports whether key and text make an entry of a candidate.
+func validEntry(key, text string) bool {
+	return key != "" && text != "" && !strings.ContainsAny(key, " \t\r\n")
+}
+
+// AutoSave makes u saved delay after the last change by Register or Learn,
+// so a burst of changes is saved at once. saveError, if not nil, is called
+// with the errors of saving. Call Flush at exit to save the last changes.
+func (u *UserDictionary) AutoSave(delay time.Duration, saveError func(err error)) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.delay = delay
+	u.saveError = saveError
+}
+
+// changed schedules saving u if AutoSave is enabled, and reports whether
+// it is.
+func (u *UserDictionary) changed() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.delay <= 0 {
+		return false
+	}
+	u.dirty = true
+	if u.timer == nil {
+		u.timer = time.AfterFunc(u.delay, u.autosave)
+	} else {
+		u.timer.Reset(u.delay)
+	}
+
+	return true
+}
+
+func (u *UserDictionary) autosave() {
+	if err := u.Flush(); err != nil {
+		u.mu.Lock()
+		saveError := u.saveError
+		u.mu.Unlock()
+		if saveError != nil {
+			saveError(err)
+		}
+	}
+}
+
+// Flush saves u if it has the changes not saved by AutoSave yet.
+func (u *UserDictionary) Flush() error {
+	u.saving.Lock()
+	defer u.saving.Unlock()
+
+	u.mu.Lock()
+	if u.timer != nil {
+		u.timer.Stop()
+		u.timer = nil
+	}
+	dirty := u.dirty
+	u.dirty = false
+	u.mu.Unlock()
+
+	if !dirty {
+		return nil
+	}
+	if err := u.Save(); err != nil {
+		// try again at the next change or Flush
+		u.mu.Lock()
+		u.dirty = true
+		u.mu.Unlock()
+		return err
+	}
+
+	return nil
+}
+
+// Save writes all the entries of u to its file as a UTF-8 SKK-JISYO file,
+// and the frequency to its file. The files are written to temporary files
+// first and renamed, so they are never left partly written.
+func (u *UserDictionary) Save() error {
+	if err := saveFile(u.name, u); err != nil {
+		return fmt.Errorf("failed to save user dictionary %s: %w", u.name, err)
+	}
+	if err := saveFile(u.freqName(), u.freq); err != nil {
+		return fmt.Errorf("failed to save frequency file %s: %w", u.freqName(), err)
+	}
+
+	return nil
+}
+
+// saveFile writes the named file by w through a temporary file.
+func saveFile(name string, w io.WriterTo) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := w.WriteTo(tmp); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+// SplitSources returns the writable source of sources, if any, and the
+// other read-only sources. At most one source can be writable.
+func SplitSources(sources []Source) (user *Source, system []Source, err error) {
+	for i, src := range sources {
+		if !src.Writable {
+			system = append(system, src)
+			continue
+		}
+		if user != nil {
+			return nil, nil, fmt.Errorf("more than one writable dictionary: %s and %s", user.Name, src.Name)
+		}
+		user = &sources[i]
+	}
+
+	return user, system, nil
+}
@@ -0,0 +1,47 @@
+package dict
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLearnSave(t *testing.T) {
+	for _, autosave := range []bool{false, true} {
+		name := filepath.Join(t.TempDir(), "user.jisyo")
+		u, err := OpenUserDictionary(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if autosave {
+			// long enough not to fire during the test
+			u.AutoSave(time.Hour, nil)
+		}
+		u.AddEntry("かんじ", "漢字", "")
+		u.AddEntry("かんじ", "感じ", "")
+
+		if err := u.Learn("かんじ", "感じ"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := os.Stat(name); autosave != errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("autosave %v: Stat() after Learn error = %v", autosave, err)
+		}
+		if err := u.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		u, err = OpenUserDictionary(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := searchTexts(t, u.Dictionary, "かんじ"), "感じ/漢字"; got != want {
+			t.Errorf("autosave %v: Search() after reopening = %q, want %q", autosave, got, want)
+		}
+		if got := u.Frequency().Count("かんじ", "感じ"); got != 1 {
+			t.Errorf("autosave %v: Count() after reopening = %d, want 1", autosave, got)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package dict
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// ParseError is a malformed entry of a SKK-JISYO file.
+type ParseError struct {
+	// Name is the name of the file, which is empty if it is not known.
+	Name   string
+	Line   int
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+	}
+
+	return fmt.Sprintf("%s:%d: %s", e.Name, e.Line, e.Reason)
+}
+
+// Validate reads a SKK-JISYO file from r as Load, and returns all its
+// malformed entries. name is used for the ParseErrors.
+func Validate(name string, r io.Reader, opts ...Option) ([]*ParseError, error) {
+	o := newOptions(opts)
+
+	var errs []*ParseError
+	b := newBuilder(emptySnapshot)
+	b.source = name
+	b.onParseError = func(err *ParseError) error {
+		errs = append(errs, err)
+		return nil
+	}
+	if err := b.read(r, o.encoding); err != nil {
+		return errs, fmt.Errorf("failed to read dictionary %s: %w", name, err)
+	}
+
+	return errs, nil
+}
+
+// ValidateFile validates the named SKK-JISYO file as Validate.
+func ValidateFile(name string, opts ...Option) ([]*ParseError, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dictionary file %s: %w", name, err)
+	}
+	defer f.Close()
+
+	return Validate(name, f, opts...)
+}
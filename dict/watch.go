@@ -0,0 +1,200 @@
+package dict
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/kechako/goskkserv/log"
+)
+
+const defaultWatchDelay = 500 * time.Millisecond
+
+// Watcher reloads a Dictionary when its dictionary files change, so edits
+// of a personal dictionary take effect while the server runs.
+type Watcher struct {
+	Dictionary *Dictionary
+
+	// Dirs are directories of dictionary files, as given to Expand. The
+	// files added to them are attached to Dictionary, and the files
+	// removed from them are detached.
+	Dirs []string
+
+	// Delay is the time to wait for more changes after a change before
+	// reloading, as editors often write a file in several steps. Zero
+	// means 500ms.
+	Delay time.Duration
+
+	Logger log.Logger
+}
+
+// Run watches the files until ctx is done.
+func (w *Watcher) Run(ctx context.Context) error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch dictionaries: %w", err)
+	}
+	defer fw.Close()
+
+	// the directories are watched rather than the files, as editors
+	// often replace a file by renaming another one
+	dirs := make(map[string]struct{})
+	watch := func() {
+		for _, name := range w.watchDirs() {
+			if _, ok := dirs[name]; ok {
+				continue
+			}
+			if err := fw.Add(name); err != nil {
+				w.logger().Warnf("failed to watch %s: %v", name, err)
+				continue
+			}
+			dirs[name] = struct{}{}
+		}
+	}
+	watch()
+
+	timer := time.NewTimer(0)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	changed := false
+	for {
+		select {
+		case ev, ok := <-fw.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Has(fsnotify.Chmod) {
+				continue
+			}
+			if w.isSource(ev.Name) {
+				changed = true
+			} else if !w.inDirs(ev.Name) {
+				continue
+			}
+			timer.Reset(w.delay())
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return nil
+			}
+			w.logger().Warnf("failed to watch dictionaries: %v", err)
+		case <-timer.C:
+			w.update(changed)
+			changed = false
+			watch()
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// update attaches and detaches the files of Dirs, and reloads Dictionary
+// if changed.
+func (w *Watcher) update(changed bool) {
+	d := w.Dictionary
+	before := d.Stats()
+
+	if len(w.Dirs) > 0 {
+		files, _ := Expand(w.Dirs)
+		present := make(map[string]struct{}, len(files))
+		attached := make(map[string]struct{})
+		for _, src := range d.Sources() {
+			attached[absPath(src.Name)] = struct{}{}
+		}
+		for _, name := range files {
+			present[absPath(name)] = struct{}{}
+			if _, ok := attached[absPath(name)]; ok {
+				continue
+			}
+			if err := d.Attach(Source{Name: name}); err != nil {
+				w.logger().Warnf("failed to attach dictionary %s: %v", name, err)
+				continue
+			}
+			w.logger().Infof("dictionary %s is attached", name)
+		}
+		for _, src := range d.Sources() {
+			if _, ok := present[absPath(src.Name)]; ok || !w.inDirs(src.Name) {
+				continue
+			}
+			if err := d.Detach(src.Name); err != nil {
+				w.logger().Warnf("failed to detach dictionary %s: %v", src.Name, err)
+				continue
+			}
+			w.logger().Infof("dictionary %s is detached", src.Name)
+		}
+	}
+
+	if changed {
+		if _, err := d.Reload(); err != nil {
+			w.logger().Warn(err)
+			return
+		}
+	}
+
+	after := d.Stats()
+	if after != before {
+		w.logger().Infof("dictionary is reloaded: %d keys (%+d), %d candidates (%+d)",
+			after.Keys, after.Keys-before.Keys, after.Candidates, after.Candidates-before.Candidates)
+	}
+}
+
+// watchDirs returns the directories to watch.
+func (w *Watcher) watchDirs() []string {
+	var dirs []string
+	for _, src := range w.Dictionary.Sources() {
+		dirs = append(dirs, filepath.Dir(absPath(src.Name)))
+	}
+	for _, dir := range w.Dirs {
+		dirs = append(dirs, absPath(dir))
+	}
+
+	return dirs
+}
+
+func (w *Watcher) isSource(name string) bool {
+	name = absPath(name)
+	for _, src := range w.Dictionary.Sources() {
+		if absPath(src.Name) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w *Watcher) inDirs(name string) bool {
+	dir := filepath.Dir(absPath(name))
+	for _, d := range w.Dirs {
+		if absPath(d) == dir {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w *Watcher) delay() time.Duration {
+	if w.Delay > 0 {
+		return w.Delay
+	}
+
+	return defaultWatchDelay
+}
+
+func (w *Watcher) logger() log.Logger {
+	if w.Logger != nil {
+		return w.Logger
+	}
+
+	return nopLogger
+}
+
+func absPath(name string) string {
+	if path, err := filepath.Abs(name); err == nil {
+		return path
+	}
+
+	return name
+}
@@ -0,0 +1,149 @@
+package dict
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/kechako/goskkserv/dict/jisyo"
+	"golang.org/x/text/transform"
+)
+
+// WriteOption is an option of Write.
+type WriteOption func(*writeOptions)
+
+type writeOptions struct {
+	encoding         string
+	stripAnnotations bool
+}
+
+// WriteEncoding makes Write encode the file to enc, such as "euc-jp",
+// instead of to UTF-8. It is an error if a candidate cannot be encoded.
+func WriteEncoding(enc string) WriteOption {
+	return func(o *writeOptions) {
+		o.encoding = enc
+	}
+}
+
+// StripAnnotations makes Write leave out the annotations.
+func StripAnnotations() WriteOption {
+	return func(o *writeOptions) {
+		o.stripAnnotations = true
+	}
+}
+
+// Write writes all the entries of d to w as a SKK-JISYO file, with the
+// magic comment of its encoding. The okuri-ari entries come first in the
+// reverse order of keys, and then the okuri-nasi entries in the order of
+// keys, as SKK does. The candidates that would break the file are quoted
+// by jisyo.Quote.
+func Write(w io.Writer, d *Dictionary, opts ...WriteOption) error {
+	o := &writeOptions{encoding: "utf-8"}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	_, err := d.write(w, o)
+
+	return err
+}
+
+// WriteTo writes all the entries of d to w as a UTF-8 SKK-JISYO file, as
+// Write.
+func (d *Dictionary) WriteTo(w io.Writer) (int64, error) {
+	return d.write(w, &writeOptions{encoding: "utf-8"})
+}
+
+func (d *Dictionary) write(w io.Writer, o *writeOptions) (int64, error) {
+	enc, err := jisyo.LookupEncoding(o.encoding)
+	if err != nil {
+		return 0, err
+	}
+
+	s := d.load()
+	var ari, nasi []string
+	for _, key := range s.keys() {
+		if s.get(key).okuri {
+			ari = append(ari, key)
+		} else {
+			nasi = append(nasi, key)
+		}
+	}
+	for i, j := 0, len(ari)-1; i < j; i, j = i+1, j-1 {
+		ari[i], ari[j] = ari[j], ari[i]
+	}
+
+	cw := &countWriter{w: w}
+	ew := transform.NewWriter(cw, enc.NewEncoder())
+	bw := bufio.NewWriter(ew)
+	fmt.Fprintf(bw, ";; -*- mode: fundamental; coding: %s -*-\n", o.encoding)
+	bw.WriteString(jisyo.OkuriAriMarker + "\n")
+	writeEntries(bw, s, ari, o)
+	bw.WriteString(jisyo.OkuriNasiMarker + "\n")
+	writeEntries(bw, s, nasi, o)
+	if err := bw.Flush(); err != nil {
+		return cw.n, fmt.Errorf("failed to write dictionary: %w", err)
+	}
+	if err := ew.Close(); err != nil {
+		return cw.n, fmt.Errorf("failed to write dictionary: %w", err)
+	}
+
+	return cw.n, nil
+}
+
+func writeEntries(bw *bufio.Writer, s *snapshot, keys []string, o *writeOptions) {
+	for _, key := range keys {
+		bw.WriteString(key)
+		bw.WriteString(" /")
+		for _, c := range s.get(key).candidates {
+			writeCandidate(bw, c, o)
+		}
+		for _, ob := range s.get(key).blocks {
+			bw.WriteByte('[')
+			bw.WriteString(ob.okuri)
+			bw.WriteByte('/')
+			for _, c := range ob.candidates {
+				writeCandidate(bw, c, o)
+			}
+			bw.WriteString("]/")
+		}
+		bw.WriteByte('\n')
+	}
+}
+
+func writeCandidate(bw *bufio.Writer, c Candidate, o *writeOptions) {
+	bw.WriteString(EscapeText(c.Text()))
+	if c.Annotation() != "" && !o.stripAnnotations {
+		bw.WriteByte(';')
+		bw.WriteString(EscapeAnnotation(c.Annotation()))
+	}
+	bw.WriteByte('/')
+}
+
+// Keys returns the keys that have candidates in sorted order.
+func (d *Dictionary) Keys() []string {
+	return d.load().keys()
+}
+
+// Walk calls fn with each key that has candidates and its candidates, in
+// sorted order of the keys, until fn returns false. The entries are those
+// when Walk is called; the changes during it are not seen.
+func (d *Dictionary) Walk(fn func(key string, candidates []Candidate) bool) {
+	s := d.load()
+	for _, key := range s.keys() {
+		if !fn(key, s.get(key).Candidates()) {
+			return
+		}
+	}
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
@@ -26,7 +26,7 @@ func ParseEncoding(s string) (Encoding, error) {
 	return "", errors.New("invalid encoding")
 }
 
-func (enc Encoding) encoding() encoding.Encoding {
+func (enc Encoding) TextEncoding() encoding.Encoding {
 	switch enc {
 	case UTF8:
 		return unicode.UTF8
@@ -1,5 +1,18 @@
 module github.com/kechako/goskkserv
 
-go 1.15
+go 1.22
 
-require golang.org/x/text v0.3.3
+require (
+	github.com/blevesearch/vellum v1.0.10
+	github.com/fsnotify/fsnotify v1.9.0
+	github.com/klauspost/compress v1.18.0
+	github.com/ulikunitz/xz v0.5.15
+	github.com/yuin/gopher-lua v1.1.1
+	golang.org/x/text v0.3.3
+)
+
+require (
+	github.com/bits-and-blooms/bitset v1.2.0 // indirect
+	github.com/blevesearch/mmap-go v1.0.4 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+)
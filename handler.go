@@ -0,0 +1,542 @@
+package skkserv
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/kechako/goskkserv/dict"
+	"github.com/kechako/goskkserv/dict/jisyo"
+	"github.com/kechako/goskkserv/log"
+	"github.com/kechako/goskkserv/translit"
+)
+
+// Handler generates the responses to skkserv requests, independently of
+// the connection the requests come from.
+type Handler struct {
+	Dictionary     dict.Searcher
+	Transliterator translit.Transliterator
+	SearchTimeout  time.Duration
+	Logger         log.Logger
+
+	// Providers are queried after Dictionary, as Providers of Server.
+	Providers []dict.Provider
+	// Filters post-process the candidates, as Filters of Server.
+	Filters []dict.Filter
+
+	// EvalCandidates makes the candidates of Lisp forms evaluated, as
+	// EvalCandidates of Server.
+	EvalCandidates bool
+	// Replacer, if not nil, is applied to the candidates, as Replacer of
+	// Server.
+	Replacer *strings.Replacer
+	// LegacyAnnotations makes the annotations sent after "; ", as
+	// LegacyAnnotations of Server.
+	LegacyAnnotations bool
+	// MaxCandidates, if positive, limits the number of the candidates of
+	// a response, as MaxCandidates of Server. It may be changed between
+	// requests.
+	MaxCandidates int
+	// MaxCompletions, if positive, limits the number of the keys of a
+	// completion response, as MaxCompletions of Server.
+	MaxCompletions int
+
+	// UserDictionary, if not nil, learns the candidates selected, as
+	// UserDictionary of Server.
+	UserDictionary *dict.UserDictionary
+	// AllowLearn enables ClientLearn, and AllowRegister ClientRegister, for
+	// the client.
+	AllowLearn    bool
+	AllowRegister bool
+
+	// Host is the response to the host request.
+	Host string
+}
+
+// Handle writes the response to req to w. req is a single request as read
+// by ReadRequest, decoded to UTF-8. Nothing is written for unknown
+// requests. It reports whether req ends the session.
+func (h *Handler) Handle(ctx context.Context, w *bytes.Buffer, req []byte) (end bool) {
+	if len(req) == 0 {
+		return false
+	}
+
+	if req[0] == ClientRequest {
+		// the requests of candidates, which are the most frequent, are
+		// served without allocations
+		h.request(ctx, w, req)
+		return false
+	}
+
+	cmd := string(req)
+	switch cmd[0] {
+	case ClientEnd:
+		return true
+	case ClientVersion:
+		h.logger().Debug("VERSION")
+		w.WriteString("goskkserv-1.0")
+	case ClientHost:
+		h.logger().Debug("HOST")
+		w.WriteString(h.Host)
+	case ClientCompletion:
+		i := strings.IndexAny(cmd, " \n")
+		if i < 0 {
+			i = len(cmd)
+		}
+
+		prefix := cmd[1:i]
+		h.logger().Debugf("COMPLETION: prefix : %s", prefix)
+
+		keys, err := h.complete(ctx, prefix)
+		if err != nil {
+			h.logger().Warnf("failed to complete [%s]: %v", prefix, err)
+		}
+		if len(keys) > 0 {
+			w.WriteByte(ServerFound)
+			w.WriteByte('/')
+			for _, key := range keys {
+				w.WriteString(key)
+				w.WriteByte('/')
+			}
+			w.WriteByte('\n')
+		} else {
+			w.WriteByte(ServerNotFound)
+			w.WriteString(cmd[1:])
+			h.logger().Debug("COMPLETION: not found")
+		}
+	case ClientLearn:
+		if h.UserDictionary == nil || !h.AllowLearn {
+			h.logger().Infof("UNKNOWN: message: %c/\"%s\"", cmd[0], cmd)
+			break
+		}
+		key, c, ok := parseEntry(cmd[1:])
+		if !ok {
+			h.logger().Debugf("LEARN: invalid: %s", cmd[1:])
+			w.WriteByte(ServerError)
+			w.WriteByte('\n')
+			break
+		}
+		h.logger().Debugf("LEARN: key : %s, candidate : %s", key, c.Text)
+		if !h.has(ctx, key, c.Text) {
+			h.logger().Debugf("LEARN: unknown candidate: %s", cmd[1:])
+			w.WriteByte(ServerError)
+			w.WriteByte('\n')
+			break
+		}
+		if err := h.UserDictionary.Learn(key, c.Text); err != nil {
+			h.logger().Warnf("failed to learn [%s]: %v", key, err)
+			w.WriteByte(ServerError)
+			w.WriteByte('\n')
+			break
+		}
+		w.WriteByte(ServerFound)
+		w.WriteByte('\n')
+	case ClientRegister:
+		if h.UserDictionary == nil || !h.AllowRegister {
+			h.logger().Infof("UNKNOWN: message: %c/\"%s\"", cmd[0], cmd)
+			break
+		}
+		key, c, ok := parseEntry(cmd[1:])
+		if !ok {
+			h.logger().Debugf("REGISTER: invalid: %s", cmd[1:])
+			w.WriteByte(ServerError)
+			w.WriteByte('\n')
+			break
+		}
+		h.logger().Debugf("REGISTER: key : %s, candidate : %s", key, c.Text)
+		if _, err := h.UserDictionary.Register(key, c.Text, c.Annotation); err != nil {
+			h.logger().Warnf("failed to register [%s]: %v", key, err)
+			w.WriteByte(ServerError)
+			w.WriteByte('\n')
+			break
+		}
+		w.WriteByte(ServerFound)
+		w.WriteByte('\n')
+	default:
+		h.logger().Infof("UNKNOWN: message: %c/\"%s\"", cmd[0], cmd)
+	}
+
+	return false
+}
+
+// has reports whether Dictionary has the candidate of text of key, so the
+// clients can learn only the candidates they are served.
+func (h *Handler) has(ctx context.Context, key, text string) bool {
+	if h.SearchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.SearchTimeout)
+		defer cancel()
+	}
+
+	candidates, err := h.dict().Search(ctx, key)
+	if err != nil {
+		h.logger().Warnf("failed to search [%s]: %v", key, err)
+		return false
+	}
+	for _, c := range candidates {
+		if c.Text() == text {
+			return true
+		}
+	}
+
+	return false
+}
+
+// request writes the response to the request of the candidates of a key.
+func (h *Handler) request(ctx context.Context, w *bytes.Buffer, req []byte) {
+	i := bytes.IndexAny(req, " \n")
+	if i < 0 {
+		i = len(req)
+	}
+
+	key := req[1:i]
+	debug := log.Enabled(h.logger(), log.Debug)
+	if debug {
+		h.logger().Debugf("REQUEST: key : %s", key)
+	}
+
+	start := w.Len()
+	w.WriteByte(ServerFound)
+	var found bool
+	if cw, ok := h.dict().(candidatesWriter); ok && h.rendered() {
+		// the key is not copied, as candidatesWriter does not retain it
+		found, _ = cw.WriteCandidates(w, unsafe.String(unsafe.SliceData(key), len(key)))
+		if found && h.MaxCandidates > 0 {
+			w.Truncate(start + 1 + truncateCandidates(w.Bytes()[start+1:], h.MaxCandidates))
+		}
+	} else {
+		candidates, err := h.search(ctx, string(key))
+		if err != nil {
+			h.logger().Warnf("failed to search [%s]: %v", key, err)
+		}
+		if h.MaxCandidates > 0 && len(candidates) > h.MaxCandidates {
+			candidates = candidates[:h.MaxCandidates]
+		}
+		found = h.writeCandidates(w, candidates)
+	}
+	if found {
+		w.WriteByte('\n')
+		if debug {
+			h.logger().Debugf("REQUEST: candidate: %s", bytes.TrimSpace(w.Bytes()[start:]))
+		}
+	} else {
+		w.Truncate(start)
+		w.WriteByte(ServerNotFound)
+		w.Write(req[1:])
+		h.logger().Debug("REQUEST: not found")
+	}
+}
+
+func (h *Handler) search(ctx context.Context, key string) ([]dict.Candidate, error) {
+	if h.SearchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.SearchTimeout)
+		defer cancel()
+	}
+
+	candidates, err := h.candidates(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range h.Filters {
+		filtered, err := f.Filter(ctx, key, candidates)
+		if err != nil {
+			h.logger().Warnf("failed to filter candidates of [%s]: %v", key, err)
+			continue
+		}
+		candidates = filtered
+	}
+
+	return candidates, nil
+}
+
+// candidates returns the candidates of key from Dictionary, Providers and
+// Transliterator.
+func (h *Handler) candidates(ctx context.Context, key string) ([]dict.Candidate, error) {
+	candidates, err := h.dict().Search(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if h.EvalCandidates {
+		candidates = h.eval(candidates)
+	}
+	for _, p := range h.Providers {
+		provided, err := p.Candidates(ctx, key)
+		if err != nil {
+			h.logger().Warnf("failed to provide candidates of [%s]: %v", key, err)
+			continue
+		}
+		candidates = appendCandidates(candidates, provided)
+	}
+	if h.Transliterator == nil {
+		return candidates, nil
+	}
+
+	results, err := h.Transliterator.Transliterate(ctx, key)
+	if err != nil {
+		h.logger().Warnf("failed to transliterate [%s]: %v", key, err)
+		return candidates, nil
+	}
+	translit.SortByScore(results)
+
+	seen := make(map[string]struct{}, len(candidates)+len(results))
+	for _, c := range candidates {
+		seen[c.Text()] = struct{}{}
+	}
+	for _, r := range results {
+		if _, ok := seen[r.Text]; ok {
+			continue
+		}
+		seen[r.Text] = struct{}{}
+		candidates = append(candidates, dict.NewCandidate(r.Text, ""))
+	}
+
+	return candidates, nil
+}
+
+// appendCandidates appends the candidates of more to candidates, except
+// those with the same text as one already in them.
+func appendCandidates(candidates, more []dict.Candidate) []dict.Candidate {
+	if len(more) == 0 {
+		return candidates
+	}
+
+	seen := make(map[string]struct{}, len(candidates)+len(more))
+	for _, c := range candidates {
+		seen[c.Text()] = struct{}{}
+	}
+	// do not append to the slice owned by the dictionary
+	candidates = candidates[:len(candidates):len(candidates)]
+	for _, c := range more {
+		if _, ok := seen[c.Text()]; ok {
+			continue
+		}
+		seen[c.Text()] = struct{}{}
+		candidates = append(candidates, c)
+	}
+
+	return candidates
+}
+
+// eval evaluates the candidates of Lisp forms. The candidates that cannot
+// be evaluated are passed through.
+func (h *Handler) eval(candidates []dict.Candidate) []dict.Candidate {
+	var evaluated []dict.Candidate
+	for i, c := range candidates {
+		text, annotation := c.Text(), c.Annotation()
+		if jisyo.IsLisp(text) {
+			if v, err := jisyo.Eval(text); err == nil {
+				text = v
+			} else {
+				h.logger().Debugf("failed to evaluate [%s]: %v", text, err)
+			}
+		}
+		if jisyo.IsLisp(annotation) {
+			if v, err := jisyo.Eval(annotation); err == nil {
+				annotation = v
+			}
+		}
+		if text == c.Text() && annotation == c.Annotation() {
+			if evaluated != nil {
+				evaluated = append(evaluated, c)
+			}
+			continue
+		}
+
+		// do not change the slice owned by the dictionary
+		if evaluated == nil {
+			evaluated = append(make([]dict.Candidate, 0, len(candidates)), candidates[:i]...)
+		}
+		evaluated = append(evaluated, dict.NewSourceCandidate(text, annotation, c.Source()))
+	}
+	if evaluated == nil {
+		return candidates
+	}
+
+	return evaluated
+}
+
+func (h *Handler) complete(ctx context.Context, prefix string) ([]string, error) {
+	if h.SearchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.SearchTimeout)
+		defer cancel()
+	}
+
+	if h.MaxCompletions <= 0 {
+		return h.dict().Complete(ctx, prefix)
+	}
+	if ps, ok := h.dict().(prefixSearcher); ok {
+		if prefix == "" {
+			return nil, nil
+		}
+		return ps.SearchPrefix(prefix, h.MaxCompletions), nil
+	}
+
+	keys, err := h.dict().Complete(ctx, prefix)
+	if len(keys) > h.MaxCompletions {
+		keys = keys[:h.MaxCompletions]
+	}
+
+	return keys, err
+}
+
+func (h *Handler) dict() dict.Searcher {
+	if l, ok := h.Dictionary.(*dict.Lazy); ok {
+		// search the loaded dictionary directly, which may write the
+		// candidates faster
+		if s := l.Searcher(); s != nil {
+			return s
+		}
+		return emptyDict
+	}
+	if h.Dictionary != nil {
+		return h.Dictionary
+	}
+
+	return emptyDict
+}
+
+func (h *Handler) logger() log.Logger {
+	if h.Logger != nil {
+		return h.Logger
+	}
+
+	return nopLogger
+}
+
+// candidatesWriter is implemented by dictionaries that can write
+// pre-rendered candidates. WriteCandidates must not retain key, which may
+// refer to the buffer of the request.
+type candidatesWriter interface {
+	WriteCandidates(w io.Writer, key string) (bool, error)
+}
+
+// prefixSearcher is implemented by dictionaries that can search the keys
+// starting with a prefix up to a limit.
+type prefixSearcher interface {
+	SearchPrefix(prefix string, limit int) []string
+}
+
+// parseEntry parses an entry of a single candidate in the form
+// "key /candidate;annotation/".
+func parseEntry(s string) (key string, c jisyo.Candidate, ok bool) {
+	e, err := jisyo.ParseLine(s)
+	if err != nil || e.Key == "" || len(e.Candidates) != 1 || len(e.Blocks) > 0 {
+		return "", jisyo.Candidate{}, false
+	}
+
+	return e.Key, e.Candidates[0], true
+}
+
+// rendered reports whether the candidates are sent as the dictionary
+// renders them, so they can be written by candidatesWriter.
+func (h *Handler) rendered() bool {
+	return h.Transliterator == nil && len(h.Providers) == 0 && len(h.Filters) == 0 && !h.EvalCandidates && h.Replacer == nil && !h.LegacyAnnotations
+}
+
+// writeCandidates writes candidates in the form "/cand1/cand2;annotation/"
+// to buf, replacing the characters of them by Replacer if it is not nil.
+// The candidates that would break the form are quoted by String.
+func (h *Handler) writeCandidates(buf *bytes.Buffer, candidates []dict.Candidate) bool {
+	if len(candidates) == 0 {
+		return false
+	}
+
+	buf.WriteByte('/')
+	for _, c := range candidates {
+		if r := h.Replacer; r != nil {
+			c = dict.NewCandidate(r.Replace(c.Text()), r.Replace(c.Annotation()))
+		}
+		if h.LegacyAnnotations && c.Annotation() != "" {
+			buf.WriteString(dict.EscapeText(c.Text()))
+			buf.WriteString("; ")
+			buf.WriteString(dict.EscapeAnnotation(c.Annotation()))
+		} else {
+			buf.WriteString(c.String())
+		}
+		buf.WriteByte('/')
+	}
+
+	return true
+}
+
+// truncateCandidates returns the length of the rendered candidates b, in
+// the form "/cand1/cand2/", cut after the first max candidates. The okuri
+// blocks after the candidates are dropped with the candidates after max.
+func truncateCandidates(b []byte, max int) int {
+	n := 0
+	for i := 1; i < len(b); {
+		j := bytes.IndexByte(b[i:], '/')
+		if j < 0 || b[i] == '[' {
+			break
+		}
+		i += j + 1
+		if n++; n == max {
+			if i < len(b) && b[i] != '[' {
+				return i
+			}
+			break
+		}
+	}
+
+	return len(b)
+}
+
+const maxRequestSize = 1024
+
+// ErrRequestTooLarge is returned by ReadRequest for a request longer than
+// the limit, which is discarded.
+var ErrRequestTooLarge = errors.New("skkserv: request too large")
+
+// ReadRequest reads a request into buf. A request is a command byte,
+// followed by a key terminated by a space or a newline for the request and
+// completion commands, or by an entry terminated by a newline for the
+// extensions such as ClientLearn. A key without a terminator ends where the
+// data received so far ends, as the clients send a request per packet.
+// A request longer than 1024 bytes is discarded through its terminator,
+// and ErrRequestTooLarge is returned.
+func ReadRequest(r *bufio.Reader, buf []byte) ([]byte, error) {
+	var c byte
+	var err error
+	for {
+		c, err = r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if c != ' ' && c != '\r' && c != '\n' {
+			break
+		}
+	}
+
+	buf = append(buf, c)
+	// the extensions have an entry terminated by a newline
+	entry := c == ClientLearn || c == ClientRegister
+	if c != ClientRequest && c != ClientCompletion && !entry {
+		return buf, nil
+	}
+
+	n := len(buf)
+	for r.Buffered() > 0 {
+		c, err = r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if n++; n <= maxRequestSize {
+			buf = append(buf, c)
+		}
+		if c == '\n' || c == ' ' && !entry {
+			break
+		}
+	}
+	if n > maxRequestSize {
+		return nil, ErrRequestTooLarge
+	}
+
+	return buf, nil
+}
@@ -0,0 +1,225 @@
+package skkserv
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/kechako/goskkserv/dict"
+)
+
+const testJisyo = `;; okuri-ari entries.
+おくr /送/贈/
+;; okuri-nasi entries.
+かんじ /漢字/感じ;feeling/
+かんじょう /感情/勘定/
+a/b /(concat "a\057b")/
+`
+
+func loadTestDictionary(t testing.TB) *dict.Dictionary {
+	t.Helper()
+
+	d, err := dict.Load(strings.NewReader(testJisyo), dict.Encoding("utf-8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return d
+}
+
+func TestHandle(t *testing.T) {
+	h := &Handler{
+		Dictionary: loadTestDictionary(t),
+		Host:       "127.0.0.1:1178",
+	}
+
+	tests := []struct {
+		req  string
+		want string
+		end  bool
+	}{
+		{req: "0", end: true},
+		{req: "1かんじ ", want: "1/漢字/感じ;feeling/\n"},
+		{req: "1かんじ\n", want: "1/漢字/感じ;feeling/\n"},
+		{req: "1おくr ", want: "1/送/贈/\n"},
+		{req: "1a/b ", want: "1/(concat \"a\\057b\")/\n"},
+		{req: "1ない ", want: "4ない "},
+		{req: "1", want: "4"},
+		{req: "2", want: "goskkserv-1.0"},
+		{req: "3", want: "127.0.0.1:1178"},
+		{req: "4かんじ ", want: "1/かんじ/かんじょう/\n"},
+		{req: "4ない ", want: "4ない "},
+		{req: "5かんじ /感じ/\n"},
+		{req: "6かんじ /幹事/\n"},
+		{req: "x"},
+	}
+	for _, tt := range tests {
+		var w bytes.Buffer
+		end := h.Handle(context.Background(), &w, []byte(tt.req))
+		if got := w.String(); got != tt.want || end != tt.end {
+			t.Errorf("Handle(%q) = %q, %v, want %q, %v", tt.req, got, end, tt.want, tt.end)
+		}
+	}
+}
+
+func TestHandleMaxCandidates(t *testing.T) {
+	d := loadTestDictionary(t)
+	for _, h := range []*Handler{
+		{Dictionary: d, MaxCandidates: 1},
+		// not rendered by the dictionary
+		{Dictionary: d, MaxCandidates: 1, LegacyAnnotations: true},
+	} {
+		var w bytes.Buffer
+		h.Handle(context.Background(), &w, []byte("1かんじ "))
+		if got, want := w.String(), "1/漢字/\n"; got != want {
+			t.Errorf("Handle() = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestHandleQuote(t *testing.T) {
+	h := &Handler{
+		Dictionary: loadTestDictionary(t),
+		Providers: []dict.Provider{dict.ProviderFunc(func(ctx context.Context, key string) ([]dict.Candidate, error) {
+			return []dict.Candidate{dict.NewCandidate("x/y", ""), dict.NewCandidate("x;y", "a/b")}, nil
+		})},
+	}
+
+	var w bytes.Buffer
+	h.Handle(context.Background(), &w, []byte("1かんじ "))
+	want := "1/漢字/感じ;feeling/(concat \"x\\057y\")/(concat \"x\\073y\");(concat \"a\\057b\")/\n"
+	if got := w.String(); got != want {
+		t.Errorf("Handle() = %q, want %q", got, want)
+	}
+}
+
+func TestHandleMaxCompletions(t *testing.T) {
+	d := loadTestDictionary(t)
+	for _, h := range []*Handler{
+		{Dictionary: d, MaxCompletions: 1},
+		// without SearchPrefix
+		{Dictionary: dict.Chain{d}, MaxCompletions: 1},
+	} {
+		var w bytes.Buffer
+		h.Handle(context.Background(), &w, []byte("4かんじ "))
+		if got, want := w.String(), "1/かんじ/\n"; got != want {
+			t.Errorf("Handle() = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestReadRequest(t *testing.T) {
+	long := strings.Repeat("b", maxRequestSize)
+
+	tests := []struct {
+		in   string
+		want []string
+		err  error
+	}{
+		{in: "1かんじ 1かんじょう ", want: []string{"1かんじ ", "1かんじょう "}},
+		{in: "1かんじ\n2\n0", want: []string{"1かんじ\n", "2", "0"}},
+		{in: "\r\n 1かんじ", want: []string{"1かんじ"}},
+		{in: "5かんじ /感じ/\n1かんじ ", want: []string{"5かんじ /感じ/\n", "1かんじ "}},
+		{in: "1" + long[:maxRequestSize-2] + " 2", want: []string{"1" + long[:maxRequestSize-2] + " ", "2"}},
+		{in: "1" + long + "0 \n2", want: []string{"", "2"}, err: ErrRequestTooLarge},
+		{in: "5" + long + " /x/\n2", want: []string{"", "2"}, err: ErrRequestTooLarge},
+	}
+	for _, tt := range tests {
+		r := bufio.NewReaderSize(strings.NewReader(tt.in), 4096)
+		// fill the buffer as if the data were received at once
+		r.Peek(1)
+
+		var got []string
+		var errs []error
+		for {
+			req, err := ReadRequest(r, nil)
+			if err == io.EOF {
+				break
+			}
+			got = append(got, string(req))
+			errs = append(errs, err)
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("ReadRequest(%.20q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if tt.err != nil && !errors.Is(errs[0], tt.err) {
+			t.Errorf("ReadRequest(%.20q) error = %v, want %v", tt.in, errs[0], tt.err)
+		}
+	}
+}
+
+func FuzzHandle(f *testing.F) {
+	for _, seed := range []string{
+		"1かんじ ",
+		"1かんじ\n4かん ",
+		"1おくr \n",
+		"2\n3\n",
+		"5かんじ /感じ/\n",
+		"6かんじ /幹事;annotation/\n",
+		"1a/b 1" + strings.Repeat("b", maxRequestSize) + " ",
+		"\r\n1 0",
+	} {
+		f.Add([]byte(seed))
+	}
+
+	d := loadTestDictionary(f)
+	f.Fuzz(func(t *testing.T, in []byte) {
+		h := &Handler{Dictionary: d, MaxCandidates: 2}
+		r := bufio.NewReaderSize(bytes.NewReader(in), 4096)
+		r.Peek(1)
+
+		var w bytes.Buffer
+		for {
+			req, err := ReadRequest(r, nil)
+			if errors.Is(err, ErrRequestTooLarge) {
+				continue
+			}
+			if err != nil {
+				break
+			}
+			if len(req) > maxRequestSize {
+				t.Fatalf("ReadRequest() = %d bytes, want at most %d", len(req), maxRequestSize)
+			}
+
+			w.Reset()
+			if h.Handle(context.Background(), &w, req) {
+				break
+			}
+			if req[0] == ClientRequest && w.Len() > 0 && w.Bytes()[0] == ServerFound {
+				if b := w.Bytes(); b[1] != '/' || b[len(b)-1] != '\n' {
+					t.Fatalf("Handle(%q) = %q, want a candidate list", req, b)
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkHandleFound(b *testing.B) {
+	d := loadTestDictionary(b)
+	req := []byte("1かんじ ")
+
+	for _, bb := range []struct {
+		name string
+		h    *Handler
+	}{
+		// written as rendered by the dictionary
+		{"rendered", &Handler{Dictionary: d}},
+		// the candidates are searched and written one by one
+		{"search", &Handler{Dictionary: d, LegacyAnnotations: true}},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			var w bytes.Buffer
+			w.Grow(4096)
+
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				w.Reset()
+				bb.h.Handle(context.Background(), &w, req)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !unix
+
+package mmap
+
+import (
+	"io"
+	"os"
+)
+
+// Map reads the whole file, as memory mapping is not supported.
+func Map(f *os.File, size int) ([]byte, error) {
+	b := make([]byte, size)
+	if _, err := io.ReadFull(f, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func Unmap(b []byte) error {
+	return nil
+}
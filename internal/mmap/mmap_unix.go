@@ -0,0 +1,26 @@
+//go:build unix
+
+// Package mmap maps read-only files into memory, falling back to reading
+// them on platforms without memory mapping.
+package mmap
+
+import (
+	"os"
+	"syscall"
+)
+
+func Map(f *os.File, size int) ([]byte, error) {
+	if size == 0 {
+		return nil, nil
+	}
+
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+func Unmap(b []byte) error {
+	if b == nil {
+		return nil
+	}
+
+	return syscall.Munmap(b)
+}
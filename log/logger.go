@@ -99,6 +99,20 @@ func (l *logger) logf(level Level, logger *log.Logger, format string, v ...inter
 	logger.Printf(format, v...)
 }
 
+// Enabled reports whether l logs the messages of level, so the arguments of
+// the messages not logged need not be made. The Loggers other than those of
+// New and NewNop are assumed to log all the messages.
+func Enabled(l Logger, level Level) bool {
+	switch l := l.(type) {
+	case *logger:
+		return level >= l.level
+	case nopLogger:
+		return false
+	}
+
+	return true
+}
+
 type nopLogger struct{}
 
 var _ Logger = nopLogger{}
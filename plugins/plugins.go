@@ -0,0 +1,103 @@
+// Package plugins loads the Go plugins that extend the server, built with
+// "go build -buildmode=plugin" against the same version of goskkserv.
+//
+// A plugin exports any of the symbols:
+//
+//	Provider  a dict.Provider, or a func() dict.Provider
+//	Filter    a dict.Filter, or a func() dict.Filter
+//	Searcher  a dict.Searcher, or a func() dict.Searcher, as a backend
+//
+// such as:
+//
+//	var Provider dict.Provider = &calculator{}
+//
+// Go plugins are supported only on Linux, FreeBSD and macOS with cgo. See
+// the script package for the portable ways.
+package plugins
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"plugin"
+	"sort"
+
+	"github.com/kechako/goskkserv/dict"
+)
+
+// Plugins are the extensions the plugins export, in the order of the file
+// names of the plugins.
+type Plugins struct {
+	Providers []dict.Provider
+	Filters   []dict.Filter
+	Searchers []dict.Searcher
+}
+
+// Load loads the plugins in dir, the files with ".so". A plugin that fails
+// to load does not stop the others from being loaded; the errors of all
+// such plugins are joined and returned along with the Plugins.
+func Load(dir string) (*Plugins, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.so"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list plugins: %w", err)
+	}
+	sort.Strings(names)
+
+	p := &Plugins{}
+	var errs []error
+	for _, name := range names {
+		if err := p.load(name); err != nil {
+			errs = append(errs, fmt.Errorf("failed to load plugin %s: %w", name, err))
+		}
+	}
+
+	return p, errors.Join(errs...)
+}
+
+func (p *Plugins) load(name string) error {
+	plug, err := plugin.Open(name)
+	if err != nil {
+		return err
+	}
+
+	var provider dict.Provider
+	var filter dict.Filter
+	var searcher dict.Searcher
+	for _, symbol := range []string{"Provider", "Filter", "Searcher"} {
+		sym, err := plug.Lookup(symbol)
+		if err != nil {
+			continue
+		}
+		switch v := sym.(type) {
+		case *dict.Provider:
+			provider = *v
+		case func() dict.Provider:
+			provider = v()
+		case *dict.Filter:
+			filter = *v
+		case func() dict.Filter:
+			filter = v()
+		case *dict.Searcher:
+			searcher = *v
+		case func() dict.Searcher:
+			searcher = v()
+		default:
+			return fmt.Errorf("invalid type of %s: %T", symbol, sym)
+		}
+	}
+	if provider == nil && filter == nil && searcher == nil {
+		return errors.New("no Provider, Filter or Searcher")
+	}
+
+	if provider != nil {
+		p.Providers = append(p.Providers, provider)
+	}
+	if filter != nil {
+		p.Filters = append(p.Filters, filter)
+	}
+	if searcher != nil {
+		p.Searchers = append(p.Searchers, searcher)
+	}
+
+	return nil
+}
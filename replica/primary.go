@@ -0,0 +1,209 @@
+// Package replica replicates a dictionary from a primary server to
+// replicas.
+//
+// A replica connects to the primary and receives a snapshot of the
+// dictionary as a UTF-8 SKK-JISYO file terminated by the SnapshotEnd line,
+// followed by the entries added on the primary afterwards, one SKK-JISYO
+// line per entry.
+package replica
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kechako/goskkserv/dict"
+	"github.com/kechako/goskkserv/log"
+)
+
+const SnapshotEnd = ";; end of snapshot"
+
+const updateQueueSize = 1024
+
+// Primary publishes its Dictionary to replicas.
+type Primary struct {
+	Dictionary *dict.Dictionary
+	Logger     log.Logger
+
+	mu       sync.Mutex
+	replicas map[chan string]struct{}
+}
+
+// Add adds a candidate of key to the dictionary and sends it to the
+// replicas. A key that is empty or has spaces cannot be sent, and is
+// ignored.
+func (p *Primary) Add(key, text, annotation string) {
+	if key == "" || strings.ContainsAny(key, " \t\r\n") {
+		return
+	}
+	if !p.Dictionary.AddEntry(key, text, annotation) {
+		return
+	}
+
+	line := formatEntry(key, text, annotation)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for ch := range p.replicas {
+		select {
+		case ch <- line:
+		default:
+			// the replica is too slow, let it reconnect and take a new
+			// snapshot
+			close(ch)
+			delete(p.replicas, ch)
+		}
+	}
+}
+
+// Serve accepts replica connections on l until ctx is done.
+func (p *Primary) Serve(ctx context.Context, l net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return nil
+			default:
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(5 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.serve(ctx, conn)
+		}()
+	}
+}
+
+func (p *Primary) serve(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	p.logger().Infof("new replica : %s", conn.RemoteAddr())
+
+	// subscribe before taking the snapshot, so that no update is lost.
+	// updates already in the snapshot are just added again, which does
+	// nothing.
+	ch := p.subscribe()
+	defer p.unsubscribe(ch)
+
+	var snapshot bytes.Buffer
+	if _, err := p.Dictionary.WriteTo(&snapshot); err != nil {
+		p.logger().Error("failed to take snapshot: ", err)
+		return
+	}
+	snapshot.WriteString(SnapshotEnd + "\n")
+
+	w := bufio.NewWriter(conn)
+	if _, err := w.Write(snapshot.Bytes()); err != nil {
+		p.logger().Errorf("failed to send snapshot to %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+	if err := w.Flush(); err != nil {
+		p.logger().Errorf("failed to send snapshot to %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+
+	// detect replicas going away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var buf [1]byte
+		for {
+			if _, err := conn.Read(buf[:]); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case line, ok := <-ch:
+			if !ok {
+				p.logger().Warnf("replica %s is too slow, disconnecting", conn.RemoteAddr())
+				return
+			}
+			if _, err := w.WriteString(line); err != nil {
+				p.logger().Errorf("failed to send update to %s: %v", conn.RemoteAddr(), err)
+				return
+			}
+			if len(ch) > 0 {
+				continue
+			}
+			if err := w.Flush(); err != nil {
+				p.logger().Errorf("failed to send update to %s: %v", conn.RemoteAddr(), err)
+				return
+			}
+		case <-closed:
+			p.logger().Infof("replica end : %s", conn.RemoteAddr())
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *Primary) subscribe() chan string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.replicas == nil {
+		p.replicas = make(map[chan string]struct{})
+	}
+
+	ch := make(chan string, updateQueueSize)
+	p.replicas[ch] = struct{}{}
+
+	return ch
+}
+
+func (p *Primary) unsubscribe(ch chan string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.replicas[ch]; ok {
+		close(ch)
+		delete(p.replicas, ch)
+	}
+}
+
+// formatEntry returns the SKK-JISYO line of a candidate, which is quoted if
+// it has '/', ';' or a newline, as in the snapshot.
+func formatEntry(key, text, annotation string) string {
+	if annotation == "" {
+		return fmt.Sprintf("%s /%s/\n", key, dict.EscapeText(text))
+	}
+
+	return fmt.Sprintf("%s /%s;%s/\n", key, dict.EscapeText(text), dict.EscapeAnnotation(annotation))
+}
+
+var nopLogger = log.NewNop()
+
+func (p *Primary) logger() log.Logger {
+	if p.Logger != nil {
+		return p.Logger
+	}
+
+	return nopLogger
+}
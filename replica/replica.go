@@ -0,0 +1,201 @@
+package replica
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/kechako/goskkserv/dict"
+	"github.com/kechako/goskkserv/dict/jisyo"
+	"github.com/kechako/goskkserv/log"
+)
+
+const defaultRetryDelay = 5 * time.Second
+
+// Replica keeps Dictionary in sync with the dictionary of a primary.
+type Replica struct {
+	Addr       string
+	Dictionary *dict.Dictionary
+	Logger     log.Logger
+
+	// RetryDelay is the time to wait before connecting again after the
+	// connection to the primary is lost.
+	RetryDelay time.Duration
+}
+
+// Run replicates the dictionary until ctx is done, reconnecting to the
+// primary when the connection is lost.
+func (r *Replica) Run(ctx context.Context) error {
+	for {
+		err := r.replicate(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+		r.logger().Warnf("replication from %s stopped: %v", r.Addr, err)
+
+		timer := time.NewTimer(r.retryDelay())
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		}
+	}
+}
+
+func (r *Replica) replicate(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", r.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to primary %s: %w", r.Addr, err)
+	}
+	defer conn.Close()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-stop:
+		}
+	}()
+
+	br := bufio.NewReader(conn)
+
+	snapshot, err := readSnapshot(br)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	r.Dictionary.Replace(snapshot)
+	r.logger().Infof("snapshot replicated from %s", r.Addr)
+
+	for {
+		line, err := readLine(br)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return errors.New("primary closed connection")
+			}
+			return fmt.Errorf("failed to read update: %w", err)
+		}
+		addLine(r.Dictionary, line)
+	}
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(line, "\n"), nil
+}
+
+// readSnapshot reads the snapshot up to the SnapshotEnd line into a new
+// Dictionary at once, keeping the okuri blocks.
+func readSnapshot(br *bufio.Reader) (*dict.Dictionary, error) {
+	d := &dict.Dictionary{}
+	tx := d.Begin()
+	defer tx.Rollback()
+
+	dec := jisyo.NewDecoder(&snapshotReader{r: br}, jisyo.WithEncoding("utf-8"))
+	for {
+		e, err := dec.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			var serr *jisyo.SyntaxError
+			if errors.As(err, &serr) {
+				continue
+			}
+			return nil, err
+		}
+		tx.AddJisyoEntry(unescapeEntry(e))
+	}
+	tx.Commit()
+
+	return d, nil
+}
+
+// snapshotReader reads the lines of r up to the SnapshotEnd line, and
+// reports io.ErrUnexpectedEOF if r ends before it.
+type snapshotReader struct {
+	r    *bufio.Reader
+	line string
+	done bool
+}
+
+func (sr *snapshotReader) Read(p []byte) (int, error) {
+	if sr.line == "" {
+		if sr.done {
+			return 0, io.EOF
+		}
+		line, err := sr.r.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		if line == SnapshotEnd+"\n" {
+			sr.done = true
+			return 0, io.EOF
+		}
+		sr.line = line
+	}
+
+	n := copy(p, sr.line)
+	sr.line = sr.line[n:]
+
+	return n, nil
+}
+
+// addLine adds the candidates of an update line to d.
+func addLine(d *dict.Dictionary, line string) {
+	e, err := jisyo.ParseLine(line)
+	if err != nil {
+		return
+	}
+	e = unescapeEntry(e)
+	for _, c := range e.Candidates {
+		d.AddEntry(e.Key, c.Text, c.Annotation)
+	}
+}
+
+// unescapeEntry unescapes the candidates of e escaped by the primary.
+func unescapeEntry(e jisyo.Entry) jisyo.Entry {
+	for i, c := range e.Candidates {
+		e.Candidates[i] = jisyo.Candidate{Text: dict.UnescapeText(c.Text), Annotation: dict.UnescapeText(c.Annotation)}
+	}
+	for _, ob := range e.Blocks {
+		for i, c := range ob.Candidates {
+			ob.Candidates[i] = jisyo.Candidate{Text: dict.UnescapeText(c.Text), Annotation: dict.UnescapeText(c.Annotation)}
+		}
+	}
+
+	return e
+}
+
+func (r *Replica) retryDelay() time.Duration {
+	if r.RetryDelay > 0 {
+		return r.RetryDelay
+	}
+
+	return defaultRetryDelay
+}
+
+func (r *Replica) logger() log.Logger {
+	if r.Logger != nil {
+		return r.Logger
+	}
+
+	return nopLogger
+}
@@ -0,0 +1,135 @@
+package replica
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kechako/goskkserv/dict"
+	"golang.org/x/text/encoding/japanese"
+)
+
+func TestAddLineMessy(t *testing.T) {
+	want := map[string]string{
+		"かんじ": "漢字/感じ;feeling",
+		"skk": "SKK",
+		"ぎょう": "行/業",
+	}
+
+	for _, name := range []string{"blank", "crlf", "tabs", "first", "nonewline"} {
+		data, err := os.ReadFile(filepath.Join("..", "dict", "testdata", "messy", name+".jisyo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err = japanese.EUCJP.NewDecoder().Bytes(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		d := &dict.Dictionary{}
+		for _, line := range strings.SplitAfter(string(data), "\n") {
+			addLine(d, strings.TrimSuffix(line, "\n"))
+		}
+
+		for key, want := range want {
+			candidates, err := d.Search(context.Background(), key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s := make([]string, len(candidates))
+			for i, c := range candidates {
+				s[i] = c.String()
+			}
+			if got := strings.Join(s, "/"); got != want {
+				t.Errorf("%s: Search(%q) = %q, want %q", name, key, got, want)
+			}
+		}
+	}
+}
+
+func TestFormatEntry(t *testing.T) {
+	tests := []struct {
+		key, text, annotation string
+		want                  string
+	}{
+		{"かんじ", "漢字", "", "かんじ /漢字/\n"},
+		{"かんじ", "感じ", "feeling", "かんじ /感じ;feeling/\n"},
+		{"a/b", "a/b", "", "a/b /(concat \"a\\057b\")/\n"},
+		{"せみ", "semi;colon", "a;b", "せみ /(concat \"semi\\073colon\");a;b/\n"},
+		{"ぎょう", "行\n" + SnapshotEnd, "x/y", "ぎょう /(concat \"行\\n\\073\\073 end of snapshot\");(concat \"x\\057y\")/\n"},
+	}
+	for _, tt := range tests {
+		got := formatEntry(tt.key, tt.text, tt.annotation)
+		if got != tt.want {
+			t.Errorf("formatEntry(%q, %q, %q) = %q, want %q", tt.key, tt.text, tt.annotation, got, tt.want)
+		}
+
+		d := &dict.Dictionary{}
+		addLine(d, strings.TrimSuffix(got, "\n"))
+		candidates, _ := d.Search(context.Background(), tt.key)
+		if len(candidates) != 1 {
+			t.Errorf("addLine(%q) added %d candidates, want 1", got, len(candidates))
+		}
+	}
+}
+
+func TestReadSnapshot(t *testing.T) {
+	primary, err := dict.Load(strings.NewReader(";; okuri-ari entries.\nおくr /送/贈/[る/送/]/[れ/贈/]/\n;; okuri-nasi entries.\nかんじ /漢字/\n"), dict.Encoding("utf-8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary.AddEntry("a/b", "a/b", "x;y")
+
+	var stream bytes.Buffer
+	if _, err := primary.WriteTo(&stream); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := stream.String()
+	stream.WriteString(SnapshotEnd + "\n")
+	stream.WriteString(formatEntry("かんじ", "感じ", ""))
+
+	br := bufio.NewReader(&stream)
+	d, err := readSnapshot(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]string{
+		"おくrれ": "/贈/送/",
+		"かんじ":  "/漢字/",
+		"a/b":  "/(concat \"a\\057b\");x;y/",
+	} {
+		var buf bytes.Buffer
+		if _, err := d.WriteCandidates(&buf, key); err != nil {
+			t.Fatal(err)
+		}
+		if got := buf.String(); got != want {
+			t.Errorf("WriteCandidates(%q) = %q, want %q", key, got, want)
+		}
+	}
+	candidates, _ := d.Search(context.Background(), "a/b")
+	if len(candidates) != 1 || candidates[0].Text() != "a/b" || candidates[0].Annotation() != "x;y" {
+		t.Errorf("Search(%q) = %v", "a/b", candidates)
+	}
+
+	// the updates follow the snapshot
+	line, err := readLine(br)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addLine(d, line)
+	candidates, _ = d.Search(context.Background(), "かんじ")
+	if len(candidates) != 2 {
+		t.Errorf("Search() after an update = %v", candidates)
+	}
+
+	if _, err := readSnapshot(bufio.NewReader(strings.NewReader(snapshot))); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("readSnapshot() of a snapshot without the end error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
@@ -0,0 +1,120 @@
+package script
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/kechako/goskkserv/dict"
+)
+
+const (
+	defaultCommandTimeout = 3 * time.Second
+	defaultMaxOutput      = 64 * 1024
+)
+
+// Command is a dict.Provider running an external program for each key, so
+// the server can be extended in any language. The key followed by a
+// newline is written to the standard input of the program, which must
+// write one candidate per line to the standard output in the form
+// "text<TAB>annotation" (the annotation is optional), and exit with 0. All
+// data is UTF-8.
+type Command struct {
+	// Name and Args are the program and its arguments.
+	Name string
+	Args []string
+
+	// Timeout limits the time of a run; the program is killed after it.
+	// Zero means 3s.
+	Timeout time.Duration
+
+	// Dir is the working directory of the program. Empty means the
+	// current directory.
+	Dir string
+
+	// Env is the environment of the program, which does not inherit the
+	// environment of the server, so it does not see the secrets in it.
+	Env []string
+
+	// MaxOutput limits the size of the output; the program writing more
+	// fails. Zero means 64KiB.
+	MaxOutput int
+}
+
+var _ dict.Provider = (*Command)(nil)
+
+func (c *Command) Candidates(ctx context.Context, key string) ([]dict.Candidate, error) {
+	if strings.ContainsAny(key, "\r\n") {
+		return nil, errors.New("invalid key")
+	}
+
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, c.Name, c.Args...)
+	cmd.Dir = c.Dir
+	cmd.Env = c.Env
+	if cmd.Env == nil {
+		cmd.Env = []string{}
+	}
+	cmd.Stdin = strings.NewReader(key + "\n")
+	stdout := &limitedBuffer{max: c.maxOutput()}
+	cmd.Stdout = stdout
+	// do not wait for the children holding the output after a kill
+	cmd.WaitDelay = timeout
+
+	if err := cmd.Run(); err != nil {
+		if stdout.overflow {
+			return nil, fmt.Errorf("failed to run %s: too much output", c.Name)
+		}
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("failed to run %s: %w", c.Name, ctx.Err())
+		}
+		return nil, fmt.Errorf("failed to run %s: %w", c.Name, err)
+	}
+
+	var candidates []dict.Candidate
+	s := bufio.NewScanner(&stdout.buf)
+	for s.Scan() {
+		text, annotation, _ := strings.Cut(strings.TrimRight(s.Text(), "\r"), "\t")
+		if text == "" {
+			continue
+		}
+		candidates = append(candidates, dict.NewSourceCandidate(text, annotation, c.Name))
+	}
+
+	return candidates, nil
+}
+
+func (c *Command) maxOutput() int {
+	if c.MaxOutput > 0 {
+		return c.MaxOutput
+	}
+
+	return defaultMaxOutput
+}
+
+// limitedBuffer is a buffer that fails the writes beyond max bytes.
+type limitedBuffer struct {
+	buf      bytes.Buffer
+	max      int
+	overflow bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.buf.Len()+len(p) > b.max {
+		b.overflow = true
+		return 0, errors.New("too much output")
+	}
+
+	return b.buf.Write(p)
+}
@@ -0,0 +1,239 @@
+// Package script runs Lua scripts and external programs that generate and
+// post-process the candidates, so users can extend the server without
+// recompiling it.
+//
+// A Lua script may define the global functions:
+//
+//	candidates(key)        returns the candidates of key
+//	filter(key, candidates) returns the candidates post-processed
+//
+// A candidate is a string of the text, or a table {text = ..., annotation
+// = ...}. The candidates given to filter are tables with source as well.
+// Either function may return nil for no change.
+package script
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kechako/goskkserv/dict"
+	"github.com/kechako/goskkserv/log"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Scripts are the Lua scripts in a directory, which are both a
+// dict.Provider and a dict.Filter. The scripts are run in the order of
+// their file names.
+type Scripts struct {
+	// Dir is the directory of the scripts, the files with ".lua".
+	Dir string
+
+	// Delay is the time Run waits for more changes after a change before
+	// reloading. Zero means 500ms.
+	Delay time.Duration
+
+	Logger log.Logger
+
+	mu      sync.Mutex
+	scripts []*script
+}
+
+var (
+	_ dict.Provider = (*Scripts)(nil)
+	_ dict.Filter   = (*Scripts)(nil)
+)
+
+// script is a script loaded in its own Lua state, which is not safe for
+// concurrent use.
+type script struct {
+	name  string
+	state *lua.LState
+}
+
+// Open loads the scripts in dir. A script that fails to load does not
+// stop the others from being loaded; the errors of all such scripts are
+// joined and returned along with the Scripts.
+func Open(dir string) (*Scripts, error) {
+	s := &Scripts{Dir: dir}
+	err := s.Reload()
+
+	return s, err
+}
+
+// Reload loads the scripts in Dir again, replacing those loaded before.
+func (s *Scripts) Reload() error {
+	names, err := filepath.Glob(filepath.Join(s.Dir, "*.lua"))
+	if err != nil {
+		return fmt.Errorf("failed to list scripts: %w", err)
+	}
+	sort.Strings(names)
+
+	var scripts []*script
+	var errs []error
+	for _, name := range names {
+		sc, err := load(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		scripts = append(scripts, sc)
+	}
+
+	s.mu.Lock()
+	old := s.scripts
+	s.scripts = scripts
+	s.mu.Unlock()
+
+	for _, sc := range old {
+		sc.state.Close()
+	}
+
+	return errors.Join(errs...)
+}
+
+// Close closes the Lua states of the scripts.
+func (s *Scripts) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sc := range s.scripts {
+		sc.state.Close()
+	}
+	s.scripts = nil
+
+	return nil
+}
+
+func load(name string) (*script, error) {
+	state := lua.NewState()
+	if err := state.DoFile(name); err != nil {
+		state.Close()
+		return nil, fmt.Errorf("failed to load script %s: %w", name, err)
+	}
+
+	return &script{name: name, state: state}, nil
+}
+
+// Candidates returns the candidates of key generated by the candidates
+// functions of the scripts, in order.
+func (s *Scripts) Candidates(ctx context.Context, key string) ([]dict.Candidate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var candidates []dict.Candidate
+	var errs []error
+	for _, sc := range s.scripts {
+		v, err := sc.call(ctx, "candidates", lua.LString(key))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		candidates = append(candidates, toCandidates(v, sc.name)...)
+	}
+
+	return candidates, errors.Join(errs...)
+}
+
+// Filter passes the candidates of key through the filter functions of the
+// scripts, in order.
+func (s *Scripts) Filter(ctx context.Context, key string, candidates []dict.Candidate) ([]dict.Candidate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for _, sc := range s.scripts {
+		if sc.state.GetGlobal("filter") == lua.LNil {
+			continue
+		}
+		v, err := sc.call(ctx, "filter", lua.LString(key), fromCandidates(sc.state, candidates))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if v != lua.LNil {
+			candidates = toCandidates(v, sc.name)
+		}
+	}
+
+	return candidates, errors.Join(errs...)
+}
+
+// call calls the global function fn of sc with args, returning its result,
+// or nil if there is no such function.
+func (sc *script) call(ctx context.Context, fn string, args ...lua.LValue) (lua.LValue, error) {
+	f := sc.state.GetGlobal(fn)
+	if f.Type() != lua.LTFunction {
+		return lua.LNil, nil
+	}
+
+	sc.state.SetContext(ctx)
+	defer sc.state.RemoveContext()
+
+	if err := sc.state.CallByParam(lua.P{Fn: f, NRet: 1, Protect: true}, args...); err != nil {
+		return lua.LNil, fmt.Errorf("failed to call %s of %s: %w", fn, sc.name, err)
+	}
+	v := sc.state.Get(-1)
+	sc.state.Pop(1)
+
+	return v, nil
+}
+
+// toCandidates converts the candidates returned by a script.
+func toCandidates(v lua.LValue, source string) []dict.Candidate {
+	t, ok := v.(*lua.LTable)
+	if !ok {
+		return nil
+	}
+
+	var candidates []dict.Candidate
+	for i := 1; i <= t.Len(); i++ {
+		switch c := t.RawGetInt(i).(type) {
+		case lua.LString:
+			if c != "" {
+				candidates = append(candidates, dict.NewSourceCandidate(string(c), "", source))
+			}
+		case *lua.LTable:
+			text := lua.LVAsString(c.RawGetString("text"))
+			if text == "" {
+				continue
+			}
+			src := lua.LVAsString(c.RawGetString("source"))
+			if src == "" {
+				src = source
+			}
+			annotation := lua.LVAsString(c.RawGetString("annotation"))
+			candidates = append(candidates, dict.NewSourceCandidate(text, annotation, src))
+		}
+	}
+
+	return candidates
+}
+
+// fromCandidates converts candidates to be given to a script.
+func fromCandidates(state *lua.LState, candidates []dict.Candidate) *lua.LTable {
+	t := state.CreateTable(len(candidates), 0)
+	for _, c := range candidates {
+		ct := state.CreateTable(0, 3)
+		ct.RawSetString("text", lua.LString(c.Text()))
+		ct.RawSetString("annotation", lua.LString(c.Annotation()))
+		ct.RawSetString("source", lua.LString(c.Source()))
+		t.Append(ct)
+	}
+
+	return t
+}
+
+func (s *Scripts) logger() log.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+
+	return nopLogger
+}
+
+var nopLogger = log.NewNop()
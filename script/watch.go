@@ -0,0 +1,64 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const defaultWatchDelay = 500 * time.Millisecond
+
+// Run reloads the scripts when the scripts in Dir change, until ctx is
+// done, so edits of the scripts take effect while the server runs.
+func (s *Scripts) Run(ctx context.Context) error {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch scripts: %w", err)
+	}
+	defer fw.Close()
+
+	if err := fw.Add(s.Dir); err != nil {
+		return fmt.Errorf("failed to watch scripts: %w", err)
+	}
+
+	timer := time.NewTimer(0)
+	if !timer.Stop() {
+		<-timer.C
+	}
+	for {
+		select {
+		case ev, ok := <-fw.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Has(fsnotify.Chmod) || filepath.Ext(ev.Name) != ".lua" {
+				continue
+			}
+			timer.Reset(s.delay())
+		case err, ok := <-fw.Errors:
+			if !ok {
+				return nil
+			}
+			s.logger().Warnf("failed to watch scripts: %v", err)
+		case <-timer.C:
+			if err := s.Reload(); err != nil {
+				s.logger().Warn(err)
+				continue
+			}
+			s.logger().Infof("scripts in %s are reloaded", s.Dir)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (s *Scripts) delay() time.Duration {
+	if s.Delay > 0 {
+		return s.Delay
+	}
+
+	return defaultWatchDelay
+}
@@ -1,54 +1,184 @@
 package skkserv
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"net/netip"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/kechako/goskkserv/dict"
 	"github.com/kechako/goskkserv/log"
+	"github.com/kechako/goskkserv/session"
+	"github.com/kechako/goskkserv/translit"
 )
 
 type Server struct {
-	Dictionary *dict.Dictionary
+	Dictionary dict.Searcher
 	Encoding   Encoding
 	Logger     log.Logger
 
-	listener   net.Listener
-	activeConn map[*net.Conn]struct{}
+	// Transliterator, if not nil, is queried after Dictionary, and its
+	// candidates are appended to those of Dictionary.
+	Transliterator translit.Transliterator
+
+	// Providers, if any, are queried in order after Dictionary, and their
+	// candidates are appended to those of Dictionary, before those of
+	// Transliterator.
+	Providers []dict.Provider
+
+	// Filters, if any, post-process the candidates in order before they
+	// are sent, after those of all the above are put together.
+	Filters []dict.Filter
+
+	// EvalCandidates makes the candidates of Lisp forms, such as
+	// `(concat "a\057b")`, evaluated before they are sent, for the clients
+	// that do not evaluate them. The forms other than concat of strings
+	// are sent as they are.
+	EvalCandidates bool
+
+	// Replacer, if not nil, replaces the characters of the candidates
+	// before they are sent, such as strings.NewReplacer("/", "／"), for the
+	// clients that do not evaluate Lisp forms. Otherwise the candidates
+	// with '/' or ';' are sent as `(concat "a\057b")`.
+	Replacer *strings.Replacer
+
+	// LegacyAnnotations makes the annotations sent after "; " as the
+	// earlier versions did, instead of after ";" as SKK does, for the
+	// clients that depend on it.
+	LegacyAnnotations bool
+
+	// MaxCandidates, if positive, limits the number of the candidates of a
+	// response. The candidates after the first MaxCandidates ones, which
+	// are the less likely ones, are dropped.
+	MaxCandidates int
+
+	// MaxCompletions, if positive, limits the number of the keys of a
+	// completion response. The dictionaries with SearchPrefix, such as
+	// dict.Dictionary, stop searching the keys at the limit.
+	MaxCompletions int
+
+	// UserDictionary, if not nil, is the dictionary the candidates are
+	// learned and registered to. Rank the candidates by its Frequency with
+	// dict.NewRanked to make use of it. The changes not saved yet by its
+	// AutoSave are saved by Shutdown.
+	UserDictionary *dict.UserDictionary
+
+	// AllowLearn enables ClientLearn, by which the clients tell the
+	// candidates the users select, and AllowRegister ClientRegister, which
+	// registers the candidates to UserDictionary, for the clients from
+	// RegisterFrom. Empty RegisterFrom means the loopback addresses only.
+	// Only the candidates Dictionary has are learned.
+	AllowLearn    bool
+	AllowRegister bool
+	RegisterFrom  []netip.Prefix
+
+	// SearchTimeout limits the time spent on searching candidates of a
+	// request. If the limit is exceeded, the client gets not found.
+	SearchTimeout time.Duration
+
+	// Recorder, if not nil, records all the client sessions.
+	Recorder *session.Recorder
+
+	// ShutdownGrace is the time Shutdown waits for active connections to
+	// end before closing them.
+	ShutdownGrace time.Duration
+
+	// MaxWorkers enables the worker pool mode when positive. At most
+	// MaxWorkers connections are served concurrently, and up to QueueSize
+	// further connections wait for a free worker. Connections beyond that
+	// are answered with ServerFull and closed.
+	MaxWorkers int
+	QueueSize  int
+
+	mu         sync.Mutex
+	listeners  map[net.Listener]struct{}
+	activeConn map[net.Conn]struct{}
 	wg         sync.WaitGroup
+	ctx        context.Context
 	exit       func()
+	queue      chan job
 }
 
+// job is a connection waiting for a worker.
+type job struct {
+	conn       net.Conn
+	dictionary dict.Searcher
+}
+
+// ErrForcedShutdown is returned by Shutdown when active connections had to
+// be closed forcibly.
+var ErrForcedShutdown = errors.New("skkserv: connections closed forcibly")
+
+const shutdownPollInterval = 50 * time.Millisecond
+
+// Shutdown stops accepting new connections on all the listeners, waits up
+// to ShutdownGrace for the active connections to end, and then closes the
+// remaining ones.
 func (s *Server) Shutdown() error {
-	if s.listener == nil {
+	s.mu.Lock()
+	if s.exit == nil {
+		s.mu.Unlock()
 		return nil
 	}
-	if s.exit != nil {
-		s.exit()
+	s.exit()
+	s.ctx, s.exit, s.queue = nil, nil, nil
+
+	var lerrs []error
+	for l := range s.listeners {
+		if err := l.Close(); err != nil {
+			lerrs = append(lerrs, err)
+		}
+		delete(s.listeners, l)
 	}
+	s.mu.Unlock()
 
-	lerr := s.listener.Close()
+	lerr := errors.Join(lerrs...)
 
-	for conn := range s.activeConn {
-		(*conn).Close()
-		s.setActiveConn(conn, false)
+	if s.ShutdownGrace > 0 && s.numActiveConn() > 0 {
+		s.logger().Infof("waiting for active connections up to %v...", s.ShutdownGrace)
+
+		timer := time.NewTimer(s.ShutdownGrace)
+		defer timer.Stop()
+		ticker := time.NewTicker(shutdownPollInterval)
+		defer ticker.Stop()
+	wait:
+		for s.numActiveConn() > 0 {
+			select {
+			case <-ticker.C:
+			case <-timer.C:
+				break wait
+			}
+		}
+	}
+
+	n := s.closeActiveConns()
+	if s.UserDictionary != nil {
+		if err := s.UserDictionary.Flush(); err != nil {
+			s.logger().Error(err)
+		}
+	}
+	if n > 0 {
+		s.logger().Warnf("%d connections closed forcibly", n)
+		return errors.Join(lerr, ErrForcedShutdown)
 	}
 
 	return lerr
 }
 
 func (s *Server) Listen(addr string) error {
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	s.exit = cancel
+	return s.ListenDictionary(addr, nil)
+}
 
+// ListenDictionary listens on addr and serves d to the clients connecting
+// to it. If d is nil, Dictionary is served.
+func (s *Server) ListenDictionary(addr string, d dict.Searcher) error {
 	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
 	if err != nil {
 		return fmt.Errorf("failed to resolve address [%s]: %w", addr, err)
@@ -59,8 +189,21 @@ func (s *Server) Listen(addr string) error {
 	if err != nil {
 		return fmt.Errorf("failed to listen TCP [%v]: %w", tcpAddr, err)
 	}
+
+	return s.ServeDictionary(l, d)
+}
+
+func (s *Server) Serve(l net.Listener) error {
+	return s.ServeDictionary(l, nil)
+}
+
+// ServeDictionary serves d to the clients connecting to l. If d is nil,
+// Dictionary is served. A Server can serve several listeners with different
+// dictionaries at the same time.
+func (s *Server) ServeDictionary(l net.Listener, d dict.Searcher) error {
 	defer l.Close()
-	s.listener = l
+
+	ctx := s.start(l)
 
 	var tempDelay time.Duration
 loop:
@@ -82,13 +225,26 @@ loop:
 					tempDelay = max
 				}
 				time.Sleep(tempDelay)
+				continue
 			}
+			s.removeListener(l)
 			return err
 		}
 		tempDelay = 0
-		s.setActiveConn(&c, true)
+		s.setActiveConn(c, true)
+		if queue := s.workerQueue(); queue != nil {
+			select {
+			case queue <- job{conn: c, dictionary: d}:
+			default:
+				s.reject(c)
+			}
+			continue
+		}
 		s.wg.Add(1)
-		go s.serve(ctx, c)
+		go func() {
+			defer s.wg.Done()
+			s.serve(ctx, c, d)
+		}()
 	}
 
 	s.wg.Wait()
@@ -96,6 +252,69 @@ loop:
 	return nil
 }
 
+// start registers l, and starts the server if it is not running yet.
+func (s *Server) start(l net.Listener) context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	s.listeners[l] = struct{}{}
+
+	if s.ctx == nil {
+		s.ctx, s.exit = context.WithCancel(context.Background())
+		if s.MaxWorkers > 0 {
+			s.queue = make(chan job, s.QueueSize)
+			s.startWorkers(s.ctx, s.queue)
+		}
+	}
+
+	return s.ctx
+}
+
+func (s *Server) removeListener(l net.Listener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.listeners, l)
+}
+
+func (s *Server) workerQueue() chan job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.queue
+}
+
+func (s *Server) startWorkers(ctx context.Context, queue <-chan job) {
+	for i := 0; i < s.MaxWorkers; i++ {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			for {
+				select {
+				case j := <-queue:
+					s.serve(ctx, j.conn, j.dictionary)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+}
+
+func (s *Server) reject(conn net.Conn) {
+	defer s.setActiveConn(conn, false)
+	defer conn.Close()
+
+	s.logger().Warnf("server full, rejecting client : %s", conn.RemoteAddr())
+
+	if _, err := conn.Write([]byte{ServerFull, '\n'}); err != nil {
+		s.logger().Error("failed to write server full response: ", err)
+	}
+}
+
 const (
 	ClientEnd        = '0'
 	ClientRequest    = '1'
@@ -103,34 +322,69 @@ const (
 	ClientHost       = '3'
 	ClientCompletion = '4'
 
+	// ClientLearn is an extension telling the server that the user
+	// selected a candidate, in the form "5key /candidate/\n". It is
+	// answered with ServerFound if learned, or ServerError otherwise.
+	ClientLearn = '5'
+	// ClientRegister is an extension registering a candidate to the user
+	// dictionary, in the form "6key /candidate;annotation/\n". It is
+	// answered with ServerFound if registered, or ServerError otherwise.
+	ClientRegister = '6'
+
 	ServerError    = '0'
 	ServerFound    = '1'
 	ServerNotFound = '4'
 	ServerFull     = '9'
 )
 
-func (s *Server) serve(ctx context.Context, conn net.Conn) {
-	defer s.wg.Done()
-	defer s.setActiveConn(&conn, false)
+func (s *Server) serve(ctx context.Context, conn net.Conn, dictionary dict.Searcher) {
+	defer s.setActiveConn(conn, false)
+	if s.Recorder != nil {
+		conn = s.Recorder.Wrap(conn)
+	}
 	defer conn.Close()
 
 	s.logger().Infof("new client : %s", conn.RemoteAddr())
 
-	encoding := s.Encoding.encoding()
-	w := encoding.NewEncoder().Writer(conn)
-	r := encoding.NewDecoder().Reader(conn)
+	encoding := s.encoding().TextEncoding()
 
-	dictionary := s.dict()
+	bufs := getConnBuffers()
+	defer putConnBuffers(bufs)
+	bufs.r.Reset(encoding.NewDecoder().Reader(conn))
+	bufs.w.Reset(encoding.NewEncoder().Writer(conn))
+	r, w, ret := bufs.r, bufs.w, &bufs.ret
+
+	if dictionary == nil {
+		dictionary = s.dict()
+	}
+	h := Handler{
+		Dictionary:        dictionary,
+		Transliterator:    s.Transliterator,
+		Providers:         s.Providers,
+		Filters:           s.Filters,
+		EvalCandidates:    s.EvalCandidates,
+		Replacer:          s.Replacer,
+		LegacyAnnotations: s.LegacyAnnotations,
+		MaxCandidates:     s.MaxCandidates,
+		MaxCompletions:    s.MaxCompletions,
+		UserDictionary:    s.UserDictionary,
+		AllowLearn:        s.AllowLearn && s.trusted(conn.RemoteAddr()),
+		AllowRegister:     s.AllowRegister && s.trusted(conn.RemoteAddr()),
+		SearchTimeout:     s.SearchTimeout,
+		Logger:            s.logger(),
+		Host:              conn.LocalAddr().String(),
+	}
 
-	var buf [1024]byte
-	var ret bytes.Buffer
-	ret.Grow(4096)
 loop:
 	for {
 		ret.Reset()
 
-		n, err := r.Read(buf[:])
-		if err != nil {
+		req, err := ReadRequest(r, bufs.buf[:0])
+		if errors.Is(err, ErrRequestTooLarge) {
+			s.logger().Warnf("request too large : %s", conn.RemoteAddr())
+			ret.WriteByte(ServerError)
+			ret.WriteByte('\n')
+		} else if err != nil {
 			select {
 			case <-ctx.Done():
 				break loop
@@ -145,62 +399,90 @@ loop:
 			}
 			s.logger().Error("failed to read request data: ", err)
 			return
-		}
-		cmd := string(buf[:n])
-		switch cmd[0] {
-		case ClientEnd:
+		} else if end := h.Handle(ctx, ret, req); end {
 			s.logger().Infof("client end : %s", conn.RemoteAddr())
 			break loop
-		case ClientRequest:
-			i := strings.IndexByte(cmd, ' ')
-			if i < 0 {
-				i = strings.IndexByte(cmd, '\n')
-			}
-			if i < 0 {
-				i = len(cmd)
-			}
-
-			key := cmd[1:i]
-			s.logger().Debugf("REQUEST: key : %s", key)
-
-			candidates := dictionary.Search(key)
-			if len(candidates) > 0 {
-				ret.WriteRune(ServerFound)
-				for _, c := range candidates {
-					ret.WriteRune('/')
-					ret.WriteString(c.String())
-				}
-				ret.WriteString("/\n")
-				s.logger().Debugf("REQUEST: candidate: %s", strings.TrimSpace(ret.String()))
-			} else {
-				ret.WriteRune(ServerNotFound)
-				ret.WriteString(cmd[1:])
-				s.logger().Debug("REQUEST: not found")
-			}
-		case ClientVersion:
-			s.logger().Debug("VERSION")
-			ret.WriteString("goskkserv-1.0")
-		case ClientHost:
-			s.logger().Debug("HOST")
-			ret.WriteString(conn.LocalAddr().String())
-		case ClientCompletion:
-			s.logger().Debug("COMPLETION")
-			ret.WriteRune(ServerFound)
-			ret.WriteString("//\n")
-		default:
-			s.logger().Infof("UNKNOWN: message from client %s: %c/\"%s\"", conn.RemoteAddr(), cmd[0], cmd)
-			continue
 		}
 		if _, err := w.Write(ret.Bytes()); err != nil {
 			s.logger().Error(err)
 			return
 		}
+		// coalesce the responses of pipelined requests into one write, and
+		// flush them after the last one even if it has no response
+		if r.Buffered() > 0 {
+			continue
+		}
+		if err := w.Flush(); err != nil {
+			s.logger().Error(err)
+			return
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		s.logger().Error(err)
+	}
+}
+
+type connBuffers struct {
+	buf [maxRequestSize]byte
+	ret bytes.Buffer
+	r   *bufio.Reader
+	w   *bufio.Writer
+}
+
+var connBuffersPool = sync.Pool{
+	New: func() interface{} {
+		bufs := &connBuffers{
+			r: bufio.NewReader(nil),
+			w: bufio.NewWriter(nil),
+		}
+		bufs.ret.Grow(4096)
+		return bufs
+	},
+}
+
+func getConnBuffers() *connBuffers {
+	return connBuffersPool.Get().(*connBuffers)
+}
+
+func putConnBuffers(bufs *connBuffers) {
+	bufs.r.Reset(nil)
+	bufs.w.Reset(nil)
+
+	// do not keep buffers grown by huge responses
+	if bufs.ret.Cap() > 64*1024 {
+		return
+	}
+	bufs.ret.Reset()
+	connBuffersPool.Put(bufs)
+}
+
+func (s *Server) numActiveConn() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.activeConn)
+}
+
+func (s *Server) closeActiveConns() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.activeConn)
+	for conn := range s.activeConn {
+		conn.Close()
+		delete(s.activeConn, conn)
 	}
+
+	return n
 }
 
-func (s *Server) setActiveConn(conn *net.Conn, set bool) {
+func (s *Server) setActiveConn(conn net.Conn, set bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	if s.activeConn == nil {
-		s.activeConn = make(map[*net.Conn]struct{})
+		s.activeConn = make(map[net.Conn]struct{})
 	}
 
 	if set {
@@ -210,16 +492,93 @@ func (s *Server) setActiveConn(conn *net.Conn, set bool) {
 	}
 }
 
-func (s *Server) dict() *dict.Dictionary {
+// SetEncoding changes the encoding used for new connections. Connections
+// already established keep the encoding they started with.
+func (s *Server) SetEncoding(enc Encoding) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Encoding != enc {
+		s.logger().Infof("encoding changed : %s -> %s", s.Encoding, enc)
+	}
+	s.Encoding = enc
+}
+
+func (s *Server) encoding() Encoding {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.Encoding
+}
+
+// ErrNotAttachable is returned by AttachDictionary and DetachDictionary if
+// Dictionary is not a *dict.Dictionary.
+var ErrNotAttachable = errors.New("skkserv: dictionary cannot be attached or detached")
+
+// AttachDictionary adds the dictionary file of src to Dictionary at
+// runtime, as dict.Dictionary.Attach. The clients keep being served while
+// it is loaded.
+func (s *Server) AttachDictionary(src dict.Source) error {
+	d, ok := s.Dictionary.(*dict.Dictionary)
+	if !ok {
+		return ErrNotAttachable
+	}
+	if err := d.Attach(src); err != nil {
+		return err
+	}
+	s.logger().Infof("dictionary attached : %s", src.Name)
+
+	return nil
+}
+
+// DetachDictionary removes the named dictionary file from Dictionary at
+// runtime, as dict.Dictionary.Detach.
+func (s *Server) DetachDictionary(name string) error {
+	d, ok := s.Dictionary.(*dict.Dictionary)
+	if !ok {
+		return ErrNotAttachable
+	}
+	if err := d.Detach(name); err != nil {
+		return err
+	}
+	s.logger().Infof("dictionary detached : %s", name)
+
+	return nil
+}
+
+func (s *Server) dict() dict.Searcher {
 	if s.Dictionary != nil {
 		return s.Dictionary
 	}
 
-	return &dict.Dictionary{}
+	return emptyDict
 }
 
+var emptyDict = &dict.Dictionary{}
+
 var nopLogger = log.NewNop()
 
+// trusted reports whether the client of addr can learn and register
+// candidates.
+func (s *Server) trusted(addr net.Addr) bool {
+	ap, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		// such as a pipe
+		return false
+	}
+	ip := ap.Addr().Unmap()
+	if len(s.RegisterFrom) == 0 {
+		return ip.IsLoopback()
+	}
+	for _, p := range s.RegisterFrom {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (s *Server) logger() log.Logger {
 	if s.Logger != nil {
 		return s.Logger
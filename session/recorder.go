@@ -0,0 +1,122 @@
+// Package session records raw client sessions of a server, and replays
+// recorded sessions against a server.
+//
+// A recording is a sequence of JSON records, one per line.
+package session
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+type Event string
+
+const (
+	Open  Event = "open"
+	Recv  Event = "recv"
+	Send  Event = "send"
+	Close Event = "close"
+)
+
+type Record struct {
+	Time    time.Time `json:"time"`
+	Session uint64    `json:"session"`
+	Event   Event     `json:"event"`
+	Remote  string    `json:"remote,omitempty"`
+	Data    []byte    `json:"data,omitempty"`
+}
+
+// Recorder records the data received from and sent to the clients.
+type Recorder struct {
+	mu   sync.Mutex
+	enc  *json.Encoder
+	next uint64
+	err  error
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{
+		enc: json.NewEncoder(w),
+	}
+}
+
+// Wrap returns a net.Conn recording the session on conn.
+func (r *Recorder) Wrap(conn net.Conn) net.Conn {
+	r.mu.Lock()
+	r.next++
+	id := r.next
+	r.mu.Unlock()
+
+	c := &recordConn{Conn: conn, r: r, id: id}
+	r.record(Record{
+		Session: id,
+		Event:   Open,
+		Remote:  conn.RemoteAddr().String(),
+	})
+
+	return c
+}
+
+// Err returns the first error occurred while writing records.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err
+}
+
+func (r *Recorder) record(rec Record) {
+	rec.Time = time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return
+	}
+	r.err = r.enc.Encode(&rec)
+}
+
+type recordConn struct {
+	net.Conn
+	r    *Recorder
+	id   uint64
+	once sync.Once
+}
+
+func (c *recordConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.r.record(Record{
+			Session: c.id,
+			Event:   Recv,
+			Data:    append([]byte(nil), b[:n]...),
+		})
+	}
+	return n, err
+}
+
+func (c *recordConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.r.record(Record{
+			Session: c.id,
+			Event:   Send,
+			Data:    append([]byte(nil), b[:n]...),
+		})
+	}
+	return n, err
+}
+
+func (c *recordConn) Close() error {
+	c.once.Do(func() {
+		c.r.record(Record{
+			Session: c.id,
+			Event:   Close,
+		})
+	})
+	return c.Conn.Close()
+}
@@ -0,0 +1,121 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+type ReplayOptions struct {
+	// Speed scales the intervals between the recorded events. 2 replays
+	// twice as fast as recorded. 0 sends all the data without waiting.
+	Speed float64
+}
+
+// Replay re-sends the data the clients sent in the recorded sessions read
+// from r to the server at addr. Each session is replayed on its own
+// connection, concurrently with the others, keeping the recorded timing.
+// The responses of the server are read and discarded.
+func Replay(ctx context.Context, r io.Reader, addr string, opts ReplayOptions) error {
+	sessions, start, err := readSessions(r)
+	if err != nil {
+		return err
+	}
+
+	begin := time.Now()
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(sessions))
+	for i, recs := range sessions {
+		wg.Add(1)
+		go func(i int, recs []Record) {
+			defer wg.Done()
+			errs[i] = replaySession(ctx, recs, addr, start, begin, opts.Speed)
+		}(i, recs)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+func readSessions(r io.Reader) ([][]Record, time.Time, error) {
+	var start time.Time
+	var sessions [][]Record
+	index := make(map[uint64]int)
+
+	dec := json.NewDecoder(r)
+	for {
+		var rec Record
+		if err := dec.Decode(&rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, start, fmt.Errorf("failed to read session record: %w", err)
+		}
+		if start.IsZero() {
+			start = rec.Time
+		}
+
+		i, ok := index[rec.Session]
+		if !ok {
+			i = len(sessions)
+			index[rec.Session] = i
+			sessions = append(sessions, nil)
+		}
+		sessions[i] = append(sessions[i], rec)
+	}
+
+	return sessions, start, nil
+}
+
+func replaySession(ctx context.Context, recs []Record, addr string, start, begin time.Time, speed float64) error {
+	var d net.Dialer
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+
+	for _, rec := range recs {
+		if speed > 0 {
+			at := begin.Add(time.Duration(float64(rec.Time.Sub(start)) / speed))
+			timer := time.NewTimer(time.Until(at))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+		}
+
+		switch rec.Event {
+		case Open:
+			c, err := d.DialContext(ctx, "tcp", addr)
+			if err != nil {
+				return fmt.Errorf("session %d: failed to connect to %s: %w", rec.Session, addr, err)
+			}
+			conn = c
+			go io.Copy(io.Discard, c)
+		case Recv:
+			if conn == nil {
+				return fmt.Errorf("session %d: data before open", rec.Session)
+			}
+			if _, err := conn.Write(rec.Data); err != nil {
+				return fmt.Errorf("session %d: failed to send data: %w", rec.Session, err)
+			}
+		case Close:
+			if conn != nil {
+				conn.Close()
+				conn = nil
+			}
+		}
+	}
+
+	return nil
+}
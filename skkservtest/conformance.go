@@ -0,0 +1,343 @@
+// Package skkservtest provides utilities for testing skkserv servers.
+package skkservtest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	skkserv "github.com/kechako/goskkserv"
+)
+
+// Config describes the server under conformance checks.
+type Config struct {
+	Addr     string
+	Encoding skkserv.Encoding
+
+	// Key is a key the server has candidates for.
+	Key string
+	// MissingKey is a key the server has no candidates for.
+	MissingKey string
+
+	// Timeout limits the time of each check. Default is 3 seconds.
+	Timeout time.Duration
+}
+
+type Result struct {
+	Check string
+	Err   error
+}
+
+type check struct {
+	name string
+	run  func(c *conn, cfg *Config) error
+}
+
+var checks = []check{
+	{"version", checkVersion},
+	{"host", checkHost},
+	{"request/found", checkFound},
+	{"request/not-found", checkNotFound},
+	{"request/newline-terminated", checkNewlineTerminated},
+	{"request/pipelined", checkPipelined},
+	{"request/long-key", checkLongKey},
+	{"completion", checkCompletion},
+	{"end", checkEnd},
+	{"concurrent-connections", checkConcurrent},
+}
+
+// Conformance runs the protocol checks against the server described by cfg
+// and returns the result of each check.
+func Conformance(cfg Config) []Result {
+	if cfg.Key == "" {
+		cfg.Key = "かんじ"
+	}
+	if cfg.MissingKey == "" {
+		cfg.MissingKey = "goskkservtest-missing-key"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 3 * time.Second
+	}
+
+	results := make([]Result, 0, len(checks))
+	for _, ch := range checks {
+		results = append(results, Result{
+			Check: ch.name,
+			Err:   runCheck(ch, &cfg),
+		})
+	}
+
+	return results
+}
+
+// TestConformance runs the protocol checks as subtests of t.
+func TestConformance(t *testing.T, cfg Config) {
+	t.Helper()
+
+	for _, r := range Conformance(cfg) {
+		r := r
+		t.Run(r.Check, func(t *testing.T) {
+			if r.Err != nil {
+				t.Error(r.Err)
+			}
+		})
+	}
+}
+
+func runCheck(ch check, cfg *Config) error {
+	c, err := dial(cfg)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	return ch.run(c, cfg)
+}
+
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+	w io.Writer
+}
+
+func dial(cfg *Config) (*conn, error) {
+	c, err := net.DialTimeout("tcp", cfg.Addr, cfg.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", cfg.Addr, err)
+	}
+	if err := c.SetDeadline(time.Now().Add(cfg.Timeout)); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	enc := cfg.Encoding.TextEncoding()
+	return &conn{
+		Conn: c,
+		r:    bufio.NewReader(enc.NewDecoder().Reader(c)),
+		w:    enc.NewEncoder().Writer(c),
+	}, nil
+}
+
+func (c *conn) send(req string) error {
+	if _, err := io.WriteString(c.w, req); err != nil {
+		return fmt.Errorf("failed to send %q: %w", req, err)
+	}
+	return nil
+}
+
+// readLine reads a response terminated by a newline. A not found response
+// may also end with the echo of req without a newline.
+func (c *conn) readLine(req string) (string, error) {
+	var resp []byte
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return string(resp), fmt.Errorf("failed to read response to %q: %w", req, err)
+		}
+		if len(resp) == 0 && (b == ' ' || b == '\r' || b == '\n') {
+			continue
+		}
+		if b == '\n' {
+			return string(resp), nil
+		}
+		resp = append(resp, b)
+		if resp[0] == skkserv.ServerNotFound && string(resp[1:]) == req[1:] {
+			return string(resp), nil
+		}
+	}
+}
+
+// readAvailable reads a response without a terminator.
+func (c *conn) readAvailable(req string) (string, error) {
+	buf := make([]byte, 1024)
+	n, err := c.r.Read(buf)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response to %q: %w", req, err)
+	}
+	return string(buf[:n]), nil
+}
+
+func (c *conn) request(req string) (string, error) {
+	if err := c.send(req); err != nil {
+		return "", err
+	}
+	return c.readLine(req)
+}
+
+func checkVersion(c *conn, cfg *Config) error {
+	if err := c.send("2"); err != nil {
+		return err
+	}
+	resp, err := c.readAvailable("2")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(resp) == "" {
+		return errors.New("empty version")
+	}
+	return nil
+}
+
+func checkHost(c *conn, cfg *Config) error {
+	if err := c.send("3"); err != nil {
+		return err
+	}
+	resp, err := c.readAvailable("3")
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(resp) == "" {
+		return errors.New("empty host")
+	}
+	return nil
+}
+
+func checkFound(c *conn, cfg *Config) error {
+	req := "1" + cfg.Key + " "
+	resp, err := c.request(req)
+	if err != nil {
+		return err
+	}
+	return validateFound(req, resp)
+}
+
+func validateFound(req, resp string) error {
+	if resp == "" || resp[0] != skkserv.ServerFound {
+		return fmt.Errorf("response to %q: want found, got %q", req, resp)
+	}
+	if len(resp) < 3 || resp[1] != '/' || resp[len(resp)-1] != '/' {
+		return fmt.Errorf("response to %q: malformed candidates %q", req, resp)
+	}
+	for _, c := range strings.Split(resp[2:len(resp)-1], "/") {
+		if c == "" {
+			return fmt.Errorf("response to %q: empty candidate in %q", req, resp)
+		}
+	}
+	return nil
+}
+
+func checkNotFound(c *conn, cfg *Config) error {
+	req := "1" + cfg.MissingKey + " "
+	resp, err := c.request(req)
+	if err != nil {
+		return err
+	}
+	if resp == "" || resp[0] != skkserv.ServerNotFound {
+		return fmt.Errorf("response to %q: want not found, got %q", req, resp)
+	}
+
+	// the connection must still be usable
+	return checkFound(c, cfg)
+}
+
+func checkNewlineTerminated(c *conn, cfg *Config) error {
+	req := "1" + cfg.Key + "\n"
+	resp, err := c.request(req)
+	if err != nil {
+		return err
+	}
+	return validateFound(req, resp)
+}
+
+func checkPipelined(c *conn, cfg *Config) error {
+	found := "1" + cfg.Key + " "
+	missing := "1" + cfg.MissingKey + " "
+	if err := c.send(found + missing + found); err != nil {
+		return err
+	}
+
+	for _, req := range []string{found, missing, found} {
+		resp, err := c.readLine(req)
+		if err != nil {
+			return err
+		}
+		if req == missing {
+			if resp == "" || resp[0] != skkserv.ServerNotFound {
+				return fmt.Errorf("response to %q: want not found, got %q", req, resp)
+			}
+			continue
+		}
+		if err := validateFound(req, resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkLongKey(c *conn, cfg *Config) error {
+	req := "1" + strings.Repeat("あ", 300) + " "
+	resp, err := c.request(req)
+	if err != nil {
+		return err
+	}
+	if resp == "" || resp[0] != skkserv.ServerNotFound {
+		return fmt.Errorf("response to long key: want not found, got %q", resp)
+	}
+
+	return checkFound(c, cfg)
+}
+
+func checkCompletion(c *conn, cfg *Config) error {
+	key := []rune(cfg.Key)
+	req := "4" + string(key[:1]) + " "
+	resp, err := c.request(req)
+	if err != nil {
+		return err
+	}
+	if resp == "" || (resp[0] != skkserv.ServerFound && resp[0] != skkserv.ServerNotFound) {
+		return fmt.Errorf("response to %q: want found or not found, got %q", req, resp)
+	}
+	return nil
+}
+
+func checkEnd(c *conn, cfg *Config) error {
+	if err := c.send("0"); err != nil {
+		return err
+	}
+
+	var buf [1]byte
+	_, err := c.r.Read(buf[:])
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return errors.New("connection not closed after end")
+	}
+	if err != nil {
+		// connection reset is also fine
+		return nil
+	}
+	return fmt.Errorf("unexpected data after end: %q", buf[:])
+}
+
+func checkConcurrent(c *conn, cfg *Config) error {
+	other, err := dial(cfg)
+	if err != nil {
+		return err
+	}
+	defer other.Close()
+
+	req := "1" + cfg.Key + " "
+	if err := other.send(req); err != nil {
+		return err
+	}
+	if err := c.send(req); err != nil {
+		return err
+	}
+	for _, cc := range []*conn{c, other} {
+		resp, err := cc.readLine(req)
+		if err != nil {
+			return err
+		}
+		if err := validateFound(req, resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package skkservtest
+
+import (
+	"fmt"
+	"net"
+
+	skkserv "github.com/kechako/goskkserv"
+	"github.com/kechako/goskkserv/client"
+	"github.com/kechako/goskkserv/dict"
+	"github.com/kechako/goskkserv/internal/pipenet"
+)
+
+// Server is a skkserv server listening on a random localhost port and on
+// in-memory connections, for use in tests.
+type Server struct {
+	// Addr is the address of the server in the form "127.0.0.1:port".
+	Addr   string
+	Server *skkserv.Server
+
+	tcp  net.Listener
+	pipe *pipenet.Listener
+	done chan struct{}
+}
+
+// NewServer starts a UTF-8 server serving d. The caller should call Close
+// when finished.
+func NewServer(d dict.Searcher) *Server {
+	return StartServer(&skkserv.Server{
+		Dictionary: d,
+		Encoding:   skkserv.UTF8,
+	})
+}
+
+// StartServer starts srv on a random localhost port and on in-memory
+// connections. The caller should call Close when finished.
+func StartServer(srv *skkserv.Server) *Server {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		if l, err = net.Listen("tcp6", "[::1]:0"); err != nil {
+			panic(fmt.Sprintf("skkservtest: failed to listen on a port: %v", err))
+		}
+	}
+
+	s := &Server{
+		Addr:   l.Addr().String(),
+		Server: srv,
+		tcp:    l,
+		pipe:   pipenet.New(),
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.done)
+		errs := make(chan error, 2)
+		for _, l := range []net.Listener{s.tcp, s.pipe} {
+			go func(l net.Listener) {
+				errs <- srv.Serve(l)
+			}(l)
+		}
+		<-errs
+		<-errs
+	}()
+
+	return s
+}
+
+// Dial connects to the server over TCP.
+func (s *Server) Dial() (net.Conn, error) {
+	return net.Dial("tcp", s.Addr)
+}
+
+// Pipe connects to the server over an in-memory connection.
+func (s *Server) Pipe() net.Conn {
+	return s.pipe.Dial()
+}
+
+// Client returns a client connected to the server over an in-memory
+// connection.
+func (s *Server) Client() *client.Client {
+	return client.NewClient(s.Pipe(), client.WithEncoding(s.Server.Encoding))
+}
+
+// Close shuts down the server and waits for it to stop.
+func (s *Server) Close() {
+	s.Server.Shutdown()
+	// the listeners may not be served yet
+	s.tcp.Close()
+	s.pipe.Close()
+	<-s.done
+}
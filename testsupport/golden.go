@@ -0,0 +1,226 @@
+// Package testsupport provides helpers to run scripted exchanges against a
+// skkserv.Server and compare the wire responses with golden files.
+package testsupport
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	skkserv "github.com/kechako/goskkserv"
+	"github.com/kechako/goskkserv/internal/pipenet"
+)
+
+var DefaultEncodings = []skkserv.Encoding{
+	skkserv.UTF8,
+	skkserv.EUCJP,
+	skkserv.ShiftJIS,
+}
+
+// Golden runs a request script against Server once per encoding, and
+// compares each transcript with the golden file
+// <script without extension>.<encoding>.golden.
+//
+// A script is a text file with one Go quoted request per line. Empty lines
+// and lines starting with '#' are ignored.
+type Golden struct {
+	Server    *skkserv.Server
+	Encodings []skkserv.Encoding
+	Timeout   time.Duration
+
+	// Update rewrites the golden files instead of comparing them.
+	Update bool
+}
+
+func (g *Golden) Run(t testing.TB, script string) {
+	t.Helper()
+
+	requests, err := ReadScript(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, enc := range g.encodings() {
+		golden := GoldenPath(script, enc)
+
+		g.Server.SetEncoding(enc)
+		got, err := Record(g.Server, requests, g.timeout())
+		if err != nil {
+			t.Errorf("%s: %v", golden, err)
+			continue
+		}
+
+		if g.Update {
+			if err := os.WriteFile(golden, got, 0644); err != nil {
+				t.Errorf("failed to update golden file %s: %v", golden, err)
+			}
+			continue
+		}
+
+		want, err := os.ReadFile(golden)
+		if err != nil {
+			t.Errorf("failed to read golden file %s: %v", golden, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: transcript mismatch\n--- got\n%s--- want\n%s", golden, got, want)
+		}
+	}
+}
+
+func (g *Golden) encodings() []skkserv.Encoding {
+	if len(g.Encodings) > 0 {
+		return g.Encodings
+	}
+
+	return DefaultEncodings
+}
+
+func (g *Golden) timeout() time.Duration {
+	if g.Timeout > 0 {
+		return g.Timeout
+	}
+
+	return time.Second
+}
+
+func GoldenPath(script string, enc skkserv.Encoding) string {
+	base := strings.TrimSuffix(script, filepath.Ext(script))
+	return base + "." + string(enc) + ".golden"
+}
+
+func ReadScript(name string) ([]string, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open script %s: %w", name, err)
+	}
+	defer file.Close()
+
+	var requests []string
+	s := bufio.NewScanner(file)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		req, err := strconv.Unquote(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid request %s: %w", name, n, line, err)
+		}
+		requests = append(requests, req)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read script %s: %w", name, err)
+	}
+
+	return requests, nil
+}
+
+// Record sends requests to srv over an in-memory connection using the
+// encoding of srv, and returns the transcript of raw wire bytes.
+func Record(srv *skkserv.Server, requests []string, timeout time.Duration) ([]byte, error) {
+	l := pipenet.New()
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(l)
+	}()
+	defer func() {
+		srv.Shutdown()
+		<-done
+	}()
+
+	conn := l.Dial()
+	defer conn.Close()
+
+	enc := srv.Encoding.TextEncoding()
+
+	var transcript bytes.Buffer
+	buf := make([]byte, 4096)
+	for _, req := range requests {
+		data, err := enc.NewEncoder().Bytes([]byte(req))
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request %q: %w", req, err)
+		}
+		fmt.Fprintf(&transcript, "> %s\n", quote(data, srv.Encoding))
+
+		if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+			return nil, err
+		}
+		if _, err := conn.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to write request %q: %w", req, err)
+		}
+
+		if len(req) == 0 || req[0] == skkserv.ClientEnd {
+			continue
+		}
+
+		var resp []byte
+		for {
+			n, err := conn.Read(buf)
+			resp = append(resp, buf[:n]...)
+			if err != nil {
+				var ne net.Error
+				if errors.As(err, &ne) && ne.Timeout() {
+					break
+				}
+				return nil, fmt.Errorf("failed to read response of %q: %w", req, err)
+			}
+			if req[0] == skkserv.ClientVersion || req[0] == skkserv.ClientHost {
+				break
+			}
+			if complete(resp, data) {
+				break
+			}
+		}
+		fmt.Fprintf(&transcript, "< %s\n", quote(resp, srv.Encoding))
+	}
+
+	return transcript.Bytes(), nil
+}
+
+func complete(resp, req []byte) bool {
+	if bytes.HasSuffix(resp, []byte{'\n'}) {
+		return true
+	}
+
+	// not found responses echo the request without a trailing newline
+	return len(resp) > 0 && resp[0] == skkserv.ServerNotFound && bytes.Equal(resp[1:], req[1:])
+}
+
+func quote(b []byte, enc skkserv.Encoding) string {
+	if enc == skkserv.UTF8 {
+		return strconv.Quote(string(b))
+	}
+
+	const hex = "0123456789abcdef"
+
+	var s strings.Builder
+	s.WriteByte('"')
+	for _, c := range b {
+		switch {
+		case c == '"' || c == '\\':
+			s.WriteByte('\\')
+			s.WriteByte(c)
+		case c == '\n':
+			s.WriteString(`\n`)
+		case c < 0x20 || c >= 0x7f:
+			s.WriteString(`\x`)
+			s.WriteByte(hex[c>>4])
+			s.WriteByte(hex[c&0xf])
+		default:
+			s.WriteByte(c)
+		}
+	}
+	s.WriteByte('"')
+
+	return s.String()
+}
@@ -0,0 +1,43 @@
+package testsupport
+
+import (
+	"flag"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	skkserv "github.com/kechako/goskkserv"
+	"github.com/kechako/goskkserv/dict"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+const testJisyo = `;; okuri-ari entries.
+おくr /送/贈/
+;; okuri-nasi entries.
+かんじ /漢字/感じ;feeling/
+かんじょう /感情/勘定/
+そーす /ソース/
+a/b /(concat "a\057b")/
+`
+
+func TestGolden(t *testing.T) {
+	d, err := dict.Load(strings.NewReader(testJisyo), dict.Encoding("utf-8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scripts, err := filepath.Glob(filepath.Join("testdata", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, script := range scripts {
+		t.Run(filepath.Base(script), func(t *testing.T) {
+			g := &Golden{
+				Server: &skkserv.Server{Dictionary: d},
+				Update: *update,
+			}
+			g.Run(t, script)
+		})
+	}
+}
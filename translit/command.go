@@ -0,0 +1,176 @@
+package translit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Command is a Transliterator bridging to an external engine running as a
+// subprocess.
+//
+// For each conversion, the reading followed by a newline is written to the
+// standard input of the process, which must answer with one candidate per
+// line in the form "text<TAB>score" (the score is optional), terminated by
+// an empty line. All data is UTF-8.
+type Command struct {
+	name string
+	args []string
+
+	mu     sync.Mutex
+	proc   *process
+	closed bool
+}
+
+// process is a running process of the engine.
+type process struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+var _ Transliterator = (*Command)(nil)
+
+// StartCommand starts the named engine. If the engine stops answering, it
+// is killed, and started again at the next conversion.
+func StartCommand(name string, args ...string) (*Command, error) {
+	c := &Command{
+		name: name,
+		args: args,
+	}
+	proc, err := c.start()
+	if err != nil {
+		return nil, err
+	}
+	c.proc = proc
+
+	return c, nil
+}
+
+func (c *Command) start() (*process, error) {
+	cmd := exec.Command(c.name, c.args...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stdin of %s: %w", c.name, err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stdout of %s: %w", c.name, err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", c.name, err)
+	}
+
+	return &process{
+		cmd:    cmd,
+		stdin:  stdin,
+		stdout: bufio.NewReader(stdout),
+	}, nil
+}
+
+// kill kills the process and waits for it to exit.
+func (p *process) kill() {
+	p.cmd.Process.Kill()
+	p.cmd.Wait()
+}
+
+func (c *Command) Transliterate(ctx context.Context, reading string) ([]Candidate, error) {
+	if strings.ContainsAny(reading, "\r\n") {
+		return nil, errors.New("invalid reading")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, errors.New("transliterator closed")
+	}
+	if c.proc == nil {
+		proc, err := c.start()
+		if err != nil {
+			return nil, err
+		}
+		c.proc = proc
+	}
+	proc := c.proc
+
+	type result struct {
+		candidates []Candidate
+		err        error
+	}
+	done := make(chan result, 1)
+	go func() {
+		candidates, err := proc.exchange(reading)
+		done <- result{candidates, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			// the rest of the answer may still be in the pipe
+			proc.kill()
+			c.proc = nil
+		}
+		return r.candidates, r.err
+	case <-ctx.Done():
+		// the late answer would be read by the next conversion, so the
+		// process is replaced by a new one
+		proc.kill()
+		c.proc = nil
+		return nil, ctx.Err()
+	}
+}
+
+func (p *process) exchange(reading string) ([]Candidate, error) {
+	if _, err := io.WriteString(p.stdin, reading+"\n"); err != nil {
+		return nil, fmt.Errorf("failed to write reading: %w", err)
+	}
+
+	var candidates []Candidate
+	for {
+		line, err := p.stdout.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("failed to read candidates: %w", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+
+		cand := Candidate{Text: line}
+		if i := strings.LastIndexByte(line, '\t'); i >= 0 {
+			score, err := strconv.ParseFloat(line[i+1:], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid score %q: %w", line[i+1:], err)
+			}
+			cand.Text = line[:i]
+			cand.Score = score
+		}
+		candidates = append(candidates, cand)
+	}
+
+	return candidates, nil
+}
+
+func (c *Command) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	if c.proc == nil {
+		return nil
+	}
+	proc := c.proc
+	c.proc = nil
+
+	proc.stdin.Close()
+	return proc.cmd.Wait()
+}
@@ -0,0 +1,93 @@
+package translit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// TestMain runs the test binary as an engine answering each reading with
+// itself, or hanging for "slow", if GOSKKSERV_TEST_ENGINE is set.
+func TestMain(m *testing.M) {
+	if os.Getenv("GOSKKSERV_TEST_ENGINE") == "" {
+		os.Exit(m.Run())
+	}
+
+	s := bufio.NewScanner(os.Stdin)
+	for s.Scan() {
+		if s.Text() == "slow" {
+			time.Sleep(time.Hour)
+		}
+		fmt.Printf("%s\t0.5\n%s!\n\n", s.Text(), s.Text())
+	}
+	os.Exit(0)
+}
+
+func startTestEngine(t *testing.T) *Command {
+	t.Helper()
+
+	t.Setenv("GOSKKSERV_TEST_ENGINE", "1")
+	c, err := StartCommand(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+
+	return c
+}
+
+func TestCommand(t *testing.T) {
+	c := startTestEngine(t)
+
+	got, err := c.Transliterate(context.Background(), "かんじ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Candidate{{Text: "かんじ", Score: 0.5}, {Text: "かんじ!"}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Transliterate() = %v, want %v", got, want)
+	}
+
+	if _, err := c.Transliterate(context.Background(), "a\nb"); err == nil {
+		t.Error("Transliterate() of a reading with a newline succeeded")
+	}
+}
+
+func TestCommandRestart(t *testing.T) {
+	c := startTestEngine(t)
+	first := c.proc
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := c.Transliterate(ctx, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Transliterate() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if first.cmd.ProcessState == nil {
+		t.Error("the process timed out is not waited for")
+	}
+
+	got, err := c.Transliterate(context.Background(), "かな")
+	if err != nil {
+		t.Fatalf("Transliterate() after a timeout: %v", err)
+	}
+	if len(got) != 2 || got[0].Text != "かな" {
+		t.Errorf("Transliterate() after a timeout = %v", got)
+	}
+	if c.proc == first {
+		t.Error("the process timed out is used again")
+	}
+}
+
+func TestCommandClose(t *testing.T) {
+	c := startTestEngine(t)
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Transliterate(context.Background(), "かな"); err == nil {
+		t.Error("Transliterate() after Close succeeded")
+	}
+}
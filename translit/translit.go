@@ -0,0 +1,27 @@
+// Package translit defines the interface of kana-kanji conversion engines
+// that can be used as an additional backend stage of the server.
+package translit
+
+import (
+	"context"
+	"sort"
+)
+
+type Candidate struct {
+	Text  string
+	Score float64
+}
+
+type Transliterator interface {
+	// Transliterate converts reading into candidates. Higher scores are
+	// better.
+	Transliterate(ctx context.Context, reading string) ([]Candidate, error)
+}
+
+// SortByScore sorts candidates in descending order of score, keeping the
+// order of candidates with the same score.
+func SortByScore(candidates []Candidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+}
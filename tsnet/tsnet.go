@@ -0,0 +1,67 @@
+// Package tsnet serves the skkserv protocol directly on a Tailscale tailnet.
+//
+// It is a separate module so that the Tailscale dependencies are only
+// pulled in by the programs that use it.
+package tsnet
+
+import (
+	"fmt"
+	"os"
+
+	skkserv "github.com/kechako/goskkserv"
+	"tailscale.com/tsnet"
+)
+
+const DefaultAddr = ":1178"
+
+// AuthKeyEnv is the environment variable the auth key is read from. If it
+// is not set, TS_AUTHKEY is used by tsnet itself.
+const AuthKeyEnv = "GOSKKSERV_TS_AUTHKEY"
+
+type Config struct {
+	// Hostname is the name of the node on the tailnet.
+	Hostname string
+	// Dir is the directory the node state is stored in. If empty, a
+	// directory under the user config directory is used.
+	Dir string
+	// Addr is the address to listen on the tailnet. Default is ":1178".
+	Addr string
+	// Ephemeral registers the node as an ephemeral node.
+	Ephemeral bool
+}
+
+type Server struct {
+	ts   *tsnet.Server
+	addr string
+}
+
+func New(cfg Config) *Server {
+	addr := cfg.Addr
+	if addr == "" {
+		addr = DefaultAddr
+	}
+
+	return &Server{
+		ts: &tsnet.Server{
+			Hostname:  cfg.Hostname,
+			Dir:       cfg.Dir,
+			AuthKey:   os.Getenv(AuthKeyEnv),
+			Ephemeral: cfg.Ephemeral,
+		},
+		addr: addr,
+	}
+}
+
+// Serve serves srv on the tailnet until srv is shut down.
+func (s *Server) Serve(srv *skkserv.Server) error {
+	l, err := s.ts.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on tailnet [%s]: %w", s.addr, err)
+	}
+
+	return srv.Serve(l)
+}
+
+func (s *Server) Close() error {
+	return s.ts.Close()
+}
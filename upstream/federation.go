@@ -0,0 +1,170 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/kechako/goskkserv/dict"
+	"github.com/kechako/goskkserv/log"
+)
+
+// Federation is a dictionary backend that looks up candidates on several
+// upstream servers in parallel. The candidates are merged in the order of
+// the upstream priority and deduplicated by text. Upstreams that are down
+// are skipped; an error is returned only if all of them fail.
+type Federation struct {
+	Upstreams []*Upstream
+	Logger    log.Logger
+
+	// MergeAnnotations merges the annotations of a duplicate candidate.
+	// Nil means dict.KeepFirst.
+	MergeAnnotations dict.AnnotationMerge
+}
+
+var _ dict.Searcher = (*Federation)(nil)
+
+func (f *Federation) Search(ctx context.Context, key string) ([]dict.Candidate, error) {
+	if len(f.Upstreams) == 0 {
+		return nil, nil
+	}
+
+	results := make([][]dict.Candidate, len(f.Upstreams))
+	errs := make([]error, len(f.Upstreams))
+
+	var wg sync.WaitGroup
+	for i, u := range f.Upstreams {
+		wg.Add(1)
+		go func(i int, u *Upstream) {
+			defer wg.Done()
+			results[i], errs[i] = u.Search(ctx, key)
+		}(i, u)
+	}
+	wg.Wait()
+
+	var candidates []dict.Candidate
+	seen := make(map[string]int)
+	failed := 0
+	for _, i := range f.order() {
+		if errs[i] != nil {
+			failed++
+			if !errors.Is(errs[i], ErrUnavailable) {
+				f.logger().Warn(errs[i])
+			}
+			continue
+		}
+		for _, c := range results[i] {
+			if j, ok := seen[c.Text()]; ok {
+				candidates[j] = f.merge(candidates[j], c)
+				continue
+			}
+			seen[c.Text()] = len(candidates)
+			candidates = append(candidates, c)
+		}
+	}
+	if failed == len(f.Upstreams) {
+		return nil, errors.Join(errs...)
+	}
+
+	return candidates, nil
+}
+
+// merge returns kept with the annotation of c merged.
+func (f *Federation) merge(kept, c dict.Candidate) dict.Candidate {
+	if c.Annotation() == "" || c.Annotation() == kept.Annotation() {
+		return kept
+	}
+	m := f.MergeAnnotations
+	if m == nil {
+		m = dict.KeepFirst
+	}
+	if merged := m(kept.Annotation(), c.Annotation()); merged != kept.Annotation() {
+		return dict.NewSourceCandidate(kept.Text(), merged, kept.Source())
+	}
+
+	return kept
+}
+
+func (f *Federation) Complete(ctx context.Context, prefix string) ([]string, error) {
+	if len(f.Upstreams) == 0 {
+		return nil, nil
+	}
+
+	results := make([][]string, len(f.Upstreams))
+	errs := make([]error, len(f.Upstreams))
+
+	var wg sync.WaitGroup
+	for i, u := range f.Upstreams {
+		wg.Add(1)
+		go func(i int, u *Upstream) {
+			defer wg.Done()
+			results[i], errs[i] = u.Complete(ctx, prefix)
+		}(i, u)
+	}
+	wg.Wait()
+
+	var keys []string
+	seen := make(map[string]struct{})
+	failed := 0
+	for _, i := range f.order() {
+		if errs[i] != nil {
+			failed++
+			if !errors.Is(errs[i], ErrUnavailable) {
+				f.logger().Warn(errs[i])
+			}
+			continue
+		}
+		for _, key := range results[i] {
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			keys = append(keys, key)
+		}
+	}
+	if failed == len(f.Upstreams) {
+		return nil, errors.Join(errs...)
+	}
+
+	return keys, nil
+}
+
+// Stats returns zero Stats, as the size of the servers is unknown.
+func (f *Federation) Stats() dict.Stats {
+	return dict.Stats{}
+}
+
+// order returns the indexes of the upstreams in the order of priority.
+func (f *Federation) order() []int {
+	order := make([]int, len(f.Upstreams))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return f.Upstreams[order[i]].Priority > f.Upstreams[order[j]].Priority
+	})
+
+	return order
+}
+
+func (f *Federation) Close() error {
+	var errs []error
+	for _, u := range f.Upstreams {
+		if err := u.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+var nopLogger = log.NewNop()
+
+func (f *Federation) logger() log.Logger {
+	if f.Logger != nil {
+		return f.Logger
+	}
+
+	return nopLogger
+}
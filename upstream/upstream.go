@@ -0,0 +1,228 @@
+// Package upstream provides dictionary backends that look up candidates on
+// other skkserv servers.
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	skkserv "github.com/kechako/goskkserv"
+	"github.com/kechako/goskkserv/client"
+	"github.com/kechako/goskkserv/dict"
+)
+
+const (
+	defaultDialTimeout = 3 * time.Second
+	defaultRetryDelay  = 5 * time.Second
+
+	defaultPort = "1178"
+)
+
+var ErrUnavailable = errors.New("upstream unavailable")
+
+// Upstream is a dictionary backend that looks up candidates on another
+// skkserv server. The connection is kept open and re-established on demand.
+type Upstream struct {
+	Addr     string
+	Encoding skkserv.Encoding
+
+	// Priority orders the candidates of upstreams in a Federation. Upstreams
+	// with higher priority come first.
+	Priority int
+
+	// DialTimeout limits the time to connect to the server.
+	DialTimeout time.Duration
+	// RetryDelay is the time to wait before connecting again after the
+	// server is found down.
+	RetryDelay time.Duration
+
+	mu         sync.Mutex
+	client     *client.Client
+	retryAfter time.Time
+}
+
+var _ dict.Searcher = (*Upstream)(nil)
+
+func New(addr string, enc skkserv.Encoding) *Upstream {
+	return &Upstream{
+		Addr:     addr,
+		Encoding: enc,
+	}
+}
+
+func init() {
+	dict.RegisterBackend("skkserv", open)
+}
+
+// open opens the Upstream of name as Parse. If name has the query
+// "cache=n", the results of up to n keys are cached, for the time of the
+// query "cache_ttl" if it is given. The keys not found are cached for the
+// time of the query "cache_negative_ttl".
+func open(name string) (dict.Searcher, error) {
+	u, err := Parse(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// name is valid as Parse succeeded
+	parsed, _ := url.Parse(name)
+	q := parsed.Query()
+	if q.Get("cache") == "" {
+		return u, nil
+	}
+	size, err := strconv.Atoi(q.Get("cache"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream %s: invalid cache size", name)
+	}
+	var opts []dict.CacheOption
+	if s := q.Get("cache_ttl"); s != "" {
+		ttl, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstream %s: invalid cache TTL", name)
+		}
+		opts = append(opts, dict.CacheTTL(ttl))
+	}
+	if s := q.Get("cache_negative_ttl"); s != "" {
+		ttl, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstream %s: invalid negative cache TTL", name)
+		}
+		opts = append(opts, dict.CacheNegativeTTL(ttl))
+	}
+
+	return dict.NewCache(u, size, opts...), nil
+}
+
+// Parse returns the Upstream of a URL in the form
+// "skkserv://host[:port][?encoding=enc]". Other queries are ignored. The
+// port defaults to 1178, and the encoding to EUC-JP, as most skkserv
+// servers use.
+func Parse(rawURL string) (*Upstream, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream %s: %w", rawURL, err)
+	}
+	if u.Scheme != "skkserv" || u.Host == "" {
+		return nil, fmt.Errorf("invalid upstream %s", rawURL)
+	}
+
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+
+	enc := skkserv.EUCJP
+	if s := u.Query().Get("encoding"); s != "" {
+		enc, err = skkserv.ParseEncoding(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid upstream %s: %w", rawURL, err)
+		}
+	}
+
+	return New(addr, enc), nil
+}
+
+func (u *Upstream) Search(ctx context.Context, key string) ([]dict.Candidate, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if err := u.connect(ctx); err != nil {
+		return nil, err
+	}
+
+	candidates, err := u.client.Search(ctx, key)
+	if err != nil {
+		u.close()
+		return nil, fmt.Errorf("failed to search [%s] on %s: %w", key, u.Addr, err)
+	}
+
+	source := "skkserv://" + u.Addr
+	for i, c := range candidates {
+		candidates[i] = dict.NewSourceCandidate(c.Text(), c.Annotation(), source)
+	}
+
+	return candidates, nil
+}
+
+func (u *Upstream) Complete(ctx context.Context, prefix string) ([]string, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if err := u.connect(ctx); err != nil {
+		return nil, err
+	}
+
+	keys, err := u.client.Complete(ctx, prefix)
+	if err != nil {
+		u.close()
+		return nil, fmt.Errorf("failed to complete [%s] on %s: %w", prefix, u.Addr, err)
+	}
+
+	return keys, nil
+}
+
+// Stats returns zero Stats, as the size of the server is unknown.
+func (u *Upstream) Stats() dict.Stats {
+	return dict.Stats{}
+}
+
+func (u *Upstream) Close() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.close()
+}
+
+func (u *Upstream) connect(ctx context.Context) error {
+	if u.client != nil {
+		return nil
+	}
+	if time.Now().Before(u.retryAfter) {
+		return fmt.Errorf("%s: %w", u.Addr, ErrUnavailable)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, u.dialTimeout())
+	defer cancel()
+
+	c, err := client.DialContext(ctx, u.Addr, client.WithEncoding(u.Encoding))
+	if err != nil {
+		u.retryAfter = time.Now().Add(u.retryDelay())
+		return err
+	}
+	u.client = c
+
+	return nil
+}
+
+func (u *Upstream) close() error {
+	if u.client == nil {
+		return nil
+	}
+
+	err := u.client.Close()
+	u.client = nil
+
+	return err
+}
+
+func (u *Upstream) dialTimeout() time.Duration {
+	if u.DialTimeout > 0 {
+		return u.DialTimeout
+	}
+
+	return defaultDialTimeout
+}
+
+func (u *Upstream) retryDelay() time.Duration {
+	if u.RetryDelay > 0 {
+		return u.RetryDelay
+	}
+
+	return defaultRetryDelay
+}